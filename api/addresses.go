@@ -0,0 +1,217 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// AddressRequest holds the fields of an address sent by clients
+type AddressRequest struct {
+	Name      string `json:"name" validate:"max=100"`
+	Street    string `json:"street" validate:"required,max=200"`
+	Suite     string `json:"suite" validate:"max=100"`
+	City      string `json:"city" validate:"required,max=100"`
+	State     string `json:"state" validate:"max=100"`
+	Zip       string `json:"zip" validate:"max=20,pattern=^[A-Za-z0-9][A-Za-z0-9 -]*$"`
+	IsPrimary bool   `json:"is_primary"`
+}
+
+// normalize trims surrounding whitespace from all fields
+func (req *AddressRequest) normalize() {
+	for _, field := range []*string{&req.Name, &req.Street, &req.Suite, &req.City, &req.State, &req.Zip} {
+		*field = strings.TrimSpace(*field)
+	}
+}
+
+// AddressResponse is the representation of an address returned to clients
+type AddressResponse struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name,omitempty"`
+	Street    string    `json:"street,omitempty"`
+	Suite     string    `json:"suite,omitempty"`
+	City      string    `json:"city,omitempty"`
+	State     string    `json:"state,omitempty"`
+	Zip       string    `json:"zip,omitempty"`
+	IsPrimary bool      `json:"is_primary"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AddressListResponse wraps a list of addresses
+type AddressListResponse struct {
+	Addresses []AddressResponse `json:"addresses"`
+}
+
+// ToAddressResponse creates a response struct from an address model
+func ToAddressResponse(addr *models.Address) AddressResponse {
+	return AddressResponse{
+		ID:        addr.ID.String(),
+		UserID:    addr.UserID.String(),
+		Name:      addr.Name,
+		Street:    addr.Street,
+		Suite:     addr.Suite,
+		City:      addr.City,
+		State:     addr.State,
+		Zip:       addr.Zip,
+		IsPrimary: addr.IsPrimary,
+		CreatedAt: addr.CreatedAt,
+		UpdatedAt: addr.UpdatedAt,
+	}
+}
+
+// toModel creates an address model for the given user from the request
+func (req AddressRequest) toModel(userID, id uuid.UUID) *models.Address {
+	return &models.Address{
+		ID:        id,
+		UserID:    userID,
+		Name:      req.Name,
+		Street:    req.Street,
+		Suite:     req.Suite,
+		City:      req.City,
+		State:     req.State,
+		Zip:       req.Zip,
+		IsPrimary: req.IsPrimary,
+	}
+}
+
+// ListAddressesHandler returns all addresses of a user
+func ListAddressesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	addressRepo := db.NewAddressRepository(db.GetPool())
+	addresses, err := addressRepo.ListByUser(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := AddressListResponse{Addresses: make([]AddressResponse, 0, len(addresses))}
+	for i := range addresses {
+		resp.Addresses = append(resp.Addresses, ToAddressResponse(&addresses[i]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateAddressHandler adds an address to a user
+func CreateAddressHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req AddressRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	logger.Info("Creating new address",
+		zap.String("user_id", userID.String()),
+		zap.Bool("is_primary", req.IsPrimary))
+
+	addressRepo := db.NewAddressRepository(db.GetPool())
+	addr, err := addressRepo.Create(r.Context(), req.toModel(userID, uuid.Nil))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ToAddressResponse(addr))
+}
+
+// GetAddressHandler returns a single address of a user
+func GetAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := pathUUID(w, r, "addressID")
+	if !ok {
+		return
+	}
+
+	addressRepo := db.NewAddressRepository(db.GetPool())
+	addr, err := addressRepo.GetByID(r.Context(), userID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToAddressResponse(addr))
+}
+
+// UpdateAddressHandler replaces all fields of an address
+func UpdateAddressHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, ok := pathUUID(w, r, "addressID")
+	if !ok {
+		return
+	}
+
+	var req AddressRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	logger.Info("Updating address",
+		zap.String("user_id", userID.String()),
+		zap.String("id", id.String()),
+		zap.Bool("is_primary", req.IsPrimary))
+
+	addressRepo := db.NewAddressRepository(db.GetPool())
+	addr, err := addressRepo.Update(r.Context(), req.toModel(userID, id))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToAddressResponse(addr))
+}
+
+// DeleteAddressHandler removes an address of a user
+func DeleteAddressHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := pathUUID(w, r, "addressID")
+	if !ok {
+		return
+	}
+
+	logger.Info("Deleting address",
+		zap.String("user_id", userID.String()),
+		zap.String("id", id.String()))
+
+	addressRepo := db.NewAddressRepository(db.GetPool())
+	if err := addressRepo.Delete(r.Context(), userID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,66 +2,102 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"frame/db"
 	"frame/logging"
 	"frame/models"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// Maximum lengths match the varchar(100) columns of the users table
 type UserRequest struct {
-	Fname string `json:"fname"`
-	Lname string `json:"lname"`
+	Fname string `json:"fname" validate:"required,max=100"`
+	Lname string `json:"lname" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,max=100,email"`
+}
+
+// UserPatchRequest holds the fields that may be changed by a partial update
+type UserPatchRequest struct {
+	Fname *string `json:"fname" validate:"min=1,max=100"`
+	Lname *string `json:"lname" validate:"min=1,max=100"`
+	Email *string `json:"email" validate:"min=1,max=100,email"`
+}
+
+// normalize trims surrounding whitespace from all fields
+func (req *UserRequest) normalize() {
+	req.Fname = strings.TrimSpace(req.Fname)
+	req.Lname = strings.TrimSpace(req.Lname)
+	req.Email = strings.TrimSpace(req.Email)
+}
+
+// normalize trims surrounding whitespace from the fields present in the request
+func (req *UserPatchRequest) normalize() {
+	for _, field := range []*string{req.Fname, req.Lname, req.Email} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
 }
 
 type UserResponse struct {
 	ID        string     `json:"id"`
 	FirstName *string    `json:"first_name,omitempty"`
 	LastName  *string    `json:"last_name,omitempty"`
+	Email     *string    `json:"email,omitempty"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserListResponse wraps one page of users
+type UserListResponse struct {
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 // NewUserResponse creates a response struct based on whether the user was created or found
 func NewUserResponse(user *models.User, isNewUser bool) UserResponse {
-	resp := UserResponse{
-		ID: user.ID.String(),
+	if !isNewUser {
+		return UserResponse{ID: user.ID.String()}
 	}
+	return ToUserResponse(user)
+}
 
-	if isNewUser {
-		firstName := user.FirstName
-		lastName := user.LastName
-		createdAt := user.CreatedAt
-		updatedAt := user.UpdatedAt
+// ToUserResponse creates a response struct containing all user fields
+func ToUserResponse(user *models.User) UserResponse {
+	firstName := user.FirstName
+	lastName := user.LastName
+	createdAt := user.CreatedAt
+	updatedAt := user.UpdatedAt
 
-		resp.FirstName = &firstName
-		resp.LastName = &lastName
-		resp.CreatedAt = &createdAt
-		resp.UpdatedAt = &updatedAt
+	resp := UserResponse{
+		ID:        user.ID.String(),
+		FirstName: &firstName,
+		LastName:  &lastName,
+		CreatedAt: &createdAt,
+		UpdatedAt: &updatedAt,
+		DeletedAt: user.DeletedAt,
+	}
+	if user.Email != "" {
+		email := user.Email
+		resp.Email = &email
 	}
 
 	return resp
 }
 
 func UserHandler(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger()
-
-	if r.Method != http.MethodPost {
-		logger.Warn("Method not allowed",
-			zap.String("method", r.Method),
-			zap.String("path", r.URL.Path))
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	logger := logging.FromContext(r.Context())
 
 	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Failed to decode request",
-			zap.Error(err))
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -73,21 +109,256 @@ func UserHandler(w http.ResponseWriter, r *http.Request) {
 	userRepo := db.NewUserRepository(db.GetPool())
 
 	// Create user in database
-	user, isNewUser, err := userRepo.Create(r.Context(), req.Fname, req.Lname)
+	user, isNewUser, err := userRepo.Create(r.Context(), req.Fname, req.Lname, req.Email)
 	if err != nil {
 		logger.Error("Failed to create user",
 			zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	resp := NewUserResponse(user, isNewUser)
 
+	if isNewUser {
+		w.Header().Set("ETag", etag(user.Version))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		logger.Error("Failed to encode response",
 			zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 }
+
+// userFilterQuery holds the query parameters read by parseUserFilter
+var userFilterQuery = []string{"email", "name_prefix", "created_after", "include_deleted"}
+
+// parseUserFilter reads the email, name_prefix, created_after and include_deleted query parameters
+func parseUserFilter(r *http.Request) (db.UserFilter, []FieldError) {
+	query := r.URL.Query()
+	filter := db.UserFilter{
+		Email:      query.Get("email"),
+		NamePrefix: query.Get("name_prefix"),
+	}
+
+	var errs []FieldError
+	if raw := query.Get("created_after"); raw != "" {
+		createdAfter, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "created_after", Message: "created_after must be an RFC 3339 timestamp"})
+		}
+		filter.CreatedAfter = createdAfter
+	}
+	if raw := query.Get("include_deleted"); raw != "" {
+		includeDeleted, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "include_deleted", Message: "include_deleted must be true or false"})
+		}
+		filter.IncludeDeleted = includeDeleted
+	}
+
+	return filter, errs
+}
+
+// ListUsersHandler returns one page of users matching the query parameters
+// See parseUserFilter for the supported filters and parsePage for paging parameters
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePage(r)
+	filter, filterErrs := parseUserFilter(r)
+	errs = append(errs, filterErrs...)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+
+	userRepo := db.NewUserRepository(db.GetPool())
+	users, next, err := userRepo.List(r.Context(), filter, page)
+	if errs := pageErrors(err); errs != nil {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := UserListResponse{
+		Users:      make([]UserResponse, 0, len(users)),
+		NextCursor: next,
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, ToUserResponse(&users[i]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetUserHandler returns a single user by ID
+func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	userRepo := db.NewUserRepository(db.GetPool())
+	user, err := userRepo.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	tag := etag(user.Version)
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToUserResponse(user))
+}
+
+// UpdateUserHandler replaces all mutable fields of a user
+// The If-Match header must hold the ETag of the version being replaced
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var req UserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	versions, ok := ifMatchVersions(w, r)
+	if !ok {
+		return
+	}
+
+	updateUser(w, r, id, versions, db.UserPatch{FirstName: &req.Fname, LastName: &req.Lname, Email: &req.Email})
+}
+
+// PatchUserHandler changes only the user fields present in the request
+// The If-Match header must hold the ETag of the version being changed
+func PatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var req UserPatchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	versions, ok := ifMatchVersions(w, r)
+	if !ok {
+		return
+	}
+
+	updateUser(w, r, id, versions, db.UserPatch{FirstName: req.Fname, LastName: req.Lname, Email: req.Email})
+}
+
+// updateUser stores the fields set in patch for a user at one of versions and writes the updated user
+// The fields left out are merged in by the repository once the user is locked.
+func updateUser(w http.ResponseWriter, r *http.Request, id uuid.UUID, versions db.Versions, patch db.UserPatch) {
+	logger := logging.FromContext(r.Context())
+
+	logger.Info("Updating user",
+		zap.String("id", id.String()),
+		zap.Stringp("fname", patch.FirstName),
+		zap.Stringp("lname", patch.LastName))
+
+	userRepo := db.NewUserRepository(db.GetPool())
+	user, err := userRepo.Patch(r.Context(), id, versions, patch)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(user.Version))
+	writeJSON(w, http.StatusOK, ToUserResponse(user))
+}
+
+// DeleteUserHandler soft deletes a user by ID along with their addresses and phones
+// The user can be brought back with RestoreUserHandler until the purge removes them
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	logger.Info("Deleting user",
+		zap.String("id", id.String()))
+
+	userRepo := db.NewUserRepository(db.GetPool())
+	if err := userRepo.Delete(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreUserHandler undoes the soft delete of a user and the addresses and phones deleted with them
+func RestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	logger.Info("Restoring user",
+		zap.String("id", id.String()))
+
+	userRepo := db.NewUserRepository(db.GetPool())
+	user, err := userRepo.Restore(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(user.Version))
+	writeJSON(w, http.StatusOK, ToUserResponse(user))
+}
+
+// requireUser resolves the user ID from the path and checks that the user exists
+// It writes a problem response and returns false when the user can't be used as a parent resource
+func requireUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	userRepo := db.NewUserRepository(db.GetPool())
+	if _, err := userRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// pathUUID parses the named path wildcard as a UUID
+// It writes a problem response and returns false when the wildcard isn't a valid UUID
+func pathUUID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid %s: %v", name, err))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// writeJSON writes v as a JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.GetLogger().Error("Failed to encode response",
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"frame/auth"
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// authorizationHeader carries the API key or JWT of a request as a bearer token
+const authorizationHeader = "Authorization"
+
+// errInvalidCredentials is returned for keys that are malformed, unknown, revoked or don't match their hash
+// The cases aren't told apart so callers can't probe which prefixes exist
+var errInvalidCredentials = errors.New("invalid API key")
+
+// errInvalidToken is returned for JWTs with a bad signature or failing a claim check
+var errInvalidToken = errors.New("invalid token")
+
+// apiKeyStore looks up the API keys requests authenticate with
+type apiKeyStore interface {
+	GetActiveByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	TouchLastUsed(ctx context.Context, used map[uuid.UUID]time.Time) error
+}
+
+// newAPIKeyStore returns the store used by Authenticate, replaced in tests
+var newAPIKeyStore = func() apiKeyStore {
+	return db.NewAPIKeyRepository(db.GetPool())
+}
+
+// newTokenVerifier returns the verifier of JWT bearer tokens, nil when only API keys are accepted,
+// replaced in tests
+var newTokenVerifier = func() *auth.Verifier {
+	return auth.GetVerifier()
+}
+
+// keyUsage collects the keys used since the last FlushKeyUsage
+var keyUsage = auth.NewUsage()
+
+// publicPaths are served without authentication so the API can be discovered and probed
+var publicPaths = map[string]bool{
+	"/openapi.json": true,
+	"/docs":         true,
+	"/healthz":      true,
+	"/readyz":       true,
+}
+
+// PublicPaths returns the paths served without authentication, sorted
+func PublicPaths() []string {
+	return slices.Sorted(maps.Keys(publicPaths))
+}
+
+// Authenticate requires an Authorization: Bearer header holding an active API key, or a valid JWT
+// when a verifier is configured, on every request outside publicPaths. The caller is attached to the
+// request context as an auth.Principal, with the token claims for JWTs, and writes made by the
+// request are attributed to it in the audit log.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := authenticate(r)
+		if errors.Is(err, errInvalidCredentials) || errors.Is(err, errInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="frame"`)
+			writeProblem(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		logging.AddFields(r.Context(), zap.String("principal", principal.Subject))
+		ctx := db.WithActor(auth.WithPrincipal(r.Context(), principal), principal.Subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate resolves the principal of the bearer token of r
+func authenticate(r *http.Request) (*auth.Principal, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get(authorizationHeader), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, errInvalidCredentials
+	}
+	if verifier := newTokenVerifier(); verifier != nil && auth.IsToken(token) {
+		return authenticateToken(r.Context(), verifier, token)
+	}
+
+	prefix, err := auth.ParseKey(token)
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+	key, err := newAPIKeyStore().GetActiveByPrefix(r.Context(), prefix)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !auth.Matches(token, key.Hash) {
+		return nil, errInvalidCredentials
+	}
+
+	keyUsage.Record(key.ID, time.Now())
+	return &auth.Principal{Subject: "api_key:" + key.Prefix, Name: key.Name, KeyID: key.ID, Scopes: key.Scopes}, nil
+}
+
+// authenticateToken resolves the principal of a JWT from its subject
+// Why a token was rejected is only logged, so callers learn no more than for a bad API key
+func authenticateToken(ctx context.Context, verifier *auth.Verifier, token string) (*auth.Principal, error) {
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		logging.FromContext(ctx).Debug("Rejected JWT", zap.Error(err))
+		return nil, errInvalidToken
+	}
+	if claims.Subject == "" {
+		logging.FromContext(ctx).Debug("Rejected JWT without a subject")
+		return nil, errInvalidToken
+	}
+	return &auth.Principal{Subject: "jwt:" + claims.Subject, Name: claims.Subject, Claims: claims, Scopes: claims.Scopes}, nil
+}
+
+// authorize refuses requests whose caller wasn't granted scope with a 403
+// Authenticate attaches a caller to every routed request, one without is refused as well.
+func authorize(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal := auth.FromContext(r.Context()); principal == nil || !principal.Allows(scope) {
+			writeProblem(w, r, http.StatusForbidden, fmt.Sprintf("This request requires the %s scope", scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// FlushKeyUsage stores when each key was last used since the previous flush
+// Requests only record their key in memory, so last_used_at costs one write per flush rather than
+// one per request. Uses that fail to be stored are kept for the next flush.
+func FlushKeyUsage(ctx context.Context) error {
+	used := keyUsage.Take()
+	if err := newAPIKeyStore().TouchLastUsed(ctx, used); err != nil {
+		for id, t := range used {
+			keyUsage.Record(id, t)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/auth"
+	"frame/config"
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryKeys holds active API keys by prefix and records the usage flushed to it
+type memoryKeys struct {
+	keys    map[string]*models.APIKey
+	err     error
+	touched map[uuid.UUID]time.Time
+}
+
+func (m *memoryKeys) GetActiveByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	key, ok := m.keys[prefix]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *memoryKeys) TouchLastUsed(ctx context.Context, used map[uuid.UUID]time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.touched = used
+	return nil
+}
+
+// newAdminMux registers every route on a mux serving requests as a caller granted the admin scope
+func newAdminMux() http.Handler {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux)
+	admin := &auth.Principal{Subject: "test", Scopes: []string{auth.ScopeAdmin}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), admin)))
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux)
+
+	serve := func(method, path string, scopes ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if scopes != nil {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: "test", Scopes: scopes}))
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Handlers reject the invalid ID before using the database, so a 400 means the request was let through
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		scopes []string
+		status int
+	}{
+		{name: "granted", method: http.MethodGet, path: "/users/not-a-uuid", scopes: []string{auth.ScopeUsersRead}, status: http.StatusBadRequest},
+		{name: "read scope can't write", method: http.MethodDelete, path: "/users/not-a-uuid", scopes: []string{auth.ScopeUsersRead}, status: http.StatusForbidden},
+		{name: "other resource", method: http.MethodGet, path: "/exercises/not-a-uuid", scopes: []string{auth.ScopeUsersRead, auth.ScopeUsersWrite}, status: http.StatusForbidden},
+		{name: "admin grants every scope", method: http.MethodDelete, path: "/users/not-a-uuid", scopes: []string{auth.ScopeAdmin}, status: http.StatusBadRequest},
+		{name: "admin route", method: http.MethodPost, path: "/admin/outbox/not-a-uuid:replay", scopes: []string{auth.ScopeUsersWrite}, status: http.StatusForbidden},
+		{name: "custom method", method: http.MethodPost, path: "/users/not-a-uuid:restore", scopes: []string{auth.ScopeUsersWrite}, status: http.StatusBadRequest},
+		{name: "no caller", method: http.MethodGet, path: "/users/not-a-uuid", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.method, tt.path, tt.scopes...)
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.status == http.StatusForbidden {
+				assert.Equal(t, problemContentType, rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), "scope")
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	viper.Set("config", &config.Config{})
+	require.NoError(t, logging.Initialize())
+
+	key, prefix, hash, err := auth.NewKey()
+	require.NoError(t, err)
+	keyID := uuid.New()
+	keys := &memoryKeys{keys: map[string]*models.APIKey{prefix: {ID: keyID, Name: "ci", Prefix: prefix, Hash: hash,
+		Scopes: []string{auth.ScopeUsersRead}}}}
+	restore := newAPIKeyStore
+	newAPIKeyStore = func() apiKeyStore { return keys }
+	defer func() { newAPIKeyStore = restore }()
+	keyUsage.Take()
+
+	var principal *auth.Principal
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = auth.FromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(path, authorization string) *httptest.ResponseRecorder {
+		principal = nil
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set(authorizationHeader, authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("valid key", func(t *testing.T) {
+		rr := serve("/users", "Bearer "+key)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		require.NotNil(t, principal)
+		assert.Equal(t, "api_key:"+prefix, principal.Subject)
+		assert.Equal(t, "ci", principal.Name)
+		assert.Equal(t, keyID, principal.KeyID)
+		assert.Equal(t, []string{auth.ScopeUsersRead}, principal.Scopes)
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		other, otherPrefix, _, err := auth.NewKey()
+		require.NoError(t, err)
+		// Same prefix as the stored key but a different secret
+		forged := "frk_" + prefix + other[len("frk_")+len(otherPrefix):]
+
+		for name, authorization := range map[string]string{
+			"missing":      "",
+			"wrong scheme": "Basic " + key,
+			"malformed":    "Bearer not-a-key",
+			"unknown":      "Bearer " + other,
+			"wrong secret": "Bearer " + forged,
+		} {
+			rr := serve("/users", authorization)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code, name)
+			assert.Equal(t, `Bearer realm="frame"`, rr.Header().Get("WWW-Authenticate"), name)
+			assert.Nil(t, principal, name)
+		}
+	})
+
+	t.Run("public paths", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve("/openapi.json", "").Code)
+		assert.Equal(t, http.StatusNoContent, serve("/docs", "").Code)
+		assert.Equal(t, http.StatusNoContent, serve("/healthz", "").Code)
+		assert.Equal(t, http.StatusNoContent, serve("/readyz", "").Code)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		keys.err = errors.New("connection refused")
+		defer func() { keys.err = nil }()
+		assert.Equal(t, http.StatusInternalServerError, serve("/users", "Bearer "+key).Code)
+	})
+
+	t.Run("jwt", func(t *testing.T) {
+		verifier, err := auth.NewVerifier(config.JWTConfig{
+			Issuer:   "https://issuer.example.com",
+			Audience: "frame",
+			Keys:     []config.JWTKey{{Algorithm: auth.HS256, Secret: "shared-secret"}},
+		})
+		require.NoError(t, err)
+		restore := newTokenVerifier
+		newTokenVerifier = func() *auth.Verifier { return verifier }
+		defer func() { newTokenVerifier = restore }()
+
+		sign := func(claims string, secret string) string {
+			signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+				base64.RawURLEncoding.EncodeToString([]byte(claims))
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(signed))
+			return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+		}
+		exp := time.Now().Add(time.Hour).Unix()
+		claims := fmt.Sprintf(`{"iss":"https://issuer.example.com","aud":"frame","sub":"billing","exp":%d,"scope":"users:read"}`, exp)
+
+		var claimsSeen *auth.Claims
+		handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal = auth.FromContext(r.Context())
+			claimsSeen = auth.ClaimsFromContext(r.Context())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		serveToken := func(token string) *httptest.ResponseRecorder {
+			principal, claimsSeen = nil, nil
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set(authorizationHeader, "Bearer "+token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := serveToken(sign(claims, "shared-secret"))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		require.NotNil(t, principal)
+		assert.Equal(t, "jwt:billing", principal.Subject)
+		assert.Equal(t, []string{auth.ScopeUsersRead}, principal.Scopes)
+		require.NotNil(t, claimsSeen)
+		assert.Equal(t, "users:read", claimsSeen.All["scope"])
+
+		// API keys keep working next to tokens
+		assert.Equal(t, http.StatusNoContent, serveToken(key).Code)
+		assert.Nil(t, claimsSeen)
+
+		for name, token := range map[string]string{
+			"wrong secret": sign(claims, "other-secret"),
+			"wrong issuer": sign(strings.Replace(claims, "issuer.example.com", "evil.example.com", 1), "shared-secret"),
+			"no subject":   sign(strings.Replace(claims, `"sub":"billing",`, "", 1), "shared-secret"),
+		} {
+			rr := serveToken(token)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code, name)
+			assert.Equal(t, `Bearer realm="frame"`, rr.Header().Get("WWW-Authenticate"), name)
+			assert.Nil(t, principal, name)
+		}
+	})
+
+	t.Run("usage is flushed in one write", func(t *testing.T) {
+		keys.err = errors.New("connection refused")
+		assert.Error(t, FlushKeyUsage(context.Background()))
+
+		// The failed flush kept the usage for the next one
+		keys.err = nil
+		require.NoError(t, FlushKeyUsage(context.Background()))
+		assert.Contains(t, keys.touched, keyID)
+
+		require.NoError(t, FlushKeyUsage(context.Background()))
+		assert.Empty(t, keys.touched)
+	})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"frame/db"
+)
+
+const (
+	ifMatchHeader     = "If-Match"
+	ifNoneMatchHeader = "If-None-Match"
+)
+
+// etag returns the strong entity tag of a record version, such as "3"
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatchVersions reads the record versions the client expects from the If-Match header
+// The header may list several tags, or be * to change whichever version exists. It writes
+// 428 Precondition Required when the header is missing and 412 Precondition Failed when it
+// can't match any version, and returns false in both cases
+func ifMatchVersions(w http.ResponseWriter, r *http.Request) (db.Versions, bool) {
+	header := r.Header.Get(ifMatchHeader)
+	if header == "" {
+		writeProblem(w, r, http.StatusPreconditionRequired,
+			"The If-Match header is required, send the ETag of the last response for this resource")
+		return db.Versions{}, false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return db.Versions{Any: true}, true
+	}
+
+	var versions db.Versions
+	for candidate := range strings.SplitSeq(header, ",") {
+		// Weak tags never match under the strong comparison If-Match uses
+		unquoted, err := strconv.Unquote(strings.TrimSpace(candidate))
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(unquoted); err == nil {
+			versions.List = append(versions.List, version)
+		}
+	}
+	if len(versions.List) == 0 {
+		writeProblem(w, r, http.StatusPreconditionFailed, "If-Match "+header+" does not match the current version")
+		return db.Versions{}, false
+	}
+
+	return versions, true
+}
+
+// notModified reports whether the If-None-Match header matches tag
+// Tags are compared weakly, and * matches any tag
+func notModified(r *http.Request, tag string) bool {
+	header := r.Header.Get(ifNoneMatchHeader)
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
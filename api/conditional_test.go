@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frame/db"
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfMatchVersions(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	tests := []struct {
+		name         string
+		header       string
+		wantOK       bool
+		wantVersions db.Versions
+		wantStatus   int
+	}{
+		{name: "matching tag", header: `"3"`, wantOK: true, wantVersions: db.Versions{List: []int{3}}},
+		{name: "any version", header: ` * `, wantOK: true, wantVersions: db.Versions{Any: true}},
+		{name: "list", header: `"3", W/"4", "5"`, wantOK: true, wantVersions: db.Versions{List: []int{3, 5}}},
+		{name: "list of weak tags", header: `W/"3", W/"4"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "missing", header: "", wantStatus: http.StatusPreconditionRequired},
+		{name: "weak tag", header: `W/"3"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "unquoted", header: `3`, wantStatus: http.StatusPreconditionFailed},
+		{name: "not a version", header: `"abc"`, wantStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/users/42", nil)
+			if tt.header != "" {
+				req.Header.Set(ifMatchHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			versions, ok := ifMatchVersions(rr, req)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantVersions, versions)
+				return
+			}
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			decodeProblem(t, rr)
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "no header", header: "", want: false},
+		{name: "same tag", header: `"3"`, want: true},
+		{name: "weak tag", header: `W/"3"`, want: true},
+		{name: "other tag", header: `"2"`, want: false},
+		{name: "list", header: `"1", "3"`, want: true},
+		{name: "wildcard", header: `*`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+			if tt.header != "" {
+				req.Header.Set(ifNoneMatchHeader, tt.header)
+			}
+			assert.Equal(t, tt.want, notModified(req, etag(3)))
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"frame/config"
+	"frame/events"
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	eventStreamContentType = "text/event-stream"
+	lastEventIDHeader      = "Last-Event-ID"
+)
+
+// resetEvent tells a resuming client that events were missed and it should reload what it shows
+const resetEvent = "reset"
+
+// newEventFeed returns the broker streamed by EventsHandler, replaced in tests
+var newEventFeed = func() *events.Broker {
+	return events.GetBroker()
+}
+
+// EventsHandler streams user events as Server-Sent Events
+// Each event has the ID of the outbox event, its type such as user.created, and the webhook payload
+// as data. A client reconnecting with Last-Event-ID first receives the events it missed; when those
+// are no longer buffered it receives a reset event instead. Clients that fall too far behind are
+// disconnected and can resume the same way.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	broker := newEventFeed()
+	if broker == nil {
+		writeProblem(w, r, http.StatusServiceUnavailable, "The event feed isn't running")
+		return
+	}
+
+	sub, replay, resumed := broker.Subscribe(r.Header.Get(lastEventIDHeader))
+	defer broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", eventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask reverse proxies such as nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(e events.Event) error {
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if !resumed {
+		if err := send(events.Event{Type: resetEvent, Data: []byte("{}")}); err != nil {
+			return
+		}
+	}
+	for _, e := range replay {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(viper.Get("config").(*config.Config).Events.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events:
+			if !ok {
+				// The broker dropped the client for falling behind, or the server is shutting down
+				logging.FromContext(r.Context()).Info("Closed event stream",
+					zap.String("remote_addr", r.RemoteAddr))
+				return
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/config"
+	"frame/events"
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent reads the next event of a stream as its "field: value" lines, skipping comments
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, ":"):
+		case line == "" && len(lines) > 0:
+			return lines
+		case line != "":
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	viper.Set("config", &config.Config{Events: config.EventsConfig{Heartbeat: 10 * time.Millisecond}})
+	require.NoError(t, logging.Initialize())
+
+	broker := events.NewBroker(10, 10)
+	restore := newEventFeed
+	newEventFeed = func() *events.Broker { return broker }
+	defer func() { newEventFeed = restore }()
+
+	mux := newAdminMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	stream := func(t *testing.T, lastEventID string) *bufio.Reader {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set(lastEventIDHeader, lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, eventStreamContentType, resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body)
+	}
+
+	publish := func(n int) {
+		broker.Publish(events.Event{ID: fmt.Sprint(n), Type: "user.created", Data: []byte(fmt.Sprintf(`{"n":%d}`, n))})
+	}
+
+	t.Run("live events", func(t *testing.T) {
+		r := stream(t, "")
+		// The subscription exists once the headers are sent
+		publish(1)
+		assert.Equal(t, []string{"id: 1", "event: user.created", `data: {"n":1}`}, readEvent(t, r))
+	})
+
+	t.Run("resume after last event", func(t *testing.T) {
+		publish(2)
+		publish(3)
+		r := stream(t, "1")
+		assert.Equal(t, "id: 2", readEvent(t, r)[0])
+		assert.Equal(t, "id: 3", readEvent(t, r)[0])
+	})
+
+	t.Run("reset when the last event is no longer buffered", func(t *testing.T) {
+		r := stream(t, "unknown")
+		assert.Equal(t, []string{"id: ", "event: reset", "data: {}"}, readEvent(t, r))
+		publish(4)
+		assert.Equal(t, "id: 4", readEvent(t, r)[0])
+	})
+
+	t.Run("feed not running", func(t *testing.T) {
+		newEventFeed = func() *events.Broker { return nil }
+		defer func() { newEventFeed = func() *events.Broker { return broker } }()
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/events", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"go.uber.org/zap"
+)
+
+// Limits on the number of exercises returned by a prefix search
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// ExerciseRequest holds the name of an exercise sent by clients
+type ExerciseRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// ExerciseResponse is the representation of an exercise returned to clients
+type ExerciseResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExerciseListResponse wraps a list of exercises
+type ExerciseListResponse struct {
+	Exercises []ExerciseResponse `json:"exercises"`
+}
+
+// ToExerciseResponse creates a response struct from an exercise model
+func ToExerciseResponse(e *models.Exercise) ExerciseResponse {
+	return ExerciseResponse{
+		ID:        e.ID.String(),
+		Name:      e.Name,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+// normalize collapses whitespace in the name the same way the catalog stores it
+func (req *ExerciseRequest) normalize() {
+	req.Name = db.NormalizeExerciseName(req.Name)
+}
+
+// ListExercisesHandler returns all exercises, or those matching the prefix query parameter
+func ListExercisesHandler(w http.ResponseWriter, r *http.Request) {
+	exerciseRepo := db.NewExerciseRepository(db.GetPool())
+
+	var exercises []models.Exercise
+	var err error
+	if query := r.URL.Query(); query.Has("prefix") {
+		limit := defaultSearchLimit
+		if raw := query.Get("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > maxSearchLimit {
+				writeValidationProblem(w, r, []FieldError{{
+					Field:   "limit",
+					Message: "limit must be a number between 1 and " + strconv.Itoa(maxSearchLimit),
+				}})
+				return
+			}
+		}
+		exercises, err = exerciseRepo.Search(r.Context(), query.Get("prefix"), limit)
+	} else {
+		exercises, err = exerciseRepo.List(r.Context())
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := ExerciseListResponse{Exercises: make([]ExerciseResponse, 0, len(exercises))}
+	for i := range exercises {
+		resp.Exercises = append(resp.Exercises, ToExerciseResponse(&exercises[i]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateExerciseHandler adds an exercise to the catalog
+func CreateExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req ExerciseRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	logger.Info("Creating new exercise",
+		zap.String("name", req.Name))
+
+	exerciseRepo := db.NewExerciseRepository(db.GetPool())
+	e, err := exerciseRepo.Create(r.Context(), req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ToExerciseResponse(e))
+}
+
+// GetExerciseHandler returns a single exercise
+func GetExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	exerciseRepo := db.NewExerciseRepository(db.GetPool())
+	e, err := exerciseRepo.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToExerciseResponse(e))
+}
+
+// RenameExerciseHandler changes the name of an exercise
+func RenameExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var req ExerciseRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	logger.Info("Renaming exercise",
+		zap.String("id", id.String()),
+		zap.String("name", req.Name))
+
+	exerciseRepo := db.NewExerciseRepository(db.GetPool())
+	e, err := exerciseRepo.Rename(r.Context(), id, req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToExerciseResponse(e))
+}
+
+// DeleteExerciseHandler removes an exercise from the catalog
+func DeleteExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	logger.Info("Deleting exercise",
+		zap.String("id", id.String()))
+
+	exerciseRepo := db.NewExerciseRepository(db.GetPool())
+	if err := exerciseRepo.Delete(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
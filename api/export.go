@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"frame/db"
+	"frame/export"
+	"frame/logging"
+
+	"go.uber.org/zap"
+)
+
+// newExportSource returns the source used by ExportUsersHandler, replaced in tests
+var newExportSource = func() export.Source {
+	return db.NewUserRepository(db.GetPool())
+}
+
+// parseInclude reads the comma separated include query parameter, which may list addresses and phones
+func parseInclude(r *http.Request) (db.ExportOptions, []FieldError) {
+	var opts db.ExportOptions
+	raw := r.URL.Query().Get("include")
+	if raw == "" {
+		return opts, nil
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(name) {
+		case "addresses":
+			opts.Addresses = true
+		case "phones":
+			opts.Phones = true
+		default:
+			return opts, []FieldError{{Field: "include", Message: "include must list addresses or phones"}}
+		}
+	}
+	return opts, nil
+}
+
+// ExportUsersHandler streams every user matching the list filters in the requested format
+// The format query parameter is csv, ndjson or json and defaults to ndjson, and include may ask for
+// the addresses and phones of each user. Rows are written as they are read from the database.
+func ExportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	query := r.URL.Query()
+
+	filter, errs := parseUserFilter(r)
+	opts, includeErrs := parseInclude(r)
+	errs = append(errs, includeErrs...)
+
+	format := export.NDJSON
+	if raw := query.Get("format"); raw != "" {
+		var err error
+		if format, err = export.ParseFormat(raw); err != nil {
+			errs = append(errs, FieldError{Field: "format", Message: "format must be one of: csv, ndjson, json"})
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="users.`+string(format)+`"`)
+
+	// Nothing has been written until the first row arrives, so query errors still get a problem
+	sw := &startedWriter{ResponseWriter: w}
+	count, err := export.Users(r.Context(), newExportSource(), sw, format, filter, query.Get("sort"), opts)
+	if err != nil && !sw.started {
+		w.Header().Del("Content-Disposition")
+		if errs := pageErrors(err); errs != nil {
+			writeValidationProblem(w, r, errs)
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+	if err != nil {
+		// The status has been sent, abort the response so the client can't mistake it for a complete file
+		logger.Error("Export failed after streaming started",
+			zap.Int("users", count),
+			zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+
+	logger.Info("Exported users",
+		zap.String("format", string(format)),
+		zap.Int("users", count))
+}
+
+// startedWriter records whether any part of the response body has been written
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (sw *startedWriter) Write(b []byte) (int, error) {
+	sw.started = true
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sw *startedWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
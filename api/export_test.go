@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/db"
+	"frame/export"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryExportSource exports a fixed list of users and records the filter it was given
+type memoryExportSource struct {
+	users  []db.ExportedUser
+	filter db.UserFilter
+	opts   db.ExportOptions
+	err    error
+}
+
+func (m *memoryExportSource) Export(ctx context.Context, filter db.UserFilter, sort string, opts db.ExportOptions, fn func(*db.ExportedUser) error) error {
+	m.filter, m.opts = filter, opts
+	if m.err != nil {
+		return m.err
+	}
+	for i := range m.users {
+		if err := fn(&m.users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportUsersHandler(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	now := time.Now().UTC()
+	source := &memoryExportSource{}
+	restore := newExportSource
+	newExportSource = func() export.Source { return source }
+	defer func() { newExportSource = restore }()
+
+	mux := newAdminMux()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	t.Run("ndjson by default", func(t *testing.T) {
+		source.users = []db.ExportedUser{
+			{User: models.User{ID: uuid.New(), FirstName: "Jane", LastName: "Doe", CreatedAt: now, UpdatedAt: now}},
+			{User: models.User{ID: uuid.New(), FirstName: "John", LastName: "Doe", CreatedAt: now, UpdatedAt: now}},
+		}
+		rr := get("/users:export?name_prefix=d&include=phones")
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="users.ndjson"`, rr.Header().Get("Content-Disposition"))
+		assert.Len(t, strings.Split(strings.TrimSpace(rr.Body.String()), "\n"), 2)
+		assert.Equal(t, "d", source.filter.NamePrefix)
+		assert.Equal(t, db.ExportOptions{Phones: true}, source.opts)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		source.users = nil
+		rr := get("/users:export?format=csv")
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "id,first_name,last_name,email,created_at,updated_at,deleted_at\n", rr.Body.String())
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		rr := get("/users:export?format=xml&include=orders")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"field":"format"`)
+		assert.Contains(t, rr.Body.String(), `"field":"include"`)
+	})
+
+	t.Run("error before streaming", func(t *testing.T) {
+		source.err = db.ErrInvalidSort
+		defer func() { source.err = nil }()
+		rr := get("/users:export?sort=email")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, problemContentType, rr.Header().Get("Content-Type"))
+		assert.Empty(t, rr.Header().Get("Content-Disposition"))
+	})
+}
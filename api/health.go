@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"frame/health"
+	"frame/logging"
+
+	"go.uber.org/zap"
+)
+
+// readinessTimeout bounds how long /readyz waits for its checks
+const readinessTimeout = 2 * time.Second
+
+// newHealthRegistry returns the readiness checks run by ReadyHandler, replaced in tests
+var newHealthRegistry = func() *health.Registry {
+	return health.GetRegistry()
+}
+
+// HealthResponse is the body of /healthz
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// HealthHandler reports that the process is alive and serving requests
+// It checks no dependency, so an unreachable database doesn't get the process restarted.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, HealthResponse{Status: health.StatusOK})
+}
+
+// ReadyHandler reports whether the server can serve requests, by running every readiness check
+// It answers 503 when a check fails, such as while the database is unreachable or the server is
+// shutting down, so load balancers stop sending requests. The body lists every check either way.
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	report := newHealthRegistry().Run(ctx)
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+		logging.FromContext(r.Context()).Warn("Not ready",
+			zap.Any("checks", report.Checks))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, report)
+}
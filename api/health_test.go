@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frame/health"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HealthHandler(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestReadyHandler(t *testing.T) {
+	registry := health.NewRegistry()
+	restore := newHealthRegistry
+	newHealthRegistry = func() *health.Registry { return registry }
+	defer func() { newHealthRegistry = restore }()
+
+	var serverErr error
+	registry.Register("server", func(context.Context) error { return serverErr })
+	registry.Register("database", func(context.Context) error { return nil })
+
+	ready := func() (int, health.Report) {
+		rr := httptest.NewRecorder()
+		ReadyHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		var report health.Report
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		return rr.Code, report
+	}
+
+	status, report := ready()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusOK, report.Status)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, "database", report.Checks[0].Name)
+
+	serverErr = errors.New("shutting down")
+	status, report = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusFailing, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks[0].Status)
+	assert.Equal(t, health.Result{Name: "server", Status: health.StatusFailing, LatencyMS: report.Checks[1].LatencyMS, Error: "shutting down"}, report.Checks[1])
+}
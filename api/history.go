@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"frame/db"
+	"frame/models"
+
+	"github.com/google/uuid"
+)
+
+// HistoryEntryResponse is one change in the history of a user
+// Before and after hold only the fields that changed
+type HistoryEntryResponse struct {
+	ID        string         `json:"id"`
+	Actor     string         `json:"actor,omitempty"`
+	Action    string         `json:"action"`
+	Entity    string         `json:"entity"`
+	EntityID  string         `json:"entity_id"`
+	Before    map[string]any `json:"before,omitempty"`
+	After     map[string]any `json:"after,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// HistoryResponse wraps one page of the history of a user
+type HistoryResponse struct {
+	Entries    []HistoryEntryResponse `json:"entries"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// ToHistoryEntryResponse converts an audit entry to its response form
+func ToHistoryEntryResponse(e *models.AuditEntry) HistoryEntryResponse {
+	return HistoryEntryResponse{
+		ID:        e.ID.String(),
+		Actor:     e.Actor,
+		Action:    e.Action,
+		Entity:    e.Entity,
+		EntityID:  e.EntityID.String(),
+		Before:    e.Before,
+		After:     e.After,
+		RequestID: e.RequestID,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// historyStore reads the changes recorded in the audit log
+type historyStore interface {
+	ListByUser(ctx context.Context, userID uuid.UUID, filter db.AuditFilter, page db.PageRequest) ([]models.AuditEntry, string, error)
+}
+
+// newHistoryStore returns the store used by UserHistoryHandler, replaced in tests
+var newHistoryStore = func() historyStore {
+	return db.NewAuditRepository(db.GetPool())
+}
+
+// historyQuery holds the query parameters read by UserHistoryHandler in addition to pageQuery
+var historyQuery = []string{"from", "to"}
+
+// auditContext records the request ID in the context of every write made by the handler
+// The ID is echoed in the X-Request-ID response header so audit entries can be traced to requests
+func auditContext(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := db.WithRequestID(r.Context(), requestID(w, r))
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// UserHistoryHandler returns one page of the changes made to a user, their addresses and phones
+// from and to are RFC 3339 timestamps bounding the entries, from inclusive and to exclusive.
+// Entries are kept after the user is deleted or purged, so the history of those users can still be read.
+func UserHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	page, errs := parsePage(r)
+	query := r.URL.Query()
+
+	var filter db.AuditFilter
+	if raw := query.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "from", Message: "from must be an RFC 3339 timestamp"})
+		}
+		filter.From = from
+	}
+	if raw := query.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "to", Message: "to must be an RFC 3339 timestamp"})
+		}
+		filter.To = to
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		errs = append(errs, FieldError{Field: "to", Message: "to must be after from"})
+	}
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+
+	entries, next, err := newHistoryStore().ListByUser(r.Context(), id, filter, page)
+	if errs := pageErrors(err); errs != nil {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := HistoryResponse{
+		Entries:    make([]HistoryEntryResponse, 0, len(entries)),
+		NextCursor: next,
+	}
+	for i := range entries {
+		resp.Entries = append(resp.Entries, ToHistoryEntryResponse(&entries[i]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
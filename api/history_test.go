@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"frame/config"
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryHistory returns fixed entries and records the filter it was given
+type memoryHistory struct {
+	entries []models.AuditEntry
+	filter  db.AuditFilter
+}
+
+func (m *memoryHistory) ListByUser(ctx context.Context, userID uuid.UUID, filter db.AuditFilter, page db.PageRequest) ([]models.AuditEntry, string, error) {
+	m.filter = filter
+	return m.entries, "", nil
+}
+
+func TestUserHistoryHandler(t *testing.T) {
+	viper.Set("config", &config.Config{Server: config.ServerConfig{DefaultPageSize: 20, MaxPageSize: 100}})
+	require.NoError(t, logging.Initialize())
+
+	userID := uuid.New()
+	history := &memoryHistory{entries: []models.AuditEntry{{
+		ID:        uuid.New(),
+		Action:    db.AuditUpdate,
+		Entity:    "user",
+		EntityID:  userID,
+		Before:    map[string]any{"first_name": "John"},
+		After:     map[string]any{"first_name": "Jane"},
+		RequestID: "req-1",
+		CreatedAt: time.Now().UTC(),
+	}}}
+	restore := newHistoryStore
+	newHistoryStore = func() historyStore { return history }
+	defer func() { newHistoryStore = restore }()
+
+	mux := newAdminMux()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	t.Run("entries in range", func(t *testing.T) {
+		rr := get("/users/" + userID.String() + "/history?from=2026-10-01T00:00:00Z&to=2026-11-01T00:00:00Z")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get(requestIDHeader))
+
+		var resp HistoryResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Entries, 1)
+		assert.Equal(t, "update", resp.Entries[0].Action)
+		assert.Equal(t, "Jane", resp.Entries[0].After["first_name"])
+		assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), history.filter.From)
+		assert.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), history.filter.To)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		rr := get("/users/" + userID.String() + "/history?from=yesterday&to=2026-10-01T00:00:00Z")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"field":"from"`)
+
+		rr = get("/users/" + userID.String() + "/history?from=2026-10-02T00:00:00Z&to=2026-10-01T00:00:00Z")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "to must be after from")
+	})
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"frame/auth"
+	"frame/config"
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	// idempotencyKeyHeader lets clients retry a request without repeating its side effects
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks responses replayed from an earlier request
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds the keys clients may send
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the request bodies read into memory for hashing
+	maxIdempotentBodySize = 1 << 20
+)
+
+// replayedHeaders are the response headers stored with an idempotent response and replayed with it
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyStore persists idempotency keys and their responses
+type idempotencyStore interface {
+	Reserve(ctx context.Context, principal, key, method, path, requestHash string, ttl, lease time.Duration) (*models.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, principal, key, method, path string, statusCode int, headers map[string]string, body []byte) error
+	Release(ctx context.Context, principal, key, method, path string) error
+}
+
+// newIdempotencyStore returns the store used by idempotent, replaced in tests
+var newIdempotencyStore = func() idempotencyStore {
+	return db.NewIdempotencyRepository(db.GetPool())
+}
+
+// idempotent makes next safe to retry when the client sends an Idempotency-Key header
+// The first request with a key runs next and its response is stored for server.idempotency_ttl.
+// next may run for server.idempotency_lease, after which a retry takes the key over, so a request
+// cut off by a crash doesn't block its retries until the TTL has passed.
+// Repeating the key with the same body replays that response, while a different body gets
+// 422 Unprocessable Entity and a repeat made before the first request finished gets 409 Conflict.
+// Keys belong to the caller that sent them, so the same key sent by another caller is a new request.
+// Requests without the header run next unchanged.
+func idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeProblem(w, r, http.StatusBadRequest,
+				fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, "")
+				return
+			}
+			writeProblem(w, r, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := hashOf(string(body))
+
+		cfg := viper.Get("config").(*config.Config)
+		store := newIdempotencyStore()
+		principal := idempotencyPrincipal(r)
+		stored, reserved, err := store.Reserve(r.Context(), principal, key, r.Method, r.URL.Path, hash,
+			cfg.Server.IdempotencyTTL, cfg.Server.IdempotencyLease)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if !reserved {
+			switch {
+			case stored.RequestHash != hash:
+				writeProblem(w, r, http.StatusUnprocessableEntity,
+					fmt.Sprintf("%s %s was already used with a different request body", idempotencyKeyHeader, key))
+			case !stored.Completed():
+				writeProblem(w, r, http.StatusConflict,
+					fmt.Sprintf("A request with %s %s is still being processed", idempotencyKeyHeader, key))
+			default:
+				replay(w, r, stored)
+			}
+			return
+		}
+
+		// Store the outcome even if the client has gone away, so its retry can be answered
+		ctx := context.WithoutCancel(r.Context())
+		rec := &responseCapture{ResponseWriter: w}
+		completed := false
+		defer func() {
+			if !completed {
+				releaseKey(ctx, store, principal, key, r)
+			}
+		}()
+
+		// The request must not outlive its lease, or a retry taking the key over would run alongside it
+		leaseCtx, cancel := context.WithTimeout(r.Context(), cfg.Server.IdempotencyLease)
+		defer cancel()
+		next(rec, r.WithContext(leaseCtx))
+
+		// Server errors are not stored so the request can be retried with the same key
+		if rec.status() >= http.StatusInternalServerError {
+			return
+		}
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := rec.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		err = store.Complete(ctx, principal, key, r.Method, r.URL.Path, rec.status(), headers, rec.body.Bytes())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to store idempotent response",
+				zap.String("key", key),
+				zap.Error(err))
+			return
+		}
+		completed = true
+	}
+}
+
+// hashOf returns the hex encoded SHA-256 of a request body
+func hashOf(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyPrincipal identifies the caller owning the idempotency keys sent with r
+// API keys are identified by their ID, which is unique unlike the prefix in their subject, and
+// tokens by their subject. Routes are authorized before idempotent runs, so there is always a caller.
+func idempotencyPrincipal(r *http.Request) string {
+	p := auth.FromContext(r.Context())
+	switch {
+	case p == nil:
+		return ""
+	case p.KeyID != uuid.Nil:
+		return "api_key:" + p.KeyID.String()
+	default:
+		return p.Subject
+	}
+}
+
+// releaseKey frees a key whose request didn't produce a response worth replaying
+func releaseKey(ctx context.Context, store idempotencyStore, principal, key string, r *http.Request) {
+	if err := store.Release(ctx, principal, key, r.Method, r.URL.Path); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to release idempotency key",
+			zap.String("key", key),
+			zap.Error(err))
+	}
+}
+
+// replay writes the response stored for an earlier request with the same key
+func replay(w http.ResponseWriter, r *http.Request, stored *models.IdempotencyKey) {
+	for name, value := range stored.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	requestID(w, r)
+	w.WriteHeader(stored.StatusCode)
+	if _, err := w.Write(stored.Body); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to replay idempotent response",
+			zap.Error(err))
+	}
+}
+
+// responseCapture passes a response through to the client while keeping a copy of its status and body
+type responseCapture struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	if rc.code == 0 {
+		rc.code = status
+	}
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.code == 0 {
+		rc.code = http.StatusOK
+	}
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
+
+// status returns the status written by the handler, 200 if it wrote nothing
+func (rc *responseCapture) status() int {
+	if rc.code == 0 {
+		return http.StatusOK
+	}
+	return rc.code
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rc *responseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"frame/auth"
+	"frame/config"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIdempotencyStore keeps idempotency keys in memory for tests
+type memoryIdempotencyStore struct {
+	mu     sync.Mutex
+	keys   map[string]*models.IdempotencyKey
+	leases map[string]time.Time
+}
+
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, principal, key, method, path, requestHash string, ttl, lease time.Duration) (*models.IdempotencyKey, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := principal + " " + method + " " + path + " " + key
+	if existing, ok := s.keys[id]; ok && (existing.Completed() || time.Now().Before(s.leases[id])) {
+		copied := *existing
+		return &copied, false, nil
+	}
+	s.keys[id] = &models.IdempotencyKey{Principal: principal, Key: key, Method: method, Path: path, RequestHash: requestHash}
+	s.leases[id] = time.Now().Add(lease)
+	return s.keys[id], true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, principal, key, method, path string, statusCode int, headers map[string]string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := s.keys[principal+" "+method+" "+path+" "+key]
+	k.StatusCode, k.Headers, k.Body = statusCode, headers, body
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, principal, key, method, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := principal + " " + method + " " + path + " " + key
+	if k, ok := s.keys[id]; ok && !k.Completed() {
+		delete(s.keys, id)
+	}
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+	viper.Set("config", &config.Config{Server: config.ServerConfig{IdempotencyTTL: time.Hour, IdempotencyLease: time.Minute}})
+
+	store := &memoryIdempotencyStore{keys: map[string]*models.IdempotencyKey{}, leases: map[string]time.Time{}}
+	restore := newIdempotencyStore
+	newIdempotencyStore = func() idempotencyStore { return store }
+	defer func() { newIdempotencyStore = restore }()
+
+	calls := 0
+	status := http.StatusCreated
+	handler := idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if status >= http.StatusInternalServerError {
+			writeError(w, r, errors.New("boom"))
+			return
+		}
+		w.Header().Set("ETag", etag(calls))
+		w.Header().Set("Location", "/users/1")
+		w.Header().Set("X-Not-Replayed", "true")
+		writeJSON(w, status, map[string]int{"call": calls})
+	})
+
+	keyID := uuid.New()
+	caller := &auth.Principal{Subject: "api_key:abc", KeyID: keyID}
+	sendAs := func(p *auth.Principal, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	send := func(key, body string) *httptest.ResponseRecorder {
+		return sendAs(caller, key, body)
+	}
+
+	t.Run("without key", func(t *testing.T) {
+		calls = 0
+		send("", `{}`)
+		send("", `{}`)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("replay with same body", func(t *testing.T) {
+		calls = 0
+		first := send("k1", `{"fname":"Jane"}`)
+		second := send("k1", `{"fname":"Jane"}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+		assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+		assert.Equal(t, "/users/1", second.Header().Get("Location"))
+		assert.Empty(t, second.Header().Get("X-Not-Replayed"))
+		assert.Equal(t, "true", second.Header().Get(idempotentReplayedHeader))
+		assert.Empty(t, first.Header().Get(idempotentReplayedHeader))
+	})
+
+	t.Run("keys belong to their caller", func(t *testing.T) {
+		calls = 0
+		send("shared", `{"fname":"Jane"}`)
+
+		// Another caller reusing the key neither sees the response nor gets a 422
+		other := sendAs(&auth.Principal{Subject: "jwt:service"}, "shared", `{"fname":"John"}`)
+		assert.Equal(t, http.StatusCreated, other.Code)
+		assert.Empty(t, other.Header().Get(idempotentReplayedHeader))
+		assert.Equal(t, 2, calls)
+
+		// API keys are told apart by ID even when their subjects match
+		sameSubject := sendAs(&auth.Principal{Subject: "api_key:abc", KeyID: uuid.New()}, "shared", `{"fname":"Jane"}`)
+		assert.Empty(t, sameSubject.Header().Get(idempotentReplayedHeader))
+		assert.Equal(t, 3, calls)
+
+		assert.Contains(t, store.keys, "api_key:"+keyID.String()+" POST /users shared")
+		assert.Contains(t, store.keys, "jwt:service POST /users shared")
+	})
+
+	t.Run("same key with different body", func(t *testing.T) {
+		calls = 0
+		send("k2", `{"fname":"Jane"}`)
+		rr := send("k2", `{"fname":"John"}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, "/problems/unprocessable-entity", decodeProblem(t, rr).Type)
+	})
+
+	t.Run("request still in progress", func(t *testing.T) {
+		_, _, err := store.Reserve(context.Background(), "api_key:"+keyID.String(), "k3", http.MethodPost, "/users", hashOf(`{}`), time.Hour, time.Hour)
+		require.NoError(t, err)
+
+		rr := send("k3", `{}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("abandoned request is taken over after its lease", func(t *testing.T) {
+		// The lease of a request that never completed, such as one cut off by a crash, has passed
+		_, _, err := store.Reserve(context.Background(), "api_key:"+keyID.String(), "k5", http.MethodPost, "/users", hashOf(`{}`), time.Hour, -time.Second)
+		require.NoError(t, err)
+
+		calls = 0
+		rr := send("k5", `{}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		calls = 0
+		status = http.StatusInternalServerError
+		rr := send("k4", `{}`)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+		status = http.StatusCreated
+		rr = send("k4", `{}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		rr := send(strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"frame/db"
+	"frame/logging"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	csvContentType    = "text/csv"
+	// importBatchSize is the number of valid rows copied into Postgres at once
+	importBatchSize = 1000
+	// maxImportLineSize bounds a single NDJSON line so a malformed file can't exhaust memory
+	maxImportLineSize = 64 << 10
+)
+
+// Statuses reported for each line of an import
+const (
+	importCreated   = "created"
+	importDuplicate = "duplicate"
+	importInvalid   = "invalid"
+	importFailed    = "failed"
+)
+
+// ImportResult reports what happened to one line of an import file
+// Status is created, duplicate, invalid or failed
+type ImportResult struct {
+	Line   int          `json:"line"`
+	Status string       `json:"status"`
+	ID     string       `json:"id,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// ImportSummary is the last line of an import report
+type ImportSummary struct {
+	Summary ImportCounts `json:"summary"`
+}
+
+// ImportCounts holds the number of lines with each status
+type ImportCounts struct {
+	Created   int `json:"created"`
+	Duplicate int `json:"duplicate"`
+	Invalid   int `json:"invalid"`
+	Failed    int `json:"failed"`
+}
+
+// userImporter stores batches of imported users
+type userImporter interface {
+	Import(ctx context.Context, rows []db.ImportRow) ([]db.ImportResult, error)
+}
+
+// newUserImporter returns the store used by ImportUsersHandler, replaced in tests
+var newUserImporter = func() userImporter {
+	return db.NewUserRepository(db.GetPool())
+}
+
+// importReader reads the users of an import file one line at a time
+// Next returns the line number and the user, or the reasons the line is invalid
+// It returns io.EOF at the end of the file and other errors when the file can't be read further
+type importReader interface {
+	Next() (line int, req UserRequest, errs []FieldError, err error)
+}
+
+// ndjsonReader reads one JSON encoded UserRequest per line, skipping blank lines
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLineSize)
+	return &ndjsonReader{scanner: scanner}
+}
+
+func (nr *ndjsonReader) Next() (int, UserRequest, []FieldError, error) {
+	for nr.scanner.Scan() {
+		nr.line++
+		data := bytes.TrimSpace(nr.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var req UserRequest
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return nr.line, req, []FieldError{{Field: "line", Message: "invalid JSON: " + err.Error()}}, nil
+		}
+		if dec.More() {
+			return nr.line, req, []FieldError{{Field: "line", Message: "line must contain a single JSON object"}}, nil
+		}
+		return nr.line, req, checkRequest(&req), nil
+	}
+
+	if err := nr.scanner.Err(); err != nil {
+		return nr.line + 1, UserRequest{}, nil, err
+	}
+	return nr.line, UserRequest{}, nil, io.EOF
+}
+
+// csvReader reads users from CSV records whose header names the UserRequest fields
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVReader reads the header of a CSV file, which must name the fname, lname and email columns
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"fname", "lname", "email"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header must include the %s column", name)
+		}
+	}
+
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (cr *csvReader) Next() (int, UserRequest, []FieldError, error) {
+	record, err := cr.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Line, UserRequest{}, []FieldError{{Field: "line", Message: parseErr.Err.Error()}}, nil
+	}
+	if err != nil {
+		line, _ := cr.reader.FieldPos(0)
+		return line, UserRequest{}, nil, err
+	}
+
+	line, _ := cr.reader.FieldPos(0)
+	field := func(name string) string {
+		if i := cr.columns[name]; i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	req := UserRequest{Fname: field("fname"), Lname: field("lname"), Email: field("email")}
+	return line, req, checkRequest(&req), nil
+}
+
+// ImportUsersHandler creates users from a newline-delimited JSON or CSV upload
+// The file is read and copied into Postgres in batches while the per-line report is streamed back,
+// so neither is held in memory. The report is NDJSON with one ImportResult per line followed by
+// an ImportSummary. Lines whose email is already in use, or repeated in the file, are duplicates.
+func ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var reader importReader
+	switch mediaType {
+	case ndjsonContentType:
+		reader = newNDJSONReader(r.Body)
+	case csvContentType:
+		cr, err := newCSVReader(r.Body)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		reader = cr
+	default:
+		writeProblem(w, r, http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Content-Type must be %s or %s", ndjsonContentType, csvContentType))
+		return
+	}
+
+	// Report results while the upload is still being read
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.Warn("Failed to enable full duplex for import",
+			zap.Error(err))
+	}
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	imp := &userImport{
+		repo: newUserImporter(),
+		enc:  json.NewEncoder(w),
+		rc:   rc,
+	}
+	imp.run(r, reader)
+
+	logger.Info("Imported users",
+		zap.Int("created", imp.counts.Created),
+		zap.Int("duplicate", imp.counts.Duplicate),
+		zap.Int("invalid", imp.counts.Invalid),
+		zap.Int("failed", imp.counts.Failed))
+
+	if err := imp.enc.Encode(ImportSummary{Summary: imp.counts}); err != nil {
+		logger.Error("Failed to write import summary",
+			zap.Error(err))
+	}
+}
+
+// userImport holds the state of one import while its batches are stored and reported
+type userImport struct {
+	repo   userImporter
+	enc    *json.Encoder
+	rc     *http.ResponseController
+	counts ImportCounts
+
+	// results holds the report lines of the current batch in file order
+	results []ImportResult
+	// rows holds the valid rows of the current batch and pending holds their indexes in results
+	rows    []db.ImportRow
+	pending []int
+}
+
+// run reads every line, storing and reporting a batch whenever it holds importBatchSize lines
+// It stops at the first read or database error, reporting the affected lines as failed
+func (imp *userImport) run(r *http.Request, reader importReader) {
+	for {
+		line, req, errs, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			imp.add(ImportResult{Line: line, Status: importFailed, Errors: []FieldError{{Field: "line", Message: err.Error()}}})
+			break
+		}
+
+		if len(errs) > 0 {
+			imp.add(ImportResult{Line: line, Status: importInvalid, Errors: errs})
+		} else {
+			imp.pending = append(imp.pending, len(imp.results))
+			imp.rows = append(imp.rows, db.ImportRow{Line: line, FirstName: req.Fname, LastName: req.Lname, Email: req.Email})
+			imp.results = append(imp.results, ImportResult{Line: line})
+		}
+
+		if len(imp.results) >= importBatchSize {
+			if !imp.flush(r) {
+				return
+			}
+		}
+	}
+	imp.flush(r)
+}
+
+// add appends a result that doesn't need to be stored to the current batch
+func (imp *userImport) add(result ImportResult) {
+	imp.results = append(imp.results, result)
+}
+
+// flush stores the valid rows of the current batch and writes its report lines
+// Returns false when the batch couldn't be stored
+func (imp *userImport) flush(r *http.Request) bool {
+	ok := true
+	if len(imp.rows) > 0 {
+		stored, err := imp.repo.Import(r.Context(), imp.rows)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to import users",
+				zap.Int("first_line", imp.rows[0].Line),
+				zap.Error(err))
+			ok = false
+		}
+
+		for i, index := range imp.pending {
+			result := &imp.results[index]
+			switch {
+			case err != nil:
+				result.Status = importFailed
+				result.Errors = []FieldError{{Field: "line", Message: "user could not be stored"}}
+			case stored[i].Created:
+				result.Status = importCreated
+				result.ID = stored[i].ID.String()
+			default:
+				result.Status = importDuplicate
+			}
+		}
+	}
+
+	for _, result := range imp.results {
+		imp.count(result.Status)
+		if err := imp.enc.Encode(result); err != nil {
+			// The client has gone away, there's nobody left to report to
+			return false
+		}
+	}
+	if err := imp.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return false
+	}
+
+	imp.results, imp.rows, imp.pending = imp.results[:0], imp.rows[:0], imp.pending[:0]
+	return ok
+}
+
+// count adds a reported line to the summary
+func (imp *userImport) count(status string) {
+	switch status {
+	case importCreated:
+		imp.counts.Created++
+	case importDuplicate:
+		imp.counts.Duplicate++
+	case importInvalid:
+		imp.counts.Invalid++
+	case importFailed:
+		imp.counts.Failed++
+	}
+}
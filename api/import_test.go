@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"frame/db"
+	"frame/logging"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryImporter creates every row whose email it hasn't seen before
+type memoryImporter struct {
+	emails  map[string]bool
+	batches int
+	err     error
+}
+
+func (m *memoryImporter) Import(ctx context.Context, rows []db.ImportRow) ([]db.ImportResult, error) {
+	m.batches++
+	if m.err != nil {
+		return nil, m.err
+	}
+	results := make([]db.ImportResult, len(rows))
+	for i, row := range rows {
+		results[i].Line = row.Line
+		email := strings.ToLower(row.Email)
+		if !m.emails[email] {
+			m.emails[email] = true
+			results[i].Created = true
+			results[i].ID = uuid.New()
+		}
+	}
+	return results, nil
+}
+
+// readReport decodes the report lines and the summary of an import response
+func readReport(t *testing.T, rr *httptest.ResponseRecorder) ([]ImportResult, ImportCounts) {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, ndjsonContentType, rr.Header().Get("Content-Type"))
+
+	var lines []string
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NotEmpty(t, lines)
+
+	var results []ImportResult
+	for _, line := range lines[:len(lines)-1] {
+		var result ImportResult
+		require.NoError(t, json.Unmarshal([]byte(line), &result))
+		results = append(results, result)
+	}
+
+	var summary ImportSummary
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	return results, summary.Summary
+}
+
+func TestImportUsersHandler(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	importer := &memoryImporter{}
+	restore := newUserImporter
+	newUserImporter = func() userImporter { return importer }
+	defer func() { newUserImporter = restore }()
+
+	mux := newAdminMux()
+
+	send := func(contentType, body string) *httptest.ResponseRecorder {
+		importer.emails = map[string]bool{"taken@example.com": true}
+		importer.batches = 0
+		req := httptest.NewRequest(http.MethodPost, "/users:import", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("NDJSON", func(t *testing.T) {
+		body := strings.Join([]string{
+			`{"fname":"Jane","lname":"Doe","email":"jane@example.com"}`,
+			``,
+			`{"fname":"Jane","lname":"Doe","email":"JANE@example.com"}`,
+			`{"fname":"Tom","lname":"Taken","email":"taken@example.com"}`,
+			`{"fname":"","lname":"Doe","email":"nope"}`,
+			`{"fname":`,
+		}, "\n")
+
+		results, counts := readReport(t, send(ndjsonContentType, body))
+
+		require.Len(t, results, 5)
+		assert.Equal(t, 1, results[0].Line)
+		assert.Equal(t, importCreated, results[0].Status)
+		assert.NotEmpty(t, results[0].ID)
+		assert.Equal(t, ImportResult{Line: 3, Status: importDuplicate}, results[1])
+		assert.Equal(t, ImportResult{Line: 4, Status: importDuplicate}, results[2])
+		assert.Equal(t, importInvalid, results[3].Status)
+		assert.Len(t, results[3].Errors, 2)
+		assert.Equal(t, 6, results[4].Line)
+		assert.Equal(t, importInvalid, results[4].Status)
+		assert.Equal(t, ImportCounts{Created: 1, Duplicate: 2, Invalid: 2}, counts)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		body := "email,fname,lname\njane@example.com,Jane,Doe\nbad,Bob,\n"
+
+		results, counts := readReport(t, send(csvContentType+"; charset=utf-8", body))
+
+		require.Len(t, results, 2)
+		assert.Equal(t, 2, results[0].Line)
+		assert.Equal(t, importCreated, results[0].Status)
+		assert.Equal(t, 3, results[1].Line)
+		assert.Equal(t, importInvalid, results[1].Status)
+		assert.Equal(t, ImportCounts{Created: 1, Invalid: 1}, counts)
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		var sb strings.Builder
+		for i := 0; i < importBatchSize+1; i++ {
+			sb.WriteString(`{"fname":"A","lname":"B","email":"user` + uuid.NewString() + `@example.com"}` + "\n")
+		}
+
+		_, counts := readReport(t, send(ndjsonContentType, sb.String()))
+		assert.Equal(t, importBatchSize+1, counts.Created)
+		assert.Equal(t, 2, importer.batches)
+	})
+
+	t.Run("database failure", func(t *testing.T) {
+		importer.err = assert.AnError
+		defer func() { importer.err = nil }()
+
+		results, counts := readReport(t, send(ndjsonContentType, `{"fname":"Jane","lname":"Doe","email":"jane@example.com"}`))
+		require.Len(t, results, 1)
+		assert.Equal(t, importFailed, results[0].Status)
+		assert.Equal(t, ImportCounts{Failed: 1}, counts)
+	})
+
+	t.Run("CSV without required column", func(t *testing.T) {
+		rr := send(csvContentType, "fname,lname\nJane,Doe\n")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, decodeProblem(t, rr).Detail, "email")
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		rr := send("application/json", `{}`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	})
+}
@@ -0,0 +1,387 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"frame/logging"
+	"frame/validation"
+	"frame/version"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the document follows
+const openAPIVersion = "3.1.0"
+
+//go:embed docs/index.html
+var docsPage []byte
+
+// OpenAPI is the root of an OpenAPI 3.1 document
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+	Security   []map[string][]string           `json:"security,omitempty"`
+}
+
+// OpenAPIInfo describes the API
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Operation describes a single method on a path
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security lists the scope the caller must be granted
+	Security []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter describes a path, query or header parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the body an operation accepts
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response an operation may return
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body for one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas and security schemes referenced by operations
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how requests authenticate
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// apiKeyScheme names the bearer API key security scheme of the spec
+const apiKeyScheme = "apiKey"
+
+// Schema is the subset of JSON Schema used to describe request and response types
+// Type is a string, or a list of strings for nullable fields
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// maxKeyLength is maxIdempotencyKeyLength addressable as a schema constraint
+var maxKeyLength int64 = maxIdempotencyKeyLength
+
+// pathParam matches the wildcards of a ServeMux pattern such as {id}
+var pathParam = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// specJSON caches the encoded spec, the routes can't change while the process runs
+var specJSON = sync.OnceValues(func() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(Spec(Routes()))
+	return buf.Bytes(), err
+})
+
+// Spec builds the OpenAPI document describing routes
+// Schemas are derived from the json and validate tags of the request and response types
+func Spec(routes []Route) OpenAPI {
+	doc := OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info:    OpenAPIInfo{Title: "frame", Version: version.Version},
+		Paths:   map[string]map[string]Operation{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				apiKeyScheme: {Type: "http", Scheme: "bearer", Description: "An API key created with frame apikey create, or a JWT when jwt keys are configured"},
+			},
+		},
+		// Every route requires a key, only the spec and its docs page are public
+		Security: []map[string][]string{{apiKeyScheme: {}}},
+	}
+	problem := doc.schemaFor(reflect.TypeOf(Problem{}))
+
+	for _, route := range routes {
+		op := Operation{
+			OperationID: operationID(route),
+			Summary:     route.Summary,
+			Responses:   map[string]Response{},
+			Security:    []map[string][]string{{apiKeyScheme: {route.Scope}}},
+		}
+
+		for _, match := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string", Format: "uuid"},
+			})
+		}
+		for _, name := range route.Query {
+			op.Parameters = append(op.Parameters, Parameter{Name: name, In: "query", Schema: &Schema{Type: "string"}})
+		}
+		for _, header := range route.Headers {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     header.Name,
+				In:       "header",
+				Required: header.Required,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		if route.Idempotent {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:   idempotencyKeyHeader,
+				In:     "header",
+				Schema: &Schema{Type: "string", MaxLength: &maxKeyLength},
+			})
+		}
+
+		if route.Request != nil {
+			consumes := route.Consumes
+			if len(consumes) == 0 {
+				consumes = []string{"application/json"}
+			}
+			op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{}}
+			for _, mediaType := range consumes {
+				op.RequestBody.Content[mediaType] = MediaType{Schema: doc.schemaFor(reflect.TypeOf(route.Request))}
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := Response{Description: http.StatusText(status)}
+		if route.Response != nil {
+			produces := route.Produces
+			if produces == "" {
+				produces = "application/json"
+			}
+			success.Content = map[string]MediaType{produces: {Schema: doc.schemaFor(reflect.TypeOf(route.Response))}}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+		op.Responses["default"] = Response{
+			Description: "Problem",
+			Content:     map[string]MediaType{problemContentType: {Schema: problem}},
+		}
+
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]Operation{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return doc
+}
+
+// wildcardBraces strips the braces of path wildcards so {id}:restore becomes id:restore
+var wildcardBraces = strings.NewReplacer("{", "", "}", "", "...", "")
+
+// operationID names an operation after its method and path, such as get_users_id_addresses
+func operationID(route Route) string {
+	parts := []string{strings.ToLower(route.Method)}
+	for _, segment := range strings.Split(route.Path, "/") {
+		segment = wildcardBraces.Replace(segment)
+		if segment != "" {
+			parts = append(parts, segment)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// schemaFor returns the schema of t, registering structs as components and referencing them
+func (doc *OpenAPI) schemaFor(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(doc.schemaFor(t.Elem()))
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: doc.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			doc.Components.Schemas[name] = nil // reserve the name so recursive types terminate
+			doc.Components.Schemas[name] = doc.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+// structSchema describes the exported fields of a struct using their json and validate tags
+func (doc *OpenAPI) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("json") == "-" {
+			continue
+		}
+		name := validation.JSONName(sf)
+
+		prop := doc.schemaFor(sf.Type)
+		if prop.Ref == "" {
+			if required := applyConstraints(prop, sf.Tag.Get("validate")); required {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = prop
+	}
+
+	sort.Strings(s.Required)
+	return s
+}
+
+// applyConstraints copies validate rules onto the schema and reports whether the field is required
+func applyConstraints(s *Schema, tag string) bool {
+	required := false
+	for _, c := range validation.Parse(tag) {
+		n, _ := strconv.ParseInt(c.Arg, 10, 64)
+		switch c.Rule {
+		case "required":
+			required = true
+		case "min":
+			switch baseType(s) {
+			case "string":
+				s.MinLength = &n
+			case "array":
+				s.MinItems = &n
+			default:
+				s.Minimum = &n
+			}
+		case "max":
+			switch baseType(s) {
+			case "string":
+				s.MaxLength = &n
+			case "array":
+				s.MaxItems = &n
+			default:
+				s.Maximum = &n
+			}
+		case "email":
+			s.Format = "email"
+		case "enum":
+			s.Enum = strings.Split(c.Arg, "|")
+		case "pattern":
+			s.Pattern = c.Arg
+		}
+	}
+	return required
+}
+
+// nullable allows null in addition to the values of s
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return s
+	}
+	if t, ok := s.Type.(string); ok {
+		s.Type = []string{t, "null"}
+	}
+	return s
+}
+
+// baseType returns the type of a schema ignoring null
+func baseType(s *Schema) string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []string:
+		return t[0]
+	}
+	return ""
+}
+
+// OpenAPIHandler serves the OpenAPI document describing every route
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := specJSON()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode OpenAPI spec",
+			zap.Error(err))
+		writeProblem(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(spec); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to write OpenAPI spec",
+			zap.Error(err))
+	}
+}
+
+// DocsHandler serves a static page rendering the OpenAPI document
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(docsPage); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to write docs page",
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"frame/auth"
+	"frame/logging"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+const openAPIGolden = "testdata/openapi.json"
+
+// TestOpenAPISpec fails when the generated spec differs from the published one
+// Run `go test ./api -run TestOpenAPISpec -update` after an intended API change
+func TestOpenAPISpec(t *testing.T) {
+	got, err := specJSON()
+	require.NoError(t, err)
+
+	if *update {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(openAPIGolden, got, 0o644))
+	}
+
+	want, err := os.ReadFile(openAPIGolden)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got), "OpenAPI spec changed, rerun with -update if this is intended")
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	for _, route := range Routes() {
+		t.Run(route.Method+" "+route.Path, func(t *testing.T) {
+			assert.NotEmpty(t, route.Summary)
+			assert.Contains(t, auth.Scopes, route.Scope, "routes must require a known scope")
+			if route.Status != http.StatusNoContent {
+				assert.NotNil(t, route.Response, "routes with a body must declare its type")
+			}
+			// Custom methods such as :restore act on the resource in the path alone
+			writes := route.Method == http.MethodPost || route.Method == http.MethodPut || route.Method == http.MethodPatch
+			if writes && !actionPath.MatchString(route.Path) {
+				assert.NotNil(t, route.Request, "routes reading a body must declare its type")
+			}
+		})
+	}
+}
+
+// TestRequestTypesMatchHandlers sends every documented request field with an empty value
+// A handler decoding a different type rejects the unknown fields before validating them
+func TestRequestTypesMatchHandlers(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	mux := newAdminMux()
+
+	for _, route := range Routes() {
+		if route.Request == nil || len(route.Consumes) > 0 {
+			continue
+		}
+		t.Run(route.Method+" "+route.Path, func(t *testing.T) {
+			path := pathParam.ReplaceAllString(route.Path, uuid.NewString())
+			body, err := json.Marshal(emptyFields(reflect.TypeOf(route.Request)))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(route.Method, path, bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			p := decodeProblem(t, rr)
+			assert.Equal(t, "/problems/validation-error", p.Type, "handler rejected %s: %s", body, p.Detail)
+		})
+	}
+}
+
+// emptyFields returns every JSON field of a struct type set to an empty string
+// Fields that aren't strings are left out
+func emptyFields(t reflect.Type) map[string]any {
+	fields := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.String {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		fields[name] = ""
+	}
+	return fields
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	OpenAPIHandler(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var doc OpenAPI
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&doc))
+	assert.Equal(t, openAPIVersion, doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/users/{id}")
+	assert.Contains(t, doc.Components.Schemas, "UserRequest")
+	assert.Contains(t, doc.Components.Schemas, "UserResponse")
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// OutboxEventResponse is an event published to webhooks along with its delivery state
+type OutboxEventResponse struct {
+	ID            string         `json:"id"`
+	Type          string         `json:"type"`
+	Entity        string         `json:"entity"`
+	EntityID      string         `json:"entity_id"`
+	UserID        string         `json:"user_id,omitempty"`
+	Before        map[string]any `json:"before,omitempty"`
+	After         map[string]any `json:"after,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Status        string         `json:"status"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt *time.Time     `json:"next_attempt_at,omitempty"`
+	DeliveredTo   []string       `json:"delivered_to"`
+	LastError     string         `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time     `json:"delivered_at,omitempty"`
+}
+
+// OutboxListResponse wraps one page of outbox events
+type OutboxListResponse struct {
+	Events     []OutboxEventResponse `json:"events"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// ToOutboxEventResponse converts an outbox event to its response form
+// next_attempt_at is only set while the event is waiting to be delivered
+func ToOutboxEventResponse(e *models.OutboxEvent) OutboxEventResponse {
+	resp := OutboxEventResponse{
+		ID:          e.ID.String(),
+		Type:        e.Type,
+		Entity:      e.Entity,
+		EntityID:    e.EntityID.String(),
+		Before:      e.Before,
+		After:       e.After,
+		CreatedAt:   e.CreatedAt,
+		Status:      e.Status,
+		Attempts:    e.Attempts,
+		DeliveredTo: e.DeliveredTo,
+		LastError:   e.LastError,
+		DeliveredAt: e.DeliveredAt,
+	}
+	if e.UserID != nil {
+		resp.UserID = e.UserID.String()
+	}
+	if e.Status == db.OutboxPending {
+		next := e.NextAttemptAt
+		resp.NextAttemptAt = &next
+	}
+	if resp.DeliveredTo == nil {
+		resp.DeliveredTo = []string{}
+	}
+	return resp
+}
+
+// outboxStore lists and replays the events published to webhooks
+type outboxStore interface {
+	List(ctx context.Context, status string, page db.PageRequest) ([]models.OutboxEvent, string, error)
+	Replay(ctx context.Context, id uuid.UUID) (*models.OutboxEvent, error)
+}
+
+// newOutboxStore returns the store used by the outbox handlers, replaced in tests
+var newOutboxStore = func() outboxStore {
+	return db.NewOutboxRepository(db.GetPool())
+}
+
+// ListOutboxHandler returns one page of outbox events, optionally only those in the status query parameter
+// Listing status=dead shows the events that need to be replayed
+func ListOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePage(r)
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", db.OutboxPending, db.OutboxDelivered, db.OutboxDead:
+	default:
+		errs = append(errs, FieldError{Field: "status", Message: "status must be pending, delivered or dead"})
+	}
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+
+	events, next, err := newOutboxStore().List(r.Context(), status, page)
+	if errs := pageErrors(err); errs != nil {
+		writeValidationProblem(w, r, errs)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := OutboxListResponse{
+		Events:     make([]OutboxEventResponse, 0, len(events)),
+		NextCursor: next,
+	}
+	for i := range events {
+		resp.Events = append(resp.Events, ToOutboxEventResponse(&events[i]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ReplayOutboxEventHandler queues an event to be delivered again to every webhook
+// It's meant for dead lettered events, but delivered events can be replayed too
+func ReplayOutboxEventHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Replaying outbox event",
+		zap.String("id", id.String()))
+
+	event, err := newOutboxStore().Replay(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToOutboxEventResponse(event))
+}
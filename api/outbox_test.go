@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"frame/config"
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOutbox holds outbox events in memory and records the status it was listed with
+type memoryOutbox struct {
+	events map[uuid.UUID]*models.OutboxEvent
+	status string
+}
+
+func (m *memoryOutbox) List(ctx context.Context, status string, page db.PageRequest) ([]models.OutboxEvent, string, error) {
+	m.status = status
+	var events []models.OutboxEvent
+	for _, e := range m.events {
+		if status == "" || e.Status == status {
+			events = append(events, *e)
+		}
+	}
+	return events, "", nil
+}
+
+func (m *memoryOutbox) Replay(ctx context.Context, id uuid.UUID) (*models.OutboxEvent, error) {
+	e, ok := m.events[id]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	e.Status, e.Attempts, e.DeliveredTo, e.LastError = db.OutboxPending, 0, nil, ""
+	e.NextAttemptAt = time.Now().UTC()
+	return e, nil
+}
+
+func TestOutboxHandlers(t *testing.T) {
+	viper.Set("config", &config.Config{Server: config.ServerConfig{DefaultPageSize: 20, MaxPageSize: 100}})
+	require.NoError(t, logging.Initialize())
+
+	dead := &models.OutboxEvent{
+		ID:          uuid.New(),
+		Type:        "user.created",
+		Entity:      "user",
+		EntityID:    uuid.New(),
+		CreatedAt:   time.Now().UTC(),
+		Status:      db.OutboxDead,
+		Attempts:    10,
+		DeliveredTo: []string{"http://a.example"},
+		LastError:   "http://b.example: responded 500 Internal Server Error",
+	}
+	outbox := &memoryOutbox{events: map[uuid.UUID]*models.OutboxEvent{dead.ID: dead}}
+	restore := newOutboxStore
+	newOutboxStore = func() outboxStore { return outbox }
+	defer func() { newOutboxStore = restore }()
+
+	mux := newAdminMux()
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	t.Run("list dead events", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/admin/outbox?status=dead")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, db.OutboxDead, outbox.status)
+
+		var resp OutboxListResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Events, 1)
+		assert.Equal(t, dead.ID.String(), resp.Events[0].ID)
+		assert.Equal(t, 10, resp.Events[0].Attempts)
+		assert.Nil(t, resp.Events[0].NextAttemptAt)
+	})
+
+	t.Run("invalid status", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/admin/outbox?status=lost")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"field":"status"`)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/admin/outbox/"+dead.ID.String()+":replay")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp OutboxEventResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Equal(t, db.OutboxPending, resp.Status)
+		assert.Equal(t, 0, resp.Attempts)
+		assert.Equal(t, []string{}, resp.DeliveredTo)
+		assert.NotNil(t, resp.NextAttemptAt)
+	})
+
+	t.Run("replay unknown event", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/admin/outbox/"+uuid.NewString()+":replay")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"frame/config"
+	"frame/db"
+
+	"github.com/spf13/viper"
+)
+
+// parsePage reads the limit, cursor and sort query parameters of a listing
+// The limit defaults to server.default_page_size and is capped at server.max_page_size
+func parsePage(r *http.Request) (db.PageRequest, []FieldError) {
+	cfg := viper.Get("config").(*config.Config)
+	query := r.URL.Query()
+
+	page := db.PageRequest{
+		Limit:  cfg.Server.DefaultPageSize,
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+	}
+
+	var errs []FieldError
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			errs = append(errs, FieldError{Field: "limit", Message: "limit must be a positive number"})
+		}
+		page.Limit = limit
+	}
+	if page.Limit > cfg.Server.MaxPageSize {
+		page.Limit = cfg.Server.MaxPageSize
+	}
+
+	return page, errs
+}
+
+// pageErrors converts pagination errors from the db package into field errors
+// Returns nil when err isn't caused by the page request
+func pageErrors(err error) []FieldError {
+	switch {
+	case errors.Is(err, db.ErrInvalidCursor):
+		return []FieldError{{Field: "cursor", Message: err.Error()}}
+	case errors.Is(err, db.ErrInvalidSort):
+		return []FieldError{{Field: "sort", Message: err.Error()}}
+	}
+	return nil
+}
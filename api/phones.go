@@ -0,0 +1,215 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"frame/config"
+	"frame/db"
+	"frame/logging"
+	"frame/models"
+	"frame/phone"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// PhoneRequest holds the fields of a phone sent by clients
+type PhoneRequest struct {
+	Name   string `json:"name" validate:"required,max=100"`
+	Number string `json:"number" validate:"required,max=32"`
+}
+
+// PhoneResponse is the representation of a phone returned to clients
+type PhoneResponse struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Number    string    `json:"number"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PhoneListResponse wraps a list of phones
+type PhoneListResponse struct {
+	Phones []PhoneResponse `json:"phones"`
+}
+
+// ToPhoneResponse creates a response struct from a phone model
+func ToPhoneResponse(p *models.Phone) PhoneResponse {
+	return PhoneResponse{
+		ID:        p.ID.String(),
+		UserID:    p.UserID.String(),
+		Name:      p.Name,
+		Number:    p.Number,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// normalize trims surrounding whitespace from all fields
+func (req *PhoneRequest) normalize() {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Number = strings.TrimSpace(req.Number)
+}
+
+// validate checks that the number can be dialed and converts it to E.164
+// Numbers without a country code are interpreted in the configured default region
+func (req *PhoneRequest) validate() []FieldError {
+	if req.Number == "" {
+		return nil // reported by the required rule
+	}
+
+	cfg := viper.Get("config").(*config.Config)
+	number, err := phone.Normalize(req.Number, cfg.Phone.DefaultRegion)
+	if err != nil {
+		return []FieldError{{Field: "number", Message: err.Error()}}
+	}
+
+	req.Number = number
+	return nil
+}
+
+// toModel creates a phone model for the given user from the request
+func (req PhoneRequest) toModel(userID, id uuid.UUID) *models.Phone {
+	return &models.Phone{
+		ID:     id,
+		UserID: userID,
+		Name:   req.Name,
+		Number: req.Number,
+	}
+}
+
+// ListPhonesHandler returns all phones of a user
+func ListPhonesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	phoneRepo := db.NewPhoneRepository(db.GetPool())
+	phones, err := phoneRepo.ListByUser(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := PhoneListResponse{Phones: make([]PhoneResponse, 0, len(phones))}
+	for i := range phones {
+		resp.Phones = append(resp.Phones, ToPhoneResponse(&phones[i]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreatePhoneHandler adds a phone to a user
+func CreatePhoneHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req PhoneRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	logger.Info("Creating new phone",
+		zap.String("user_id", userID.String()),
+		zap.String("name", req.Name))
+
+	phoneRepo := db.NewPhoneRepository(db.GetPool())
+	p, err := phoneRepo.Create(r.Context(), req.toModel(userID, uuid.Nil))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ToPhoneResponse(p))
+}
+
+// GetPhoneHandler returns a single phone of a user
+func GetPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := pathUUID(w, r, "phoneID")
+	if !ok {
+		return
+	}
+
+	phoneRepo := db.NewPhoneRepository(db.GetPool())
+	p, err := phoneRepo.GetByID(r.Context(), userID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToPhoneResponse(p))
+}
+
+// UpdatePhoneHandler replaces the name and number of a phone
+func UpdatePhoneHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, ok := pathUUID(w, r, "phoneID")
+	if !ok {
+		return
+	}
+
+	var req PhoneRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	logger.Info("Updating phone",
+		zap.String("user_id", userID.String()),
+		zap.String("id", id.String()))
+
+	phoneRepo := db.NewPhoneRepository(db.GetPool())
+	p, err := phoneRepo.Update(r.Context(), req.toModel(userID, id))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToPhoneResponse(p))
+}
+
+// DeletePhoneHandler removes a phone of a user
+func DeletePhoneHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := pathUUID(w, r, "phoneID")
+	if !ok {
+		return
+	}
+
+	logger.Info("Deleting phone",
+		zap.String("user_id", userID.String()),
+		zap.String("id", id.String()))
+
+	phoneRepo := db.NewPhoneRepository(db.GetPool())
+	if err := phoneRepo.Delete(r.Context(), userID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"frame/db"
+	"frame/logging"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// problemContentType is the media type of RFC 7807 problem responses
+const problemContentType = "application/problem+json"
+
+// requestIDHeader carries the identifier correlating a request with its logs and problems
+const requestIDHeader = logging.RequestIDHeader
+
+// Problem is an RFC 7807 problem details response body
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// problemType returns the type URI reference for a status, such as "/problems/not-found"
+func problemType(status int) string {
+	return "/problems/" + strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "-"))
+}
+
+// requestID returns the request ID supplied by the client or a proxy, generating one if absent
+// The ID is echoed in the response so clients can quote it when reporting problems
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := w.Header().Get(requestIDHeader)
+	if id == "" {
+		id = r.Header.Get(requestIDHeader)
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
+
+// newProblem creates a problem for the request with the title and type derived from status
+func newProblem(w http.ResponseWriter, r *http.Request, status int, detail string) Problem {
+	return Problem{
+		Type:      problemType(status),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID(w, r),
+	}
+}
+
+// renderProblem writes p as an application/problem+json response
+func renderProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode problem",
+			zap.Error(err))
+	}
+}
+
+// writeProblem responds with a problem of the given status
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	renderProblem(w, r, newProblem(w, r, status, detail))
+}
+
+// writeValidationProblem responds with 400 Bad Request listing every rejected field
+func writeValidationProblem(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	p := newProblem(w, r, http.StatusBadRequest, "One or more fields are invalid")
+	p.Type = "/problems/validation-error"
+	p.Title = "Validation Failed"
+	p.Errors = errs
+	renderProblem(w, r, p)
+}
+
+// errorStatus maps typed errors from the db package to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, db.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, db.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError responds with the problem matching err
+// Server errors are logged and their details are kept out of the response
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("Request failed",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", status),
+			zap.Error(err))
+		writeProblem(w, r, status, "")
+		return
+	}
+	writeProblem(w, r, status, err.Error())
+}
+
+// ProblemHandler wraps mux so requests it can't route get problem responses instead of plain text
+func ProblemHandler(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// Let the mux decide between 404 and 405 and which methods to allow
+		rec := &statusRecorder{header: http.Header{}}
+		h.ServeHTTP(rec, r)
+		if allow := rec.header.Get("Allow"); allow != "" {
+			w.Header().Set("Allow", allow)
+		}
+		writeProblem(w, r, rec.status, "")
+	})
+}
+
+// statusRecorder captures the status and headers written by a handler and discards the body
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (rec *statusRecorder) Header() http.Header { return rec.header }
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frame/db"
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeProblem checks the response is a problem document and decodes it
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	assert.Equal(t, problemContentType, rr.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, rr.Code, p.Status)
+	return p
+}
+
+func TestWriteError(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string
+		wantDetail bool
+	}{
+		{name: "not found", err: fmt.Errorf("user %w: 42", db.ErrNotFound), wantStatus: http.StatusNotFound, wantType: "/problems/not-found", wantDetail: true},
+		{name: "conflict", err: fmt.Errorf("%w: email taken", db.ErrConflict), wantStatus: http.StatusConflict, wantType: "/problems/conflict", wantDetail: true},
+		{name: "precondition failed", err: fmt.Errorf("%w: user 42 is at version 3, not 2", db.ErrPreconditionFailed), wantStatus: http.StatusPreconditionFailed, wantType: "/problems/precondition-failed", wantDetail: true},
+		{name: "timeout", err: fmt.Errorf("error listing users: %w", db.ErrTimeout), wantStatus: http.StatusGatewayTimeout, wantType: "/problems/gateway-timeout"},
+		{name: "unexpected", err: fmt.Errorf("connection reset"), wantStatus: http.StatusInternalServerError, wantType: "/problems/internal-server-error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+			req.Header.Set(requestIDHeader, "req-123")
+			rr := httptest.NewRecorder()
+
+			writeError(rr, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, "req-123", rr.Header().Get(requestIDHeader))
+
+			p := decodeProblem(t, rr)
+			assert.Equal(t, tt.wantType, p.Type)
+			assert.Equal(t, http.StatusText(tt.wantStatus), p.Title)
+			assert.Equal(t, "/users/42", p.Instance)
+			assert.Equal(t, "req-123", p.RequestID)
+			if tt.wantDetail {
+				assert.Equal(t, tt.err.Error(), p.Detail)
+			} else {
+				assert.Empty(t, p.Detail, "server error details must not leak")
+			}
+		})
+	}
+}
+
+func TestWriteValidationProblem(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users", nil)
+	rr := httptest.NewRecorder()
+
+	writeValidationProblem(rr, req, []FieldError{
+		{Field: "email", Message: "email is required"},
+		{Field: "fname", Message: "fname is required"},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get(requestIDHeader), "request ID is generated when absent")
+
+	p := decodeProblem(t, rr)
+	assert.Equal(t, "/problems/validation-error", p.Type)
+	assert.Equal(t, rr.Header().Get(requestIDHeader), p.RequestID)
+	assert.Len(t, p.Errors, 2)
+	assert.Equal(t, "email", p.Errors[0].Field)
+}
+
+func TestProblemHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := ProblemHandler(mux)
+
+	t.Run("matched route", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/things/1", nil))
+		assert.Equal(t, http.StatusTeapot, rr.Code)
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/nothing", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "/problems/not-found", decodeProblem(t, rr).Type)
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/things/1", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+		assert.Contains(t, rr.Header().Get("Allow"), http.MethodGet)
+		assert.Equal(t, "/problems/method-not-allowed", decodeProblem(t, rr).Type)
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frame/auth"
+	"frame/ratelimit"
+)
+
+// newRateLimiter returns the limiter checked by rateLimit, nil when requests aren't limited,
+// replaced in tests
+var newRateLimiter = func() *ratelimit.Limiter {
+	return ratelimit.GetLimiter()
+}
+
+// RateLimitIP refuses requests over the limit of their client address with a 429, before they are
+// authenticated, so floods with missing or invalid credentials don't reach the API key lookup.
+// publicPaths aren't limited, as load balancers probe them often from a few addresses.
+// The limits of authenticated callers are applied per route by rateLimit.
+func RateLimitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := newRateLimiter()
+		if limiter == nil || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if d := limiter.AllowIP(clientIP(r)); !d.Allowed {
+			writeRateLimited(w, r, d)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit refuses requests over the limit of their client with a 429
+// Every response tells the client its limit in RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and refused ones when to retry in Retry-After.
+// Clients are told apart by RemoteAddr, so a reverse proxy in front of the server shares one IP limit.
+func rateLimit(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := newRateLimiter()
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+
+		var caller string
+		if principal := auth.FromContext(r.Context()); principal != nil {
+			caller = principal.Subject
+		}
+
+		d := limiter.Allow(route, caller, clientIP(r))
+		if !d.Allowed {
+			writeRateLimited(w, r, d)
+			return
+		}
+		setRateLimitHeaders(w, d)
+		next(w, r)
+	}
+}
+
+// clientIP returns the address r was sent from, without its port
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// setRateLimitHeaders tells the client the limit d was decided by, when rate limiting is enabled
+func setRateLimitHeaders(w http.ResponseWriter, d ratelimit.Decision) {
+	if d.Limit > 0 {
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(wholeSeconds(d.Reset)))
+	}
+}
+
+// writeRateLimited refuses a request over its limit, telling the client when to retry
+func writeRateLimited(w http.ResponseWriter, r *http.Request, d ratelimit.Decision) {
+	setRateLimitHeaders(w, d)
+	retry := max(wholeSeconds(d.RetryAfter), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	writeProblem(w, r, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded, retry in %d seconds", retry))
+}
+
+// wholeSeconds rounds d up to whole seconds, as rate limit headers hold integers
+func wholeSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
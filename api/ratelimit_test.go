@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frame/config"
+	"frame/logging"
+	"frame/ratelimit"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	limiter, err := ratelimit.New(config.RateLimitConfig{
+		Enabled:             true,
+		Key:                 ratelimit.KeyAPIKey,
+		RequestsPerSecond:   0.01,
+		Burst:               2,
+		IPRequestsPerSecond: 0.01,
+		IPBurst:             5,
+	})
+	require.NoError(t, err)
+	restore := newRateLimiter
+	newRateLimiter = func() *ratelimit.Limiter { return limiter }
+	defer func() { newRateLimiter = restore }()
+
+	mux := newAdminMux()
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		// The ID is rejected before the database is used
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/not-a-uuid", nil))
+		return rr
+	}
+
+	rr := get()
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "100", rr.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusBadRequest, get().Code)
+
+	rr = get()
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, problemContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "100", rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), "retry in 100 seconds")
+
+	t.Run("addresses before authentication", func(t *testing.T) {
+		handler := RateLimitIP(Authenticate(mux))
+		unauthenticated := func(path string) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.RemoteAddr = "192.0.2.7:4321"
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		for range 5 {
+			assert.Equal(t, http.StatusUnauthorized, unauthenticated("/users").Code)
+		}
+		rr := unauthenticated("/users")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "5", rr.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "100", rr.Header().Get("Retry-After"))
+
+		// Probes aren't limited
+		assert.Equal(t, http.StatusOK, unauthenticated("/healthz").Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, limiter.Update(config.RateLimitConfig{Key: ratelimit.KeyAPIKey, RequestsPerSecond: 1, Burst: 1,
+			IPRequestsPerSecond: 1, IPBurst: 1}))
+		for range 3 {
+			rr := get()
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+		}
+	})
+}
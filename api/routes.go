@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"frame/auth"
+	"frame/export"
+	"frame/webhook"
+)
+
+// Route describes a single HTTP endpoint served by the API
+// The request, response and query fields document the endpoint in the OpenAPI spec
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	// Scope is the scope a caller must be granted to use the route, see auth.Scopes
+	Scope string
+
+	// Summary is a short description of what the endpoint does
+	Summary string
+	// Request is a value of the JSON body type the handler decodes, nil when it reads no body
+	Request any
+	// Response is a value of the JSON body type written on success, nil when there is no body
+	Response any
+	// Status is the success status code, 200 when zero
+	Status int
+	// Query lists the query parameters the handler reads
+	Query []string
+	// Consumes lists the media types of the request body when it isn't a single JSON document
+	// Each item of such a body is described by Request
+	Consumes []string
+	// Produces is the media type of the response body when it isn't application/json
+	Produces string
+	// Headers lists the request headers the handler reads
+	Headers []Header
+	// Idempotent lets clients retry the request safely with an Idempotency-Key header
+	Idempotent bool
+}
+
+// Header describes a request header read by a handler
+type Header struct {
+	Name     string
+	Required bool
+}
+
+// pageQuery holds the query parameters read by parsePage
+var pageQuery = []string{"limit", "cursor", "sort"}
+
+// Routes returns every route served by the API
+func Routes() []Route {
+	return []Route{
+		{Method: http.MethodPost, Path: "/user", Handler: UserHandler, Scope: auth.ScopeUsersWrite, Summary: "Create a user (deprecated alias of POST /users)",
+			Request: UserRequest{}, Response: UserResponse{}, Idempotent: true},
+		{Method: http.MethodPost, Path: "/users", Handler: UserHandler, Scope: auth.ScopeUsersWrite, Summary: "Create a user, or return the ID of the user with the same email",
+			Request: UserRequest{}, Response: UserResponse{}, Idempotent: true},
+		{Method: http.MethodGet, Path: "/users", Handler: ListUsersHandler, Scope: auth.ScopeUsersRead, Summary: "List users",
+			Response: UserListResponse{}, Query: append(append([]string{}, userFilterQuery...), pageQuery...)},
+		{Method: http.MethodGet, Path: "/users:export", Handler: ExportUsersHandler, Scope: auth.ScopeUsersRead, Summary: "Stream every user matching the filters as CSV, NDJSON or JSON",
+			Response: export.User{}, Produces: "application/x-ndjson",
+			Query: append([]string{"format", "include", "sort"}, userFilterQuery...)},
+		{Method: http.MethodPost, Path: "/users:import", Handler: ImportUsersHandler, Scope: auth.ScopeUsersWrite, Summary: "Create users from an NDJSON or CSV upload and stream a per-line report",
+			Request: UserRequest{}, Response: ImportResult{}, Consumes: []string{ndjsonContentType, csvContentType}, Produces: ndjsonContentType},
+		{Method: http.MethodGet, Path: "/users/{id}", Handler: GetUserHandler, Scope: auth.ScopeUsersRead, Summary: "Get a user",
+			Response: UserResponse{}, Headers: []Header{{Name: ifNoneMatchHeader}}},
+		{Method: http.MethodPut, Path: "/users/{id}", Handler: UpdateUserHandler, Scope: auth.ScopeUsersWrite, Summary: "Replace a user",
+			Request: UserRequest{}, Response: UserResponse{}, Headers: []Header{{Name: ifMatchHeader, Required: true}}},
+		{Method: http.MethodPatch, Path: "/users/{id}", Handler: PatchUserHandler, Scope: auth.ScopeUsersWrite, Summary: "Update some fields of a user",
+			Request: UserPatchRequest{}, Response: UserResponse{}, Headers: []Header{{Name: ifMatchHeader, Required: true}}},
+		{Method: http.MethodDelete, Path: "/users/{id}", Handler: DeleteUserHandler, Scope: auth.ScopeUsersWrite, Summary: "Delete a user",
+			Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/users/{id}:restore", Handler: RestoreUserHandler, Scope: auth.ScopeUsersWrite, Summary: "Restore a deleted user",
+			Response: UserResponse{}},
+		{Method: http.MethodGet, Path: "/users/{id}/history", Handler: UserHistoryHandler, Scope: auth.ScopeUsersRead, Summary: "List the changes made to a user, their addresses and phones",
+			Response: HistoryResponse{}, Query: append(append([]string{}, historyQuery...), pageQuery...)},
+		{Method: http.MethodGet, Path: "/users/{id}/addresses", Handler: ListAddressesHandler, Scope: auth.ScopeUsersRead, Summary: "List the addresses of a user",
+			Response: AddressListResponse{}},
+		{Method: http.MethodPost, Path: "/users/{id}/addresses", Handler: CreateAddressHandler, Scope: auth.ScopeUsersWrite, Summary: "Add an address to a user",
+			Request: AddressRequest{}, Response: AddressResponse{}, Status: http.StatusCreated, Idempotent: true},
+		{Method: http.MethodGet, Path: "/users/{id}/addresses/{addressID}", Handler: GetAddressHandler, Scope: auth.ScopeUsersRead, Summary: "Get an address",
+			Response: AddressResponse{}},
+		{Method: http.MethodPut, Path: "/users/{id}/addresses/{addressID}", Handler: UpdateAddressHandler, Scope: auth.ScopeUsersWrite, Summary: "Replace an address",
+			Request: AddressRequest{}, Response: AddressResponse{}},
+		{Method: http.MethodDelete, Path: "/users/{id}/addresses/{addressID}", Handler: DeleteAddressHandler, Scope: auth.ScopeUsersWrite, Summary: "Delete an address",
+			Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/users/{id}/phones", Handler: ListPhonesHandler, Scope: auth.ScopeUsersRead, Summary: "List the phone numbers of a user",
+			Response: PhoneListResponse{}},
+		{Method: http.MethodPost, Path: "/users/{id}/phones", Handler: CreatePhoneHandler, Scope: auth.ScopeUsersWrite, Summary: "Add a phone number to a user",
+			Request: PhoneRequest{}, Response: PhoneResponse{}, Status: http.StatusCreated, Idempotent: true},
+		{Method: http.MethodGet, Path: "/users/{id}/phones/{phoneID}", Handler: GetPhoneHandler, Scope: auth.ScopeUsersRead, Summary: "Get a phone number",
+			Response: PhoneResponse{}},
+		{Method: http.MethodPut, Path: "/users/{id}/phones/{phoneID}", Handler: UpdatePhoneHandler, Scope: auth.ScopeUsersWrite, Summary: "Replace a phone number",
+			Request: PhoneRequest{}, Response: PhoneResponse{}},
+		{Method: http.MethodDelete, Path: "/users/{id}/phones/{phoneID}", Handler: DeletePhoneHandler, Scope: auth.ScopeUsersWrite, Summary: "Delete a phone number",
+			Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/exercises", Handler: ListExercisesHandler, Scope: auth.ScopeExercisesRead, Summary: "List the exercise catalog or search it by name prefix",
+			Response: ExerciseListResponse{}, Query: []string{"prefix", "limit"}},
+		{Method: http.MethodPost, Path: "/exercises", Handler: CreateExerciseHandler, Scope: auth.ScopeExercisesWrite, Summary: "Add an exercise to the catalog",
+			Request: ExerciseRequest{}, Response: ExerciseResponse{}, Status: http.StatusCreated, Idempotent: true},
+		{Method: http.MethodGet, Path: "/exercises/{id}", Handler: GetExerciseHandler, Scope: auth.ScopeExercisesRead, Summary: "Get an exercise",
+			Response: ExerciseResponse{}},
+		{Method: http.MethodPut, Path: "/exercises/{id}", Handler: RenameExerciseHandler, Scope: auth.ScopeExercisesWrite, Summary: "Rename an exercise",
+			Request: ExerciseRequest{}, Response: ExerciseResponse{}},
+		{Method: http.MethodDelete, Path: "/exercises/{id}", Handler: DeleteExerciseHandler, Scope: auth.ScopeExercisesWrite, Summary: "Delete an exercise",
+			Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/events", Handler: EventsHandler, Scope: auth.ScopeUsersRead, Summary: "Stream the changes made to users as Server-Sent Events",
+			Response: webhook.Payload{}, Produces: eventStreamContentType, Headers: []Header{{Name: lastEventIDHeader}}},
+		{Method: http.MethodGet, Path: "/admin/outbox", Handler: ListOutboxHandler, Scope: auth.ScopeAdmin, Summary: "List the events published to webhooks and their delivery state",
+			Response: OutboxListResponse{}, Query: append([]string{"status"}, pageQuery...)},
+		{Method: http.MethodPost, Path: "/admin/outbox/{id}:replay", Handler: ReplayOutboxEventHandler, Scope: auth.ScopeAdmin, Summary: "Deliver an event to every webhook again",
+			Response: OutboxEventResponse{}},
+	}
+}
+
+// actionPath matches a path ending in a custom method on a wildcard, such as /users/{id}:restore
+var actionPath = regexp.MustCompile(`\{(\w+)\}(:\w+)$`)
+
+// actionRoutes holds the handlers of the custom methods sharing one mux pattern, keyed by suffix
+type actionRoutes struct {
+	wildcard string
+	handlers map[string]http.HandlerFunc
+}
+
+// RegisterRoutes registers every API route on the given mux using method and path patterns
+// Callers must stay within their rate limit and be granted the scope of a route, and writes made by
+// the handlers are attributed to the request in the audit log.
+// The OpenAPI spec, its docs page and the liveness and readiness probes are registered as well
+func RegisterRoutes(mux *http.ServeMux) {
+	actions := map[string]*actionRoutes{}
+	for _, route := range Routes() {
+		handler := route.Handler
+		if route.Idempotent {
+			handler = idempotent(handler)
+		}
+		handler = auditContext(rateLimit(route.Method+" "+route.Path, authorize(route.Scope, handler)))
+
+		// ServeMux wildcards must fill a whole segment, so custom methods are dispatched on the suffix
+		if match := actionPath.FindStringSubmatch(route.Path); match != nil {
+			pattern := route.Method + " " + strings.TrimSuffix(route.Path, match[2])
+			if actions[pattern] == nil {
+				actions[pattern] = &actionRoutes{wildcard: match[1], handlers: map[string]http.HandlerFunc{}}
+			}
+			actions[pattern].handlers[match[2]] = handler
+			continue
+		}
+		mux.HandleFunc(route.Method+" "+route.Path, handler)
+	}
+	for pattern, routes := range actions {
+		mux.HandleFunc(pattern, routes.dispatch)
+	}
+
+	mux.HandleFunc("GET /openapi.json", OpenAPIHandler)
+	mux.HandleFunc("GET /docs", DocsHandler)
+	mux.HandleFunc("GET /healthz", HealthHandler)
+	mux.HandleFunc("GET /readyz", ReadyHandler)
+}
+
+// dispatch runs the handler whose suffix ends the wildcard, with the suffix removed from its value
+func (ar *actionRoutes) dispatch(w http.ResponseWriter, r *http.Request) {
+	value := r.PathValue(ar.wildcard)
+	for suffix, handler := range ar.handlers {
+		if strings.HasSuffix(value, suffix) {
+			r.SetPathValue(ar.wildcard, strings.TrimSuffix(value, suffix))
+			handler(w, r)
+			return
+		}
+	}
+	writeProblem(w, r, http.StatusNotFound, "")
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionRoutes(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	var got string
+	routes := &actionRoutes{wildcard: "id", handlers: map[string]http.HandlerFunc{
+		":restore": func(w http.ResponseWriter, r *http.Request) {
+			got = r.PathValue("id")
+			w.WriteHeader(http.StatusOK)
+		},
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /users/{id}", routes.dispatch)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		id     string
+	}{
+		{name: "known action", path: "/users/42:restore", status: http.StatusOK, id: "42"},
+		{name: "unknown action", path: "/users/42:archive", status: http.StatusNotFound},
+		{name: "no action", path: "/users/42", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, nil))
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.id, got)
+		})
+	}
+}
+
+func TestRestoreRouteRegistered(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	mux := newAdminMux()
+
+	// The ID is validated by RestoreUserHandler before the database is used
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/users/not-a-uuid:restore", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid id")
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"frame/validation"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError = validation.FieldError
+
+// normalizer is implemented by requests that clean up their fields before validation
+type normalizer interface {
+	normalize()
+}
+
+// validator is implemented by requests with rules that can't be expressed as struct tags
+// Its errors are reported together with the errors from the validate tags
+type validator interface {
+	validate() []FieldError
+}
+
+// decodeJSON reads the JSON request body into v and validates it
+// Unknown fields and data after the JSON value are rejected
+// It writes a problem response listing every invalid field and returns false when v can't be used
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid request payload: "+err.Error())
+		return false
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid request payload: body must contain a single JSON object")
+		return false
+	}
+
+	if errs := checkRequest(v); len(errs) > 0 {
+		writeValidationProblem(w, r, errs)
+		return false
+	}
+
+	return true
+}
+
+// checkRequest normalizes a decoded request and returns every invalid field
+func checkRequest(v any) []FieldError {
+	if n, ok := v.(normalizer); ok {
+		n.normalize()
+	}
+
+	errs := []FieldError(validation.Struct(v))
+	if val, ok := v.(validator); ok {
+		errs = append(errs, val.validate()...)
+	}
+	return errs
+}
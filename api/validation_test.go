@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	viper.Set("config", map[string]interface{}{})
+	require.NoError(t, logging.Initialize())
+
+	tests := []struct {
+		name       string
+		body       string
+		wantOK     bool
+		wantStatus int
+		wantFields []string
+	}{
+		{name: "valid", body: `{"fname":" Jane ","lname":"Doe","email":"jane@example.com"}`, wantOK: true},
+		{name: "malformed", body: `{"fname":`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", body: `{"fname":"Jane","lname":"Doe","email":"jane@example.com","age":3}`, wantStatus: http.StatusBadRequest},
+		{name: "trailing data", body: `{"fname":"Jane","lname":"Doe","email":"jane@example.com"} {}`, wantStatus: http.StatusBadRequest},
+		{name: "every invalid field reported", body: `{"fname":"","lname":"` + strings.Repeat("x", 101) + `","email":"jane"}`, wantStatus: http.StatusBadRequest, wantFields: []string{"fname", "lname", "email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			var ur UserRequest
+			ok := decodeJSON(rr, req, &ur)
+
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, "Jane", ur.Fname)
+				return
+			}
+			assert.Equal(t, tt.wantStatus, rr.Code)
+
+			p := decodeProblem(t, rr)
+			var fields []string
+			for _, fe := range p.Errors {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, tt.wantFields, fields)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// keyPrefix starts every API key so they are easy to spot in code and logs
+const keyPrefix = "frk_"
+
+// Lengths of the random parts of a key, in bytes before encoding
+const (
+	idBytes     = 5  // 8 characters
+	secretBytes = 20 // 32 characters
+)
+
+// ErrMalformedKey is returned when a string doesn't have the shape of an API key
+var ErrMalformedKey = errors.New("malformed API key")
+
+// encoding is lowercase base32 without padding, so keys only hold [a-z2-7] after their prefix
+var encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// NewKey generates an API key of the form frk_<prefix>_<secret>
+// It returns the key, to be shown once, its prefix and the hash to store
+func NewKey() (key, prefix string, hash []byte, err error) {
+	buf := make([]byte, idBytes+secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", nil, err
+	}
+
+	prefix = encoding.EncodeToString(buf[:idBytes])
+	key = keyPrefix + prefix + "_" + encoding.EncodeToString(buf[idBytes:])
+	return key, prefix, Hash(key), nil
+}
+
+// ParseKey returns the prefix identifying an API key
+func ParseKey(key string) (string, error) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", ErrMalformedKey
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != encoding.EncodedLen(idBytes) || len(secret) != encoding.EncodedLen(secretBytes) {
+		return "", ErrMalformedKey
+	}
+	return prefix, nil
+}
+
+// Hash returns the SHA-256 hash stored for a key
+// Keys are random and long, so a fast unsalted hash is enough to keep them out of the database
+func Hash(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// Matches reports whether key hashes to hash, in constant time
+func Matches(key string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(Hash(key), hash) == 1
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Subject identifies the caller in the audit log, such as api_key:<prefix> or jwt:<sub>
+	Subject string
+	// Name is the human readable name of the caller
+	Name string
+	// KeyID is the ID of the API key the caller authenticated with
+	KeyID uuid.UUID
+	// Claims are the claims of the token the caller authenticated with, nil for API keys
+	Claims *Claims
+	// Scopes are the scopes granted to the caller by its API key or token
+	Scopes []string
+}
+
+// Scopes a caller can be granted
+const (
+	ScopeUsersRead      = "users:read"
+	ScopeUsersWrite     = "users:write"
+	ScopeExercisesRead  = "exercises:read"
+	ScopeExercisesWrite = "exercises:write"
+	// ScopeAdmin grants every other scope as well as the admin routes
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every scope a caller can be granted
+var Scopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeExercisesRead, ScopeExercisesWrite, ScopeAdmin}
+
+// Allows reports whether the caller was granted scope, or admin which grants every scope
+func (p *Principal) Allows(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// principalKey keys the principal stored in a context
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the authenticated caller of the request, nil when there is none
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Usage collects when keys were last used so they can be stored in one write
+// instead of one write per request
+type Usage struct {
+	mu   sync.Mutex
+	used map[uuid.UUID]time.Time
+}
+
+// NewUsage creates an empty usage record
+func NewUsage() *Usage {
+	return &Usage{used: map[uuid.UUID]time.Time{}}
+}
+
+// Record notes that a key was used at t
+func (u *Usage) Record(id uuid.UUID, t time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if t.After(u.used[id]) {
+		u.used[id] = t
+	}
+}
+
+// Take returns the last use of each key recorded since the previous call and forgets them
+func (u *Usage) Take() map[uuid.UUID]time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	used := u.used
+	u.used = map[uuid.UUID]time.Time{}
+	return used
+}
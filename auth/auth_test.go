@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKey(t *testing.T) {
+	key, prefix, hash, err := NewKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "frk_"+prefix+"_"))
+	assert.Len(t, prefix, 8)
+	assert.True(t, Matches(key, hash))
+
+	parsed, err := ParseKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, parsed)
+
+	other, _, _, err := NewKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.False(t, Matches(other, hash))
+}
+
+func TestParseKeyMalformed(t *testing.T) {
+	key, _, _, err := NewKey()
+	require.NoError(t, err)
+
+	for _, malformed := range []string{
+		"",
+		strings.TrimPrefix(key, "frk_"),
+		"frk_abcdefgh",
+		"frk_abc_" + strings.Repeat("a", 32),
+		key + "a",
+	} {
+		_, err := ParseKey(malformed)
+		assert.ErrorIs(t, err, ErrMalformedKey, malformed)
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+
+	p := &Principal{Subject: "api_key:abcdefgh", Name: "ci"}
+	assert.Equal(t, p, FromContext(WithPrincipal(context.Background(), p)))
+}
+
+func TestUsage(t *testing.T) {
+	u := NewUsage()
+	id := uuid.New()
+	now := time.Now()
+
+	u.Record(id, now)
+	u.Record(id, now.Add(-time.Minute)) // an older use doesn't replace a newer one
+	assert.Equal(t, map[uuid.UUID]time.Time{id: now}, u.Take())
+	assert.Empty(t, u.Take())
+}
+
+func TestPrincipalAllows(t *testing.T) {
+	reader := &Principal{Scopes: []string{ScopeUsersRead}}
+	assert.True(t, reader.Allows(ScopeUsersRead))
+	assert.False(t, reader.Allows(ScopeUsersWrite))
+	assert.False(t, reader.Allows(ScopeAdmin))
+
+	admin := &Principal{Scopes: []string{ScopeAdmin}}
+	for _, scope := range Scopes {
+		assert.True(t, admin.Allows(scope), scope)
+	}
+
+	assert.False(t, (&Principal{}).Allows(ScopeUsersRead))
+}
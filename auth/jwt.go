@@ -0,0 +1,445 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"frame/config"
+	"frame/logging"
+
+	"go.uber.org/zap"
+)
+
+// Algorithms a token may be signed with
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// minRSABits is the smallest RSA modulus accepted for RS256 keys
+const minRSABits = 2048
+
+var (
+	// ErrInvalidToken is returned when a token is malformed or its signature doesn't verify
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenRejected is returned when a correctly signed token fails a claim check
+	ErrTokenRejected = errors.New("token rejected")
+)
+
+// Claims are the claims of a verified token
+// The registered claims are decoded into fields, All holds every claim as it appeared in the token.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time // zero when the token has no nbf claim
+	IssuedAt  time.Time // zero when the token has no iat claim
+	Scopes    []string  // from the space separated scope claim, or the scp claim used by some issuers
+	All       map[string]any
+}
+
+// ClaimsFromContext returns the claims of the token a request authenticated with, nil when it used
+// an API key or isn't authenticated
+func ClaimsFromContext(ctx context.Context) *Claims {
+	if p := FromContext(ctx); p != nil {
+		return p.Claims
+	}
+	return nil
+}
+
+// verificationKey is a key tokens may be signed with
+type verificationKey struct {
+	id        string
+	algorithm string
+	secret    []byte           // HS256
+	public    crypto.PublicKey // RS256 and ES256
+}
+
+// Verifier checks the signature and claims of JSON Web Tokens
+// Its keys can be replaced with Reload while tokens are being verified.
+type Verifier struct {
+	mu       sync.RWMutex
+	keys     []verificationKey
+	issuer   string
+	audience string
+	skew     time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier creates a verifier trusting the keys configured in cfg and those of its JWKS file
+func NewVerifier(cfg config.JWTConfig) (*Verifier, error) {
+	v := &Verifier{now: time.Now}
+	if err := v.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload replaces the keys and expected claims with those of cfg, reading the JWKS file again
+// The previous settings are kept when cfg is invalid. A cfg without keys disables the verifier, so
+// removing a compromised key revokes it even when it was the last one.
+func (v *Verifier) Reload(cfg config.JWTConfig) error {
+	var keys []verificationKey
+	for i, k := range cfg.Keys {
+		key, err := configKey(k)
+		if err != nil {
+			return fmt.Errorf("error loading jwt.keys[%d]: %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	if cfg.JWKSFile != "" {
+		jwks, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return fmt.Errorf("error loading JWKS file %s: %v", cfg.JWKSFile, err)
+		}
+		keys = append(keys, jwks...)
+	}
+	if len(keys) > 0 && (cfg.Issuer == "" || cfg.Audience == "") {
+		return fmt.Errorf("jwt.issuer and jwt.audience must be set to verify tokens")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys, v.issuer, v.audience, v.skew = keys, cfg.Issuer, cfg.Audience, cfg.ClockSkew
+	return nil
+}
+
+// Enabled reports whether the verifier has keys to verify tokens with
+func (v *Verifier) Enabled() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.keys) > 0
+}
+
+// IsToken reports whether s has the shape of a compact JWT rather than an API key
+func IsToken(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+// Verify checks the signature of a compact JWT and its issuer, audience, expiry and not before claims
+// Times are compared allowing for the configured clock skew
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	v.mu.RLock()
+	keys, issuer, audience, skew := v.keys, v.issuer, v.audience, v.skew
+	v.mu.RUnlock()
+
+	// The algorithm must be the one of the key, so a public key can't be used as an HMAC secret
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := slices.ContainsFunc(keys, func(k verificationKey) bool {
+		return k.algorithm == header.Algorithm && (header.KeyID == "" || k.id == header.KeyID) &&
+			k.verify(signed, signature)
+	})
+	if !verified {
+		return nil, ErrInvalidToken
+	}
+
+	claims, err := decodeClaims(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := v.now()
+	switch {
+	case claims.Issuer != issuer:
+		return nil, fmt.Errorf("%w: issuer %q isn't trusted", ErrTokenRejected, claims.Issuer)
+	case !slices.Contains(claims.Audience, audience):
+		return nil, fmt.Errorf("%w: token isn't meant for audience %q", ErrTokenRejected, audience)
+	case claims.ExpiresAt.IsZero():
+		return nil, fmt.Errorf("%w: token has no expiry", ErrTokenRejected)
+	case !now.Before(claims.ExpiresAt.Add(skew)):
+		return nil, fmt.Errorf("%w: token expired at %s", ErrTokenRejected, claims.ExpiresAt.Format(time.RFC3339))
+	case !claims.NotBefore.IsZero() && now.Add(skew).Before(claims.NotBefore):
+		return nil, fmt.Errorf("%w: token isn't valid before %s", ErrTokenRejected, claims.NotBefore.Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+// verify reports whether signature is a valid signature of signed by the key
+func (k verificationKey) verify(signed, signature []byte) bool {
+	sum := sha256.Sum256(signed)
+	switch k.algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case RS256:
+		pub, ok := k.public.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature) == nil
+	case ES256:
+		pub, ok := k.public.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, sum[:], r, s)
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token into v
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeClaims decodes the payload segment of a token
+func decodeClaims(segment string) (*Claims, error) {
+	var all map[string]any
+	if err := decodeSegment(segment, &all); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{All: all}
+	claims.Issuer, _ = all["iss"].(string)
+	claims.Subject, _ = all["sub"].(string)
+	claims.Audience = stringList(all["aud"])
+	claims.Scopes = stringList(all["scope"])
+	if claims.Scopes == nil {
+		claims.Scopes = stringList(all["scp"])
+	}
+	claims.ExpiresAt = numericDate(all["exp"])
+	claims.NotBefore = numericDate(all["nbf"])
+	claims.IssuedAt = numericDate(all["iat"])
+	return claims, nil
+}
+
+// stringList converts a claim holding a list of strings, either as an array or separated by spaces
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// numericDate converts a JWT NumericDate, seconds since the epoch, to a time
+func numericDate(v any) time.Time {
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// configKey loads a key configured under jwt.keys
+func configKey(k config.JWTKey) (verificationKey, error) {
+	key := verificationKey{id: k.ID, algorithm: k.Algorithm}
+	switch k.Algorithm {
+	case HS256:
+		if k.Secret == "" {
+			return key, fmt.Errorf("HS256 keys need a secret")
+		}
+		key.secret = []byte(k.Secret)
+		return key, nil
+	case RS256, ES256:
+		block, _ := pem.Decode([]byte(k.PublicKey))
+		if block == nil {
+			return key, fmt.Errorf("%s keys need a PEM encoded public_key", k.Algorithm)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return key, err
+		}
+		key.public = pub
+		return key, checkPublicKey(key)
+	}
+	return key, fmt.Errorf("unsupported algorithm %q, expected HS256, RS256 or ES256", k.Algorithm)
+}
+
+// checkPublicKey makes sure the public key of an RS256 or ES256 key suits its algorithm
+func checkPublicKey(key verificationKey) error {
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if key.algorithm != RS256 {
+			return fmt.Errorf("RSA keys can only verify RS256")
+		}
+		if pub.N.BitLen() < minRSABits {
+			return fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if key.algorithm != ES256 || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("ECDSA keys can only verify ES256 on the P-256 curve")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", key.public)
+}
+
+// jsonWebKey is the subset of RFC 7517 keys understood by loadJWKS
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	K         string `json:"k"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+// loadJWKS reads the signing keys of a JSON Web Key Set file
+// Keys meant for encryption are skipped, and keys without alg get the one matching their type
+func loadJWKS(path string) ([]verificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []verificationKey
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%s): %v", i, jwk.KeyID, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) verificationKey() (verificationKey, error) {
+	key := verificationKey{id: jwk.KeyID, algorithm: jwk.Algorithm}
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.KeyType {
+	case "oct":
+		if key.algorithm == "" {
+			key.algorithm = HS256
+		}
+		secret, err := decode(jwk.K)
+		if err != nil || len(secret) == 0 || key.algorithm != HS256 {
+			return key, fmt.Errorf("oct keys need a base64url k and alg HS256")
+		}
+		key.secret = secret
+		return key, nil
+	case "RSA":
+		if key.algorithm == "" {
+			key.algorithm = RS256
+		}
+		n, errN := decode(jwk.N)
+		e, errE := decode(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return key, fmt.Errorf("RSA keys need base64url n and e")
+		}
+		key.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		if key.algorithm == "" {
+			key.algorithm = ES256
+		}
+		x, errX := decode(jwk.X)
+		y, errY := decode(jwk.Y)
+		if jwk.Curve != "P-256" || errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return key, fmt.Errorf("EC keys need crv P-256 and base64url x and y")
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return key, err
+		}
+		key.public = pub
+	default:
+		return key, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+	return key, checkPublicKey(key)
+}
+
+var (
+	verifier   *Verifier
+	verifierMu sync.RWMutex
+)
+
+// Initialize creates the verifier returned by GetVerifier, enabled once cfg has keys or a JWKS file
+// The verifier is reloaded whenever the configuration changes, and keeps its keys if the new ones fail to load.
+// Keys can thus be added to a server started without any, and removing all of them disables JWT authentication.
+func Initialize(cfg config.JWTConfig) error {
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		return err
+	}
+
+	verifierMu.Lock()
+	verifier = v
+	verifierMu.Unlock()
+
+	config.RegisterCallback(func(cfg *config.Config) {
+		if err := v.Reload(cfg.JWT); err != nil {
+			logging.GetLogger().Error("Failed to reload JWT keys, keeping the previous ones",
+				zap.Error(err))
+			return
+		}
+		if !v.Enabled() {
+			logging.GetLogger().Info("No JWT keys configured, JWT authentication is disabled")
+			return
+		}
+		logging.GetLogger().Info("Reloaded JWT keys")
+	})
+	return nil
+}
+
+// GetVerifier returns the verifier of the server, nil when JWTs aren't accepted
+func GetVerifier() *Verifier {
+	verifierMu.RLock()
+	defer verifierMu.RUnlock()
+	if verifier == nil || !verifier.Enabled() {
+		return nil
+	}
+	return verifier
+}
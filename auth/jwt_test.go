@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signToken returns a compact JWT with the given header and claims signed by key
+// key is a []byte secret for HS256, an *rsa.PrivateKey or an *ecdsa.PrivateKey
+func signToken(t *testing.T, header, claims map[string]any, key any) string {
+	t.Helper()
+	segment := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+	sum := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func publicKeyPEM(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("shared-secret")
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	cfg := config.JWTConfig{
+		Issuer:    "https://issuer.example.com",
+		Audience:  "frame",
+		ClockSkew: time.Minute,
+		Keys: []config.JWTKey{
+			{ID: "hs", Algorithm: HS256, Secret: string(secret)},
+			{ID: "rs", Algorithm: RS256, PublicKey: publicKeyPEM(t, &rsaKey.PublicKey)},
+			{ID: "es", Algorithm: ES256, PublicKey: publicKeyPEM(t, &ecKey.PublicKey)},
+		},
+	}
+	v, err := NewVerifier(cfg)
+	require.NoError(t, err)
+	v.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   cfg.Issuer,
+			"sub":   "billing",
+			"aud":   []string{"frame", "ledger"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"scope": "users:read",
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	t.Run("algorithms", func(t *testing.T) {
+		for alg, key := range map[string]any{HS256: secret, RS256: rsaKey, ES256: ecKey} {
+			token := signToken(t, map[string]any{"alg": alg, "typ": "JWT"}, claims(nil), key)
+			require.True(t, IsToken(token))
+
+			got, err := v.Verify(token)
+			require.NoError(t, err, alg)
+			assert.Equal(t, "billing", got.Subject)
+			assert.Equal(t, []string{"frame", "ledger"}, got.Audience)
+			assert.Equal(t, now.Add(time.Hour), got.ExpiresAt.UTC())
+			assert.Equal(t, now, got.IssuedAt.UTC())
+			assert.Equal(t, "users:read", got.All["scope"])
+			assert.Equal(t, []string{ScopeUsersRead}, got.Scopes)
+		}
+	})
+
+	t.Run("scp claim", func(t *testing.T) {
+		got, err := v.Verify(signToken(t, map[string]any{"alg": HS256},
+			claims(map[string]any{"scope": nil, "scp": []string{ScopeUsersRead, ScopeUsersWrite}}), secret))
+		require.NoError(t, err)
+		assert.Equal(t, []string{ScopeUsersRead, ScopeUsersWrite}, got.Scopes)
+	})
+
+	t.Run("key id", func(t *testing.T) {
+		_, err := v.Verify(signToken(t, map[string]any{"alg": HS256, "kid": "hs"}, claims(nil), secret))
+		assert.NoError(t, err)
+
+		_, err = v.Verify(signToken(t, map[string]any{"alg": HS256, "kid": "other"}, claims(nil), secret))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("clock skew", func(t *testing.T) {
+		_, err := v.Verify(signToken(t, map[string]any{"alg": HS256},
+			claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix(), "nbf": now.Add(30 * time.Second).Unix()}), secret))
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejected claims", func(t *testing.T) {
+		for name, overrides := range map[string]map[string]any{
+			"issuer":     {"iss": "https://evil.example.com"},
+			"audience":   {"aud": "ledger"},
+			"no expiry":  {"exp": nil},
+			"expired":    {"exp": now.Add(-2 * time.Minute).Unix()},
+			"not before": {"nbf": now.Add(2 * time.Minute).Unix()},
+		} {
+			_, err := v.Verify(signToken(t, map[string]any{"alg": ES256}, claims(overrides), ecKey))
+			assert.ErrorIs(t, err, ErrTokenRejected, name)
+		}
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		valid := strings.Split(signToken(t, map[string]any{"alg": HS256}, claims(nil), secret), ".")
+		forged := strings.Split(signToken(t, map[string]any{"alg": HS256}, claims(map[string]any{"sub": "admin"}), secret), ".")
+
+		for name, token := range map[string]string{
+			"malformed":       "not.a.token",
+			"unsigned":        signToken(t, map[string]any{"alg": "none"}, claims(nil), nil),
+			"unknown key":     signToken(t, map[string]any{"alg": ES256}, claims(nil), other),
+			"tampered claims": valid[0] + "." + forged[1] + "." + valid[2],
+			// An RS256 public key used as an HS256 secret must not verify
+			"algorithm confusion": signToken(t, map[string]any{"alg": HS256}, claims(nil), []byte(cfg.Keys[1].PublicKey)),
+		} {
+			_, err := v.Verify(token)
+			assert.ErrorIs(t, err, ErrInvalidToken, name)
+		}
+	})
+}
+
+func TestVerifierConfig(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	for name, cfg := range map[string]config.JWTConfig{
+		"no issuer":    {Audience: "frame", Keys: []config.JWTKey{{Algorithm: HS256, Secret: "s"}}},
+		"algorithm":    {Issuer: "i", Audience: "frame", Keys: []config.JWTKey{{Algorithm: "RS512", Secret: "s"}}},
+		"no secret":    {Issuer: "i", Audience: "frame", Keys: []config.JWTKey{{Algorithm: HS256}}},
+		"bad PEM":      {Issuer: "i", Audience: "frame", Keys: []config.JWTKey{{Algorithm: RS256, PublicKey: "nope"}}},
+		"weak RSA":     {Issuer: "i", Audience: "frame", Keys: []config.JWTKey{{Algorithm: RS256, PublicKey: publicKeyPEM(t, &weak.PublicKey)}}},
+		"missing JWKS": {Issuer: "i", Audience: "frame", JWKSFile: filepath.Join(t.TempDir(), "missing.json")},
+		"key mismatch": {Issuer: "i", Audience: "frame", Keys: []config.JWTKey{{Algorithm: ES256, PublicKey: publicKeyPEM(t, &weak.PublicKey)}}},
+	} {
+		_, err := NewVerifier(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestJWKSReload(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("jwks-secret")
+
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	writeJWKS := func(path string, keys ...map[string]any) {
+		data, err := json.Marshal(map[string]any{"keys": keys})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+	}
+	rsaJWK := map[string]any{"kty": "RSA", "kid": "rs-1", "use": "sig",
+		"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())}
+	ecJWK := map[string]any{"kty": "EC", "kid": "es-1", "crv": "P-256",
+		"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))}
+	octJWK := map[string]any{"kty": "oct", "kid": "hs-1", "alg": HS256, "k": b64(secret)}
+	encJWK := map[string]any{"kty": "RSA", "kid": "enc", "use": "enc", "n": "", "e": ""}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(path, rsaJWK, encJWK)
+	cfg := config.JWTConfig{Issuer: "i", Audience: "frame", ClockSkew: time.Minute, JWKSFile: path}
+	v, err := NewVerifier(cfg)
+	require.NoError(t, err)
+
+	claims := map[string]any{"iss": "i", "aud": "frame", "sub": "svc", "exp": time.Now().Add(time.Hour).Unix()}
+	rsToken := signToken(t, map[string]any{"alg": RS256, "kid": "rs-1"}, claims, rsaKey)
+	esToken := signToken(t, map[string]any{"alg": ES256, "kid": "es-1"}, claims, ecKey)
+	hsToken := signToken(t, map[string]any{"alg": HS256, "kid": "hs-1"}, claims, secret)
+
+	_, err = v.Verify(rsToken)
+	assert.NoError(t, err)
+	_, err = v.Verify(esToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Rotating the file replaces the keys on reload
+	writeJWKS(path, ecJWK, octJWK)
+	require.NoError(t, v.Reload(cfg))
+	_, err = v.Verify(esToken)
+	assert.NoError(t, err)
+	_, err = v.Verify(hsToken)
+	assert.NoError(t, err)
+	_, err = v.Verify(rsToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// A broken file keeps the previous keys
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	assert.Error(t, v.Reload(cfg))
+	_, err = v.Verify(esToken)
+	assert.NoError(t, err)
+
+	// Emptying the file revokes every key, even without issuer and audience
+	writeJWKS(path)
+	require.NoError(t, v.Reload(config.JWTConfig{JWKSFile: path}))
+	assert.False(t, v.Enabled())
+	_, err = v.Verify(esToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestInitializeWithoutKeys(t *testing.T) {
+	require.NoError(t, Initialize(config.JWTConfig{}))
+	assert.Nil(t, GetVerifier())
+
+	// The verifier is still made, so keys added by a reload enable it
+	verifierMu.RLock()
+	v := verifier
+	verifierMu.RUnlock()
+	require.NotNil(t, v)
+	require.NoError(t, v.Reload(config.JWTConfig{Issuer: "i", Audience: "frame",
+		Keys: []config.JWTKey{{Algorithm: HS256, Secret: "s"}}}))
+	assert.Same(t, v, GetVerifier())
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"frame/logging"
+	"frame/phone"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -17,6 +20,10 @@ type Config struct {
 	Database DatabaseConfig
 	Server   ServerConfig
 	Logging  LoggingConfig
+	Phone    PhoneConfig
+	Webhooks WebhooksConfig
+	Events   EventsConfig
+	JWT      JWTConfig
 }
 
 type LoggingConfig struct {
@@ -24,16 +31,100 @@ type LoggingConfig struct {
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	Name     string
-	SSLMode  string
+	Host                 string
+	Port                 int
+	User                 string
+	Password             string
+	Name                 string
+	SSLMode              string
+	PurgeAfterDays       int           `mapstructure:"purge_after_days"`       // days soft deleted users are kept before they are purged, 0 keeps them forever
+	PingInterval         time.Duration `mapstructure:"ping_interval"`          // how often the database is pinged
+	PingFailureThreshold int           `mapstructure:"ping_failure_threshold"` // consecutive failed pings after which the server reports not ready
 }
 
 type ServerConfig struct {
-	Port int
+	Port             int
+	DefaultPageSize  int             `mapstructure:"default_page_size"` // page size when a listing doesn't ask for one
+	MaxPageSize      int             `mapstructure:"max_page_size"`     // upper bound on the page size a client may request
+	IdempotencyTTL   time.Duration   `mapstructure:"idempotency_ttl"`   // how long an Idempotency-Key and its response are kept
+	IdempotencyLease time.Duration   `mapstructure:"idempotency_lease"` // how long a request may hold its Idempotency-Key before a retry takes it over
+	ShutdownDelay    time.Duration   `mapstructure:"shutdown_delay"`    // how long the server reports not ready before it stops accepting requests
+	ShutdownTimeout  time.Duration   `mapstructure:"shutdown_timeout"`  // how long in-flight requests may take to finish on shutdown
+	RateLimit        RateLimitConfig `mapstructure:"rate_limit"`
+	CORS             CORSConfig
+}
+
+// RateLimitConfig controls the token buckets limiting how often clients can call the API
+type RateLimitConfig struct {
+	Enabled             bool
+	Key                 string           // what requests are counted by: api_key, ip or route
+	RequestsPerSecond   float64          `mapstructure:"requests_per_second"` // rate at which a bucket refills
+	Burst               int              // requests a full bucket allows at once
+	IPRequestsPerSecond float64          `mapstructure:"ip_requests_per_second"` // rate at which the bucket of a client address refills, checked before authentication
+	IPBurst             int              `mapstructure:"ip_burst"`               // requests a client address may make at once before authentication
+	Routes              []RouteRateLimit // routes with their own limit, counted apart from the other routes
+}
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`   // origins such as https://app.example.com or https://*.example.com, * for any, none disables CORS
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`   // methods a preflight may ask for
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`   // request headers a preflight may ask for, * for any
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`   // response headers scripts may read
+	AllowCredentials bool          `mapstructure:"allow_credentials"` // let browsers send cookies and Authorization headers
+	MaxAge           time.Duration `mapstructure:"max_age"`           // how long browsers may cache a preflight answer
+}
+
+// RouteRateLimit is the limit of a single route
+type RouteRateLimit struct {
+	Route             string  // method and path as printed by frame routes, such as POST /users
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int
+}
+
+type PhoneConfig struct {
+	DefaultRegion string `mapstructure:"default_region"` // ISO 3166-1 alpha-2 region for numbers without a country code
+}
+
+// WebhooksConfig controls the delivery of outbox events to webhooks
+type WebhooksConfig struct {
+	Endpoints      []WebhookEndpoint // webhooks receiving every event, without any events are marked delivered unsent
+	PollInterval   time.Duration     `mapstructure:"poll_interval"` // how often the outbox is checked for due events
+	Timeout        time.Duration     // how long a webhook may take to respond
+	MaxAttempts    int               `mapstructure:"max_attempts"`    // failed attempts before an event is dead lettered
+	InitialBackoff time.Duration     `mapstructure:"initial_backoff"` // wait before the first retry, doubled on each later one
+	MaxBackoff     time.Duration     `mapstructure:"max_backoff"`     // upper bound on the wait between retries
+	Retention      time.Duration     // how long delivered events are kept in the outbox, 0 keeps them forever
+}
+
+// WebhookEndpoint is a URL receiving events signed with its secret
+type WebhookEndpoint struct {
+	URL    string
+	Secret string
+}
+
+// EventsConfig controls the GET /events change feed
+type EventsConfig struct {
+	ReplayBuffer int           `mapstructure:"replay_buffer"` // recent events kept for clients resuming with Last-Event-ID
+	ClientBuffer int           `mapstructure:"client_buffer"` // events queued for a client before it's disconnected as too slow
+	Heartbeat    time.Duration // how often an idle stream gets a comment to keep proxies from closing it
+}
+
+// JWTConfig controls the JSON Web Tokens accepted as bearer tokens next to API keys
+type JWTConfig struct {
+	Issuer    string        // iss every token must have
+	Audience  string        // value the aud of every token must contain
+	ClockSkew time.Duration `mapstructure:"clock_skew"` // leeway when checking exp and nbf against the local clock
+	Keys      []JWTKey      // keys tokens may be signed with, no keys and no JWKS file rejects every token
+	JWKSFile  string        `mapstructure:"jwks_file"` // local JSON Web Key Set with more keys, read again when the config reloads
+}
+
+// JWTKey is a key tokens may be signed with
+type JWTKey struct {
+	ID        string `mapstructure:"kid"` // matched against the kid header of tokens, empty matches any
+	Algorithm string `mapstructure:"alg"` // HS256, RS256 or ES256
+	Secret    string // shared secret of HS256 keys
+	PublicKey string `mapstructure:"public_key"` // PEM encoded public key of RS256 and ES256 keys
 }
 
 // ConfigCallback is a function that will be called when configuration changes
@@ -42,6 +133,7 @@ type ConfigCallback func(*Config)
 var (
 	callbacks []ConfigCallback
 	mu        sync.RWMutex
+	stopped   atomic.Bool
 )
 
 // RegisterCallback registers a function to be called when configuration changes
@@ -82,6 +174,12 @@ func WatchConfig() {
 			eventLogger = logger
 		}
 
+		if stopped.Load() {
+			eventLogger.Info("Ignored config file change while shutting down",
+				zap.String("file", e.Name))
+			return
+		}
+
 		eventLogger.Info("Config file changed",
 			zap.String("file", e.Name),
 			zap.String("operation", e.Op.String()))
@@ -99,6 +197,13 @@ func WatchConfig() {
 	viper.WatchConfig()
 }
 
+// StopWatching stops applying changes of the configuration file
+// The callbacks aren't called anymore, so a change made while the server shuts down doesn't
+// reconnect the database or replace settings that are being torn down.
+func StopWatching() {
+	stopped.Store(true)
+}
+
 // Load initializes configuration from various sources in the following order:
 // 1. Default values
 // 2. Configuration file
@@ -132,10 +237,37 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %v", err)
 	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
 
+// validate rejects settings that would only fail once requests are served
+// A reload with invalid settings is refused and the previous configuration kept.
+func (c *Config) validate() error {
+	if !phone.IsKnownRegion(c.Phone.DefaultRegion) {
+		return fmt.Errorf("invalid phone.default_region %q, expected a supported ISO 3166-1 alpha-2 code such as US", c.Phone.DefaultRegion)
+	}
+	if c.Server.IdempotencyLease <= 0 {
+		return fmt.Errorf("invalid server.idempotency_lease %s, expected a positive duration", c.Server.IdempotencyLease)
+	}
+	if c.Webhooks.PollInterval <= 0 {
+		return fmt.Errorf("invalid webhooks.poll_interval %s, expected a positive duration", c.Webhooks.PollInterval)
+	}
+	if c.Events.Heartbeat <= 0 {
+		return fmt.Errorf("invalid events.heartbeat %s, expected a positive duration", c.Events.Heartbeat)
+	}
+	if c.Database.PingInterval <= 0 {
+		return fmt.Errorf("invalid database.ping_interval %s, expected a positive duration", c.Database.PingInterval)
+	}
+	if c.Database.PingFailureThreshold < 1 {
+		return fmt.Errorf("invalid database.ping_failure_threshold %d, expected at least 1", c.Database.PingFailureThreshold)
+	}
+	return nil
+}
+
 // setDefaults sets default values for all configuration options
 func setDefaults() {
 	// Database defaults
@@ -145,10 +277,54 @@ func setDefaults() {
 	viper.SetDefault("database.password", "postgres")
 	viper.SetDefault("database.name", "postgres")
 	viper.SetDefault("database.sslmode", "disable")
+	viper.SetDefault("database.purge_after_days", 30)
+	viper.SetDefault("database.ping_interval", 15*time.Second)
+	viper.SetDefault("database.ping_failure_threshold", 3)
 
 	// Server defaults
 	viper.SetDefault("server.port", 8080)
+	viper.SetDefault("server.default_page_size", 20)
+	viper.SetDefault("server.max_page_size", 100)
+	viper.SetDefault("server.idempotency_ttl", 24*time.Hour)
+	viper.SetDefault("server.idempotency_lease", time.Minute)
+	viper.SetDefault("server.shutdown_delay", 0)
+	viper.SetDefault("server.shutdown_timeout", 30*time.Second)
+
+	// Rate limit defaults
+	viper.SetDefault("server.rate_limit.enabled", true)
+	viper.SetDefault("server.rate_limit.key", "api_key")
+	viper.SetDefault("server.rate_limit.requests_per_second", 20)
+	viper.SetDefault("server.rate_limit.burst", 40)
+	viper.SetDefault("server.rate_limit.ip_requests_per_second", 50)
+	viper.SetDefault("server.rate_limit.ip_burst", 100)
+
+	// CORS defaults
+	viper.SetDefault("server.cors.allowed_origins", []string{})
+	viper.SetDefault("server.cors.allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+	viper.SetDefault("server.cors.allowed_headers", []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "X-Request-ID"})
+	viper.SetDefault("server.cors.exposed_headers", []string{"ETag", "Idempotent-Replayed", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"})
+	viper.SetDefault("server.cors.allow_credentials", false)
+	viper.SetDefault("server.cors.max_age", 10*time.Minute)
 
 	// Logging defaults
 	viper.SetDefault("logging.level", "info")
+
+	// Phone defaults
+	viper.SetDefault("phone.default_region", "US")
+
+	// Webhook defaults
+	viper.SetDefault("webhooks.poll_interval", time.Second)
+	viper.SetDefault("webhooks.timeout", 10*time.Second)
+	viper.SetDefault("webhooks.max_attempts", 10)
+	viper.SetDefault("webhooks.initial_backoff", 10*time.Second)
+	viper.SetDefault("webhooks.max_backoff", time.Hour)
+	viper.SetDefault("webhooks.retention", 7*24*time.Hour)
+
+	// Event feed defaults
+	viper.SetDefault("events.replay_buffer", 1000)
+	viper.SetDefault("events.client_buffer", 64)
+	viper.SetDefault("events.heartbeat", 15*time.Second)
+
+	// JWT defaults
+	viper.SetDefault("jwt.clock_skew", time.Minute)
 }
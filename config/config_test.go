@@ -38,19 +38,61 @@ func TestLoad(t *testing.T) {
 			name: "default values",
 			want: &Config{
 				Database: DatabaseConfig{
-					Host:     "localhost",
-					Port:     15432,
-					User:     "postgres",
-					Password: "postgres",
-					Name:     "postgres",
-					SSLMode:  "disable",
+					Host:                 "localhost",
+					Port:                 15432,
+					User:                 "postgres",
+					Password:             "postgres",
+					Name:                 "postgres",
+					SSLMode:              "disable",
+					PurgeAfterDays:       30,
+					PingInterval:         15 * time.Second,
+					PingFailureThreshold: 3,
 				},
 				Server: ServerConfig{
-					Port: 8080,
+					Port:             8080,
+					DefaultPageSize:  20,
+					MaxPageSize:      100,
+					IdempotencyTTL:   24 * time.Hour,
+					IdempotencyLease: time.Minute,
+					ShutdownTimeout:  30 * time.Second,
+					RateLimit: RateLimitConfig{
+						Enabled:             true,
+						Key:                 "api_key",
+						RequestsPerSecond:   20,
+						Burst:               40,
+						IPRequestsPerSecond: 50,
+						IPBurst:             100,
+					},
+					CORS: CORSConfig{
+						AllowedOrigins: []string{},
+						AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+						AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "X-Request-ID"},
+						ExposedHeaders: []string{"ETag", "Idempotent-Replayed", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+						MaxAge:         10 * time.Minute,
+					},
 				},
 				Logging: LoggingConfig{
 					Level: "info",
 				},
+				Phone: PhoneConfig{
+					DefaultRegion: "US",
+				},
+				Webhooks: WebhooksConfig{
+					PollInterval:   time.Second,
+					Timeout:        10 * time.Second,
+					MaxAttempts:    10,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     time.Hour,
+					Retention:      7 * 24 * time.Hour,
+				},
+				Events: EventsConfig{
+					ReplayBuffer: 1000,
+					ClientBuffer: 64,
+					Heartbeat:    15 * time.Second,
+				},
+				JWT: JWTConfig{
+					ClockSkew: time.Minute,
+				},
 			},
 		},
 		{
@@ -66,19 +108,61 @@ func TestLoad(t *testing.T) {
 			},
 			want: &Config{
 				Database: DatabaseConfig{
-					Host:     "db.example.com",
-					Port:     5432,
-					User:     "admin",
-					Password: "secret",
-					Name:     "myapp",
-					SSLMode:  "disable",
+					Host:                 "db.example.com",
+					Port:                 5432,
+					User:                 "admin",
+					Password:             "secret",
+					Name:                 "myapp",
+					SSLMode:              "disable",
+					PurgeAfterDays:       30,
+					PingInterval:         15 * time.Second,
+					PingFailureThreshold: 3,
 				},
 				Server: ServerConfig{
-					Port: 3000,
+					Port:             3000,
+					DefaultPageSize:  20,
+					MaxPageSize:      100,
+					IdempotencyTTL:   24 * time.Hour,
+					IdempotencyLease: time.Minute,
+					ShutdownTimeout:  30 * time.Second,
+					RateLimit: RateLimitConfig{
+						Enabled:             true,
+						Key:                 "api_key",
+						RequestsPerSecond:   20,
+						Burst:               40,
+						IPRequestsPerSecond: 50,
+						IPBurst:             100,
+					},
+					CORS: CORSConfig{
+						AllowedOrigins: []string{},
+						AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+						AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "X-Request-ID"},
+						ExposedHeaders: []string{"ETag", "Idempotent-Replayed", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+						MaxAge:         10 * time.Minute,
+					},
 				},
 				Logging: LoggingConfig{
 					Level: "debug",
 				},
+				Phone: PhoneConfig{
+					DefaultRegion: "US",
+				},
+				Webhooks: WebhooksConfig{
+					PollInterval:   time.Second,
+					Timeout:        10 * time.Second,
+					MaxAttempts:    10,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     time.Hour,
+					Retention:      7 * 24 * time.Hour,
+				},
+				Events: EventsConfig{
+					ReplayBuffer: 1000,
+					ClientBuffer: 64,
+					Heartbeat:    15 * time.Second,
+				},
+				JWT: JWTConfig{
+					ClockSkew: time.Minute,
+				},
 			},
 		},
 		{
@@ -95,22 +179,66 @@ server:
   port: 9090
 logging:
   level: "debug"
+phone:
+  default_region: "GB"
 `,
 			want: &Config{
 				Database: DatabaseConfig{
-					Host:     "confighost",
-					Port:     6543,
-					User:     "configuser",
-					Password: "configpass",
-					Name:     "configdb",
-					SSLMode:  "verify-full",
+					Host:                 "confighost",
+					Port:                 6543,
+					User:                 "configuser",
+					Password:             "configpass",
+					Name:                 "configdb",
+					SSLMode:              "verify-full",
+					PurgeAfterDays:       30,
+					PingInterval:         15 * time.Second,
+					PingFailureThreshold: 3,
 				},
 				Server: ServerConfig{
-					Port: 9090,
+					Port:             9090,
+					DefaultPageSize:  20,
+					MaxPageSize:      100,
+					IdempotencyTTL:   24 * time.Hour,
+					IdempotencyLease: time.Minute,
+					ShutdownTimeout:  30 * time.Second,
+					RateLimit: RateLimitConfig{
+						Enabled:             true,
+						Key:                 "api_key",
+						RequestsPerSecond:   20,
+						Burst:               40,
+						IPRequestsPerSecond: 50,
+						IPBurst:             100,
+					},
+					CORS: CORSConfig{
+						AllowedOrigins: []string{},
+						AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+						AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "X-Request-ID"},
+						ExposedHeaders: []string{"ETag", "Idempotent-Replayed", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+						MaxAge:         10 * time.Minute,
+					},
 				},
 				Logging: LoggingConfig{
 					Level: "debug",
 				},
+				Phone: PhoneConfig{
+					DefaultRegion: "GB",
+				},
+				Webhooks: WebhooksConfig{
+					PollInterval:   time.Second,
+					Timeout:        10 * time.Second,
+					MaxAttempts:    10,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     time.Hour,
+					Retention:      7 * 24 * time.Hour,
+				},
+				Events: EventsConfig{
+					ReplayBuffer: 1000,
+					ClientBuffer: 64,
+					Heartbeat:    15 * time.Second,
+				},
+				JWT: JWTConfig{
+					ClockSkew: time.Minute,
+				},
 			},
 		},
 		{
@@ -133,20 +261,90 @@ logging:
 			},
 			want: &Config{
 				Database: DatabaseConfig{
-					Host:     "envhost",
-					Port:     6543,
-					User:     "configuser",
-					Password: "configpass",
-					Name:     "configdb",
-					SSLMode:  "disable",
+					Host:                 "envhost",
+					Port:                 6543,
+					User:                 "configuser",
+					Password:             "configpass",
+					Name:                 "configdb",
+					SSLMode:              "disable",
+					PurgeAfterDays:       30,
+					PingInterval:         15 * time.Second,
+					PingFailureThreshold: 3,
 				},
 				Server: ServerConfig{
-					Port: 1234,
+					Port:             1234,
+					DefaultPageSize:  20,
+					MaxPageSize:      100,
+					IdempotencyTTL:   24 * time.Hour,
+					IdempotencyLease: time.Minute,
+					ShutdownTimeout:  30 * time.Second,
+					RateLimit: RateLimitConfig{
+						Enabled:             true,
+						Key:                 "api_key",
+						RequestsPerSecond:   20,
+						Burst:               40,
+						IPRequestsPerSecond: 50,
+						IPBurst:             100,
+					},
+					CORS: CORSConfig{
+						AllowedOrigins: []string{},
+						AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+						AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "X-Request-ID"},
+						ExposedHeaders: []string{"ETag", "Idempotent-Replayed", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+						MaxAge:         10 * time.Minute,
+					},
 				},
 				Logging: LoggingConfig{
 					Level: "debug",
 				},
+				Phone: PhoneConfig{
+					DefaultRegion: "US",
+				},
+				Webhooks: WebhooksConfig{
+					PollInterval:   time.Second,
+					Timeout:        10 * time.Second,
+					MaxAttempts:    10,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     time.Hour,
+					Retention:      7 * 24 * time.Hour,
+				},
+				Events: EventsConfig{
+					ReplayBuffer: 1000,
+					ClientBuffer: 64,
+					Heartbeat:    15 * time.Second,
+				},
+				JWT: JWTConfig{
+					ClockSkew: time.Minute,
+				},
+			},
+		},
+		{
+			name: "unknown phone region",
+			envVars: map[string]string{
+				"FRAME_PHONE_DEFAULT_REGION": "UK",
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero webhook poll interval",
+			envVars: map[string]string{
+				"FRAME_WEBHOOKS_POLL_INTERVAL": "0s",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative events heartbeat",
+			envVars: map[string]string{
+				"FRAME_EVENTS_HEARTBEAT": "-1s",
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero database ping interval",
+			envVars: map[string]string{
+				"FRAME_DATABASE_PING_INTERVAL": "0s",
 			},
+			wantErr: true,
 		},
 	}
 
@@ -286,4 +484,14 @@ logging:
 	time.Sleep(100 * time.Millisecond)
 
 	assert.True(t, configChanged)
+
+	// Changes made once the server is shutting down are ignored
+	StopWatching()
+	defer stopped.Store(false)
+	configChanged = false
+	err = os.WriteFile(tmpfile.Name(), []byte(strings.Replace(modifiedConfig, "modified", "stopped", 1)), 0644)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.False(t, configChanged)
 }
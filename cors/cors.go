@@ -0,0 +1,223 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"frame/config"
+	"frame/logging"
+
+	"go.uber.org/zap"
+)
+
+// Request and response headers of the CORS protocol
+const (
+	originHeader           = "Origin"
+	requestMethodHeader    = "Access-Control-Request-Method"
+	requestHeadersHeader   = "Access-Control-Request-Headers"
+	allowOriginHeader      = "Access-Control-Allow-Origin"
+	allowMethodsHeader     = "Access-Control-Allow-Methods"
+	allowHeadersHeader     = "Access-Control-Allow-Headers"
+	allowCredentialsHeader = "Access-Control-Allow-Credentials"
+	exposeHeadersHeader    = "Access-Control-Expose-Headers"
+	maxAgeHeader           = "Access-Control-Max-Age"
+)
+
+// wildcard allows any origin or request header
+const wildcard = "*"
+
+// rules are the settings of a policy with origins split by how they are matched
+type rules struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	subdomains  []subdomainPattern
+	methods     []string
+	headers     []string
+	anyHeader   bool
+	exposed     []string
+	credentials bool
+	maxAge      int
+}
+
+// subdomainPattern matches origins such as https://*.example.com
+type subdomainPattern struct {
+	scheme string // https://
+	suffix string // .example.com, with the port if the pattern had one
+}
+
+func (p subdomainPattern) matches(origin string) bool {
+	sub, ok := strings.CutPrefix(origin, p.scheme)
+	if !ok {
+		return false
+	}
+	sub, ok = strings.CutSuffix(sub, p.suffix)
+	return ok && sub != "" && !strings.ContainsAny(sub, "/:@")
+}
+
+// Policy decides which browser origins may call the API
+// Its settings can be replaced with Update while requests are served.
+type Policy struct {
+	mu    sync.RWMutex
+	rules rules
+}
+
+// New creates a policy with the settings of cfg
+func New(cfg config.CORSConfig) (*Policy, error) {
+	p := &Policy{}
+	if err := p.Update(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update replaces the settings of the policy with those of cfg
+// The previous settings are kept when cfg is invalid.
+func (p *Policy) Update(cfg config.CORSConfig) error {
+	r := rules{
+		origins:     map[string]bool{},
+		methods:     cfg.AllowedMethods,
+		exposed:     cfg.ExposedHeaders,
+		credentials: cfg.AllowCredentials,
+		maxAge:      int(cfg.MaxAge.Seconds()),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		if origin == wildcard {
+			r.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || strings.Count(origin, wildcard) > 1 {
+			return fmt.Errorf("invalid allowed origin %q, expected a scheme and host such as https://app.example.com", origin)
+		}
+		if scheme, host, ok := strings.Cut(origin, "://*."); ok {
+			r.subdomains = append(r.subdomains, subdomainPattern{scheme: scheme + "://", suffix: "." + host})
+			continue
+		}
+		if strings.Contains(origin, wildcard) {
+			return fmt.Errorf("invalid allowed origin %q, a wildcard can only replace the leading subdomain", origin)
+		}
+		r.origins[origin] = true
+	}
+	if r.anyOrigin && r.credentials {
+		return fmt.Errorf("allow_credentials can't be combined with the * origin, list the origins instead")
+	}
+	for _, method := range cfg.AllowedMethods {
+		if method != strings.ToUpper(method) || method == "" {
+			return fmt.Errorf("invalid allowed method %q, expected an uppercase method such as GET", method)
+		}
+	}
+	for _, header := range cfg.AllowedHeaders {
+		if header == wildcard {
+			r.anyHeader = true
+			continue
+		}
+		r.headers = append(r.headers, http.CanonicalHeaderKey(header))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = r
+	return nil
+}
+
+// allowsOrigin reports whether origin may call the API
+func (r *rules) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	return r.anyOrigin || r.origins[origin] ||
+		slices.ContainsFunc(r.subdomains, func(p subdomainPattern) bool { return p.matches(origin) })
+}
+
+// allowsHeaders reports whether every header of an Access-Control-Request-Headers list is allowed
+func (r *rules) allowsHeaders(list string) bool {
+	if r.anyHeader {
+		return true
+	}
+	for header := range strings.SplitSeq(list, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !slices.Contains(r.headers, http.CanonicalHeaderKey(header)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler answers CORS preflight requests itself and adds CORS headers to the responses of next
+// Preflights are answered before authentication, as browsers send them without credentials. One
+// for an origin, method or header that isn't allowed gets a 204 without CORS headers, which the
+// browser treats as a refusal. The allowed origin is echoed rather than answered with *, so
+// responses vary by Origin.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get(originHeader)
+		if origin == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		p.mu.RLock()
+		r := p.rules
+		p.mu.RUnlock()
+
+		h := w.Header()
+		h.Add("Vary", originHeader)
+		allowed := r.allowsOrigin(origin)
+
+		method := req.Header.Get(requestMethodHeader)
+		if req.Method == http.MethodOptions && method != "" {
+			h.Add("Vary", requestMethodHeader)
+			h.Add("Vary", requestHeadersHeader)
+			requested := req.Header.Get(requestHeadersHeader)
+			if allowed && slices.Contains(r.methods, method) && r.allowsHeaders(requested) {
+				h.Set(allowOriginHeader, origin)
+				h.Set(allowMethodsHeader, strings.Join(r.methods, ", "))
+				if requested != "" {
+					h.Set(allowHeadersHeader, requested)
+				}
+				if r.credentials {
+					h.Set(allowCredentialsHeader, "true")
+				}
+				if r.maxAge > 0 {
+					h.Set(maxAgeHeader, strconv.Itoa(r.maxAge))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			h.Set(allowOriginHeader, origin)
+			if r.credentials {
+				h.Set(allowCredentialsHeader, "true")
+			}
+			if len(r.exposed) > 0 {
+				h.Set(exposeHeadersHeader, strings.Join(r.exposed, ", "))
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Initialize creates the policy of the server
+// It is updated whenever the configuration changes, and keeps its settings if the new ones are invalid
+func Initialize(cfg config.CORSConfig) (*Policy, error) {
+	p, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RegisterCallback(func(cfg *config.Config) {
+		if err := p.Update(cfg.Server.CORS); err != nil {
+			logging.GetLogger().Error("Failed to update CORS settings, keeping the previous ones", zap.Error(err))
+			return
+		}
+		logging.GetLogger().Info("Updated CORS settings",
+			zap.Strings("allowed_origins", cfg.Server.CORS.AllowedOrigins))
+	})
+	return p, nil
+}
@@ -0,0 +1,152 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"frame/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() config.CORSConfig {
+	return config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"ETag", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := New(testConfig())
+	require.NoError(t, err)
+
+	reached := false
+	handler := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(method, "/users", nil)
+		if origin != "" {
+			req.Header.Set(originHeader, origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		return serve(http.MethodOptions, origin, map[string]string{requestMethodHeader: method, requestHeadersHeader: headers})
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		rr := preflight("https://app.example.com", "DELETE", "authorization, content-type")
+		assert.False(t, reached, "preflights don't reach the handler")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "https://app.example.com", rr.Header().Get(allowOriginHeader))
+		assert.Equal(t, "GET, POST, DELETE", rr.Header().Get(allowMethodsHeader))
+		assert.Equal(t, "authorization, content-type", rr.Header().Get(allowHeadersHeader))
+		assert.Equal(t, "true", rr.Header().Get(allowCredentialsHeader))
+		assert.Equal(t, "600", rr.Header().Get(maxAgeHeader))
+		assert.Contains(t, rr.Header().Values("Vary"), originHeader)
+	})
+
+	t.Run("wildcard subdomain", func(t *testing.T) {
+		for origin, allowed := range map[string]bool{
+			"https://admin.example.org":     true,
+			"https://a.b.example.org":       true,
+			"https://example.org":           false,
+			"http://admin.example.org":      false,
+			"https://evil.com/.example.org": false,
+			"https://adminexample.org":      false,
+		} {
+			rr := preflight(origin, "GET", "")
+			assert.Equal(t, http.StatusNoContent, rr.Code, origin)
+			if allowed {
+				assert.Equal(t, origin, rr.Header().Get(allowOriginHeader), origin)
+			} else {
+				assert.Empty(t, rr.Header().Get(allowOriginHeader), origin)
+			}
+		}
+	})
+
+	t.Run("refused preflights", func(t *testing.T) {
+		for name, rr := range map[string]*httptest.ResponseRecorder{
+			"origin": preflight("https://evil.example.com", "GET", ""),
+			"method": preflight("https://app.example.com", "PATCH", ""),
+			"header": preflight("https://app.example.com", "GET", "X-Custom"),
+		} {
+			assert.Equal(t, http.StatusNoContent, rr.Code, name)
+			assert.Empty(t, rr.Header().Get(allowOriginHeader), name)
+			assert.Empty(t, rr.Header().Get(allowMethodsHeader), name)
+		}
+		assert.False(t, reached)
+	})
+
+	t.Run("actual request", func(t *testing.T) {
+		rr := serve(http.MethodGet, "https://app.example.com", nil)
+		assert.True(t, reached)
+		assert.Equal(t, "https://app.example.com", rr.Header().Get(allowOriginHeader))
+		assert.Equal(t, "ETag, Retry-After", rr.Header().Get(exposeHeadersHeader))
+		assert.Equal(t, "true", rr.Header().Get(allowCredentialsHeader))
+
+		rr = serve(http.MethodGet, "https://evil.example.com", nil)
+		assert.True(t, reached, "the browser enforces the refusal")
+		assert.Empty(t, rr.Header().Get(allowOriginHeader))
+		assert.Contains(t, rr.Header().Values("Vary"), originHeader)
+	})
+
+	t.Run("not CORS", func(t *testing.T) {
+		rr := serve(http.MethodGet, "", nil)
+		assert.True(t, reached)
+		assert.Empty(t, rr.Header().Get("Vary"))
+
+		// An OPTIONS request that isn't a preflight is left to the handler
+		serve(http.MethodOptions, "https://app.example.com", nil)
+		assert.True(t, reached)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.AllowedOrigins = []string{"https://new.example.com"}
+		require.NoError(t, policy.Update(cfg))
+		assert.Empty(t, preflight("https://app.example.com", "GET", "").Header().Get(allowOriginHeader))
+		assert.NotEmpty(t, preflight("https://new.example.com", "GET", "").Header().Get(allowOriginHeader))
+
+		// Invalid settings keep the previous ones
+		cfg.AllowedOrigins = []string{"not an origin"}
+		assert.Error(t, policy.Update(cfg))
+		assert.NotEmpty(t, preflight("https://new.example.com", "GET", "").Header().Get(allowOriginHeader))
+	})
+}
+
+func TestPolicyConfig(t *testing.T) {
+	for name, change := range map[string]func(*config.CORSConfig){
+		"no scheme":            func(c *config.CORSConfig) { c.AllowedOrigins = []string{"app.example.com"} },
+		"path":                 func(c *config.CORSConfig) { c.AllowedOrigins = []string{"https://app.example.com/ui"} },
+		"inner wildcard":       func(c *config.CORSConfig) { c.AllowedOrigins = []string{"https://app.*.example.com"} },
+		"credentials with any": func(c *config.CORSConfig) { c.AllowedOrigins = []string{"*"} },
+		"lowercase method":     func(c *config.CORSConfig) { c.AllowedMethods = []string{"get"} },
+	} {
+		cfg := testConfig()
+		change(&cfg)
+		_, err := New(cfg)
+		assert.Error(t, err, name)
+	}
+
+	cfg := testConfig()
+	cfg.AllowedOrigins, cfg.AllowCredentials = []string{"*"}, false
+	_, err := New(cfg)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,248 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// addressColumns lists the address columns in the order expected by scanAddress
+const addressColumns = `id, user_id, COALESCE(name, ''), COALESCE(street, ''), COALESCE(suite, ''),
+		COALESCE(city, ''), COALESCE(state, ''), COALESCE(zip, ''), is_primary, created_at, updated_at`
+
+// AddressRepository handles all address-related database operations
+type AddressRepository struct {
+	pool queryer
+}
+
+// NewAddressRepository creates a new AddressRepository instance
+func NewAddressRepository(pool queryer) *AddressRepository {
+	return &AddressRepository{pool: pool}
+}
+
+// scanAddress reads a single address selected with addressColumns
+func scanAddress(row pgx.Row) (*models.Address, error) {
+	addr := &models.Address{}
+	err := row.Scan(&addr.ID, &addr.UserID, &addr.Name, &addr.Street, &addr.Suite,
+		&addr.City, &addr.State, &addr.Zip, &addr.IsPrimary, &addr.CreatedAt, &addr.UpdatedAt)
+	return addr, err
+}
+
+// addressAudit describes a change to an address, before is nil when it was created and after when it was deleted
+func addressAudit(action string, before, after *models.Address) auditEntry {
+	addr := after
+	if addr == nil {
+		addr = before
+	}
+	return auditEntry{action: action, entity: entityAddress, entityID: addr.ID, userID: &addr.UserID, before: before, after: after}
+}
+
+// lockAddress reads an address of the given user and locks its row until the transaction ends
+// Returns ErrNotFound if the address doesn't exist or belongs to another user
+func lockAddress(ctx context.Context, q queryer, userID, id uuid.UUID) (*models.Address, error) {
+	query := `
+		SELECT ` + addressColumns + `
+		FROM address
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`
+
+	addr, err := scanAddress(q.QueryRow(ctx, query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("address %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error locking address", err)
+	}
+	return addr, nil
+}
+
+// clearPrimary unmarks the current primary address of a user, except for the given address
+func clearPrimary(ctx context.Context, q queryer, userID, exceptID uuid.UUID) error {
+	query := `
+		UPDATE address
+		SET is_primary = false, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND is_primary AND id <> $2 AND deleted_at IS NULL
+		RETURNING id`
+
+	rows, err := q.Query(ctx, query, userID, exceptID)
+	if err != nil {
+		return wrapError("error clearing primary address", err)
+	}
+	var cleared []auditEntry
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return wrapError("error scanning cleared address", err)
+		}
+		cleared = append(cleared, auditEntry{
+			action:   AuditUpdate,
+			entity:   entityAddress,
+			entityID: id,
+			userID:   &userID,
+			before:   map[string]any{"is_primary": true},
+			after:    map[string]any{"is_primary": false},
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return wrapError("error clearing primary address", err)
+	}
+
+	return recordChanges(ctx, q, cleared...)
+}
+
+// Create inserts a new address for addr.UserID
+// When addr.IsPrimary is set, any other primary address of the user is unmarked
+// Returns ErrNotFound if the user doesn't exist and ErrConflict if a concurrent request made
+// another address primary
+func (r *AddressRepository) Create(ctx context.Context, addr *models.Address) (*models.Address, error) {
+	query := `
+		INSERT INTO address (id, user_id, name, street, suite, city, state, zip, is_primary, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9,
+			CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + addressColumns
+
+	id := uuid.New()
+	var created *models.Address
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		if addr.IsPrimary {
+			if err := clearPrimary(ctx, q, addr.UserID, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		created, err = scanAddress(q.QueryRow(ctx, query, id, addr.UserID, addr.Name, addr.Street, addr.Suite,
+			addr.City, addr.State, addr.Zip, addr.IsPrimary))
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("user %w: %s", ErrNotFound, addr.UserID)
+		}
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: another primary address was set for user %s at the same time", ErrConflict, addr.UserID)
+		}
+		if err != nil {
+			return wrapError("error creating address", err)
+		}
+		return recordChanges(ctx, q, addressAudit(AuditCreate, nil, created))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetByID retrieves an address of the given user by its ID
+// Returns ErrNotFound if the address doesn't exist or belongs to another user
+func (r *AddressRepository) GetByID(ctx context.Context, userID, id uuid.UUID) (*models.Address, error) {
+	query := `
+		SELECT ` + addressColumns + `
+		FROM address
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	addr, err := scanAddress(r.pool.QueryRow(ctx, query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("address %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error getting address by ID", err)
+	}
+
+	return addr, nil
+}
+
+// ListByUser retrieves all addresses of a user, primary address first
+func (r *AddressRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Address, error) {
+	query := `
+		SELECT ` + addressColumns + `
+		FROM address
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY is_primary DESC, created_at, id`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, wrapError("error listing addresses", err)
+	}
+	defer rows.Close()
+
+	addresses := []models.Address{}
+	for rows.Next() {
+		addr, err := scanAddress(rows)
+		if err != nil {
+			return nil, wrapError("error scanning address", err)
+		}
+		addresses = append(addresses, *addr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("error listing addresses", err)
+	}
+
+	return addresses, nil
+}
+
+// Update replaces all fields of an existing address
+// When addr.IsPrimary is set, any other primary address of the user is unmarked
+// Returns ErrNotFound if the address doesn't exist or belongs to another user and ErrConflict if a
+// concurrent request made another address primary
+func (r *AddressRepository) Update(ctx context.Context, addr *models.Address) (*models.Address, error) {
+	query := `
+		UPDATE address
+		SET name = NULLIF($3, ''), street = NULLIF($4, ''), suite = NULLIF($5, ''), city = NULLIF($6, ''),
+			state = NULLIF($7, ''), zip = NULLIF($8, ''), is_primary = $9, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + addressColumns
+
+	var updated *models.Address
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		before, err := lockAddress(ctx, q, addr.UserID, addr.ID)
+		if err != nil {
+			return err
+		}
+
+		if addr.IsPrimary {
+			if err := clearPrimary(ctx, q, addr.UserID, addr.ID); err != nil {
+				return err
+			}
+		}
+
+		updated, err = scanAddress(q.QueryRow(ctx, query, addr.ID, addr.UserID, addr.Name, addr.Street, addr.Suite,
+			addr.City, addr.State, addr.Zip, addr.IsPrimary))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: another primary address was set for user %s at the same time", ErrConflict, addr.UserID)
+		}
+		if err != nil {
+			return wrapError("error updating address", err)
+		}
+		return recordChanges(ctx, q, addressAudit(AuditUpdate, before, updated))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Delete removes an address of the given user
+// Returns ErrNotFound if the address doesn't exist or belongs to another user
+func (r *AddressRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+		DELETE FROM address
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING ` + addressColumns
+
+	return inTx(ctx, r.pool, func(q queryer) error {
+		deleted, err := scanAddress(q.QueryRow(ctx, query, id, userID))
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("address %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return wrapError("error deleting address", err)
+		}
+		return recordChanges(ctx, q, addressAudit(AuditDelete, deleted, nil))
+	})
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressRepository_Unit(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	addressID := uuid.New()
+	now := time.Now().UTC()
+
+	addressRow := func(isPrimary bool) *mockRow {
+		return &mockRow{vals: []interface{}{
+			addressID, userID, "Home", "1 Main St", "", "Springfield", "IL", "62701", isPrimary, now, now,
+		}}
+	}
+
+	t.Run("Create primary address clears previous primary", func(t *testing.T) {
+		cleared := false
+		previousID := uuid.New()
+		mock := &mockPool{
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				cleared = true
+				assert.Equal(t, userID, args[0])
+				return &mockRows{rows: [][]interface{}{{previousID}}}, nil
+			},
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				assert.True(t, cleared, "primary must be cleared before insert")
+				assert.Equal(t, userID, args[1])
+				return addressRow(true)
+			},
+		}
+
+		repo := NewAddressRepository(mock)
+		addr, err := repo.Create(ctx, &models.Address{UserID: userID, Name: "Home", IsPrimary: true})
+		require.NoError(t, err)
+		assert.True(t, cleared)
+		assert.Equal(t, addressID, addr.ID)
+		assert.Equal(t, "Springfield", addr.City)
+		assert.True(t, addr.IsPrimary)
+
+		// Both the cleared primary and the new address are audited
+		require.Len(t, mock.audits, 2)
+		assert.Equal(t, previousID, mock.audits[0][4])
+		assert.JSONEq(t, `{"is_primary":true}`, string(mock.audits[0][6].([]byte)))
+		assert.Equal(t, AuditCreate, mock.audits[1][2])
+		assert.Nil(t, mock.audits[1][6])
+	})
+
+	t.Run("Create secondary address keeps primary", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return addressRow(false)
+			},
+		}
+
+		repo := NewAddressRepository(mock)
+		addr, err := repo.Create(ctx, &models.Address{UserID: userID, Name: "Work"})
+		require.NoError(t, err)
+		assert.False(t, addr.IsPrimary)
+	})
+
+	t.Run("Create primary address racing another", func(t *testing.T) {
+		mock := &mockPool{
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				return &mockRows{}, nil
+			},
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				// The other request committed its primary address after ours was cleared
+				return &mockRow{err: &pgconn.PgError{Code: "23505"}}
+			},
+		}
+
+		repo := NewAddressRepository(mock)
+		_, err := repo.Create(ctx, &models.Address{UserID: userID, Name: "Home", IsPrimary: true})
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("Create for missing user", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: &pgconn.PgError{Code: "23503"}}
+			},
+		}
+
+		repo := NewAddressRepository(mock)
+		_, err := repo.Create(ctx, &models.Address{UserID: userID})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("GetByID not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				assert.Equal(t, addressID, args[0])
+				assert.Equal(t, userID, args[1])
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewAddressRepository(mock)
+		_, err := repo.GetByID(ctx, userID, addressID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Delete not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewAddressRepository(mock)
+		err := repo.Delete(ctx, userID, addressID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// apiKeyColumns lists the API key columns in the order expected by scanAPIKey
+const apiKeyColumns = `id, name, prefix, hash, scopes, created_at, last_used_at, revoked_at`
+
+// APIKeyRepository stores the hashes of the API keys clients authenticate with
+type APIKeyRepository struct {
+	pool queryer
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository instance
+func NewAPIKeyRepository(pool queryer) *APIKeyRepository {
+	return &APIKeyRepository{pool: pool}
+}
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	k := &models.APIKey{}
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &k.Scopes, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+	return k, err
+}
+
+// Create stores a new API key under name, identified by prefix and granted scopes
+// Returns ErrConflict if another key has the same prefix
+func (r *APIKeyRepository) Create(ctx context.Context, name, prefix string, hash []byte, scopes []string) (*models.APIKey, error) {
+	query := `
+		INSERT INTO api_keys (id, name, prefix, hash, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		RETURNING ` + apiKeyColumns
+
+	key, err := scanAPIKey(r.pool.QueryRow(ctx, query, uuid.New(), name, prefix, hash, scopes))
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: an API key with prefix %s already exists", ErrConflict, prefix)
+	}
+	if err != nil {
+		return nil, wrapError("error creating API key", err)
+	}
+	return key, nil
+}
+
+// GetActiveByPrefix retrieves the key with the given prefix unless it has been revoked
+// Returns ErrNotFound if there is no such key or it was revoked
+func (r *APIKeyRepository) GetActiveByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE prefix = $1 AND revoked_at IS NULL`
+
+	key, err := scanAPIKey(r.pool.QueryRow(ctx, query, prefix))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("API key %w: %s", ErrNotFound, prefix)
+	}
+	if err != nil {
+		return nil, wrapError("error getting API key", err)
+	}
+	return key, nil
+}
+
+// List retrieves every API key, revoked ones included, oldest first
+func (r *APIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		ORDER BY created_at, id`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, wrapError("error listing API keys", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, wrapError("error scanning API key", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("error listing API keys", err)
+	}
+	return keys, nil
+}
+
+// Revoke stops the key with the given prefix from authenticating
+// Returns ErrNotFound if there is no such key or it is already revoked
+func (r *APIKeyRepository) Revoke(ctx context.Context, prefix string) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE prefix = $1 AND revoked_at IS NULL`
+
+	tag, err := r.pool.Exec(ctx, query, prefix)
+	if err != nil {
+		return wrapError("error revoking API key", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("API key %w: %s", ErrNotFound, prefix)
+	}
+	return nil
+}
+
+// TouchLastUsed stores when each key was last used in a single statement
+// Times older than the stored one are ignored, so flushes from several instances can't move it back
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, used map[uuid.UUID]time.Time) error {
+	if len(used) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(used))
+	times := make([]time.Time, 0, len(used))
+	for id, t := range used {
+		ids = append(ids, id)
+		times = append(times, t)
+	}
+
+	query := `
+		UPDATE api_keys k
+		SET last_used_at = u.used_at
+		FROM unnest($1::uuid[], $2::timestamptz[]) AS u(id, used_at)
+		WHERE k.id = u.id AND (k.last_used_at IS NULL OR k.last_used_at < u.used_at)`
+
+	if _, err := r.pool.Exec(ctx, query, ids, times); err != nil {
+		return wrapError("error recording API key use", err)
+	}
+	return nil
+}
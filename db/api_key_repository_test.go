@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyRepository_Unit(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	now := time.Now().UTC()
+
+	t.Run("GetActiveByPrefix", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				assert.Contains(t, sql, "revoked_at IS NULL")
+				assert.Equal(t, "abcdefgh", args[0])
+				return &mockRow{vals: []interface{}{id, "ci", "abcdefgh", []byte{1, 2}, []string{"users:read"}, now, nil, nil}}
+			},
+		}
+
+		key, err := NewAPIKeyRepository(mock).GetActiveByPrefix(ctx, "abcdefgh")
+		require.NoError(t, err)
+		assert.Equal(t, id, key.ID)
+		assert.Equal(t, "ci", key.Name)
+		assert.Equal(t, []byte{1, 2}, key.Hash)
+		assert.Equal(t, []string{"users:read"}, key.Scopes)
+		assert.Nil(t, key.LastUsedAt)
+	})
+
+	t.Run("GetActiveByPrefix not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		_, err := NewAPIKeyRepository(mock).GetActiveByPrefix(ctx, "abcdefgh")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Revoke not found", func(t *testing.T) {
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				return pgconn.NewCommandTag("UPDATE 0"), nil
+			},
+		}
+
+		err := NewAPIKeyRepository(mock).Revoke(ctx, "abcdefgh")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("TouchLastUsed", func(t *testing.T) {
+		calls := 0
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				calls++
+				assert.Contains(t, sql, "unnest($1::uuid[], $2::timestamptz[])")
+				assert.Equal(t, []uuid.UUID{id}, args[0])
+				assert.Equal(t, []time.Time{now}, args[1])
+				return pgconn.NewCommandTag("UPDATE 1"), nil
+			},
+		}
+
+		repo := NewAPIKeyRepository(mock)
+		require.NoError(t, repo.TouchLastUsed(ctx, nil))
+		assert.Equal(t, 0, calls, "nothing to record doesn't write")
+		require.NoError(t, repo.TouchLastUsed(ctx, map[uuid.UUID]time.Time{id: now}))
+		assert.Equal(t, 1, calls)
+	})
+}
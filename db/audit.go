@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Entities recorded in the audit log
+const (
+	entityUser     = "user"
+	entityAddress  = "address"
+	entityPhone    = "phone"
+	entityExercise = "exercise"
+)
+
+// auditContextKey keys the audit attribution stored in a context
+type auditContextKey int
+
+const (
+	actorKey auditContextKey = iota
+	requestIDKey
+)
+
+// WithActor returns a context whose writes are attributed to actor in the audit log
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// WithRequestID returns a context whose writes are recorded with the ID of the request making them
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// contextString returns the string stored under key, empty when there is none
+func contextString(ctx context.Context, key auditContextKey) string {
+	s, _ := ctx.Value(key).(string)
+	return s
+}
+
+// auditEntry describes a change to be appended to the audit log
+// before and after are models, or maps of column names, and either may be nil
+type auditEntry struct {
+	action   string
+	entity   string
+	entityID uuid.UUID
+	userID   *uuid.UUID
+	before   any
+	after    any
+}
+
+// writeAudit appends entries to the audit log using q, which must be the transaction making the change
+func writeAudit(ctx context.Context, q queryer, entries ...auditEntry) error {
+	query := `
+		INSERT INTO audit_log (id, actor, action, entity, entity_id, user_id, before, after, request_id, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, NULLIF($9, ''), clock_timestamp())`
+
+	for _, e := range entries {
+		before, after, err := diff(e.before, e.after)
+		if err != nil {
+			return fmt.Errorf("error recording %s of %s %s: %v", e.action, e.entity, e.entityID, err)
+		}
+
+		_, err = q.Exec(ctx, query, uuid.New(), contextString(ctx, actorKey), e.action, e.entity, e.entityID, e.userID,
+			before, after, contextString(ctx, requestIDKey))
+		if err != nil {
+			return wrapError("error writing audit log", err)
+		}
+	}
+	return nil
+}
+
+// diff encodes the fields of before and after that differ, dropping those they share
+// A nil side is encoded as nil so it's stored as NULL
+func diff(before, after any) ([]byte, []byte, error) {
+	b, err := snapshot(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := snapshot(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if b != nil && a != nil {
+		for name, value := range a {
+			if old, ok := b[name]; ok && reflect.DeepEqual(old, value) {
+				delete(a, name)
+				delete(b, name)
+			}
+		}
+	}
+
+	return encodeSnapshot(b), encodeSnapshot(a), nil
+}
+
+// snapshot converts a model to a map of its fields keyed by their snake_case names
+func snapshot(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		// A nil pointer to a model encodes as null
+		return nil, err
+	}
+
+	named := make(map[string]any, len(fields))
+	for name, value := range fields {
+		named[snakeCase(name)] = value
+	}
+	return named, nil
+}
+
+func encodeSnapshot(fields map[string]any) []byte {
+	if fields == nil {
+		return nil
+	}
+	data, _ := json.Marshal(fields) // values decoded from JSON always marshal
+	return data
+}
+
+// snakeCase converts a Go field name such as UserID to user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (nextLower && unicode.IsUpper(runes[i-1])) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// AuditFilter restricts the audit entries returned by ListByUser
+type AuditFilter struct {
+	From time.Time // only entries made at or after this time when set
+	To   time.Time // only entries made before this time when set
+}
+
+// AuditRepository reads the audit log
+type AuditRepository struct {
+	pool queryer
+}
+
+// NewAuditRepository creates a new AuditRepository instance
+func NewAuditRepository(pool queryer) *AuditRepository {
+	return &AuditRepository{pool: pool}
+}
+
+// ListByUser retrieves one page of the changes made to a user and the records belonging to them
+// Entries outlive the user, so the history of a purged user can still be read
+// Returns the entries and the cursor of the next page, which is empty on the last page
+func (r *AuditRepository) ListByUser(ctx context.Context, userID uuid.UUID, filter AuditFilter, page PageRequest) ([]models.AuditEntry, string, error) {
+	q := NewListQuery(`
+		SELECT id, COALESCE(actor, ''), action, entity, entity_id, user_id, before, after, COALESCE(request_id, ''), created_at
+		FROM audit_log`, nil)
+	q.Where("user_id = " + q.Arg(userID))
+	if !filter.From.IsZero() {
+		q.Where("created_at >= " + q.Arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		q.Where("created_at < " + q.Arg(filter.To))
+	}
+
+	query, args, err := q.Build(page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", wrapError("error listing audit log", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, "", wrapError("error scanning audit entry", err)
+		}
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", wrapError("error listing audit log", err)
+	}
+
+	entries, next := NextPage(entries, page, func(e models.AuditEntry) Cursor {
+		return Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+	return entries, next, nil
+}
+
+func scanAuditEntry(row pgx.Row) (*models.AuditEntry, error) {
+	e := &models.AuditEntry{}
+	err := row.Scan(&e.ID, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &e.UserID, &e.Before, &e.After, &e.RequestID, &e.CreatedAt)
+	return e, err
+}
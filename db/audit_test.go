@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"ID":        "id",
+		"UserID":    "user_id",
+		"FirstName": "first_name",
+		"IsPrimary": "is_primary",
+		"HTTPCode":  "http_code",
+	} {
+		assert.Equal(t, want, snakeCase(name))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	before := &models.Phone{ID: uuid.New(), Name: "home", Number: "+14155552671", CreatedAt: now, UpdatedAt: now}
+
+	t.Run("created", func(t *testing.T) {
+		b, a, err := diff(nil, before)
+		require.NoError(t, err)
+		assert.Nil(t, b)
+		assert.Contains(t, string(a), `"number":"+14155552671"`)
+	})
+
+	t.Run("changed fields only", func(t *testing.T) {
+		after := *before
+		after.Name = "mobile"
+		after.UpdatedAt = now.Add(time.Minute)
+
+		b, a, err := diff(before, &after)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name":"home","updated_at":"2026-10-17T10:00:00Z"}`, string(b))
+		assert.JSONEq(t, `{"name":"mobile","updated_at":"2026-10-17T10:01:00Z"}`, string(a))
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		var none *models.Phone
+		b, a, err := diff(before, none)
+		require.NoError(t, err)
+		assert.NotNil(t, b)
+		assert.Nil(t, a)
+	})
+}
+
+func TestWriteAuditUsesContext(t *testing.T) {
+	mock := &mockPool{}
+	ctx := WithRequestID(WithActor(context.Background(), "system"), "req-1")
+	id := uuid.New()
+
+	require.NoError(t, writeAudit(ctx, mock, auditEntry{action: AuditPurge, entity: entityExercise, entityID: id}))
+	require.Len(t, mock.audits, 1)
+	assert.Equal(t, "system", mock.audits[0][1])
+	assert.Equal(t, "req-1", mock.audits[0][8])
+}
+
+func TestAuditRepository_ListByUser(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	entryID := uuid.New()
+
+	mock := &mockPool{
+		queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+			assert.Contains(t, sql, "WHERE user_id = $1 AND created_at >= $2")
+			assert.NotContains(t, sql, "created_at <")
+			assert.Equal(t, []interface{}{userID, from, 3}, args)
+			return &mockRows{rows: [][]interface{}{
+				{entryID, "", AuditUpdate, entityUser, userID, &userID, nil, nil, "req-1", from.Add(time.Hour)},
+			}}, nil
+		},
+	}
+
+	repo := NewAuditRepository(mock)
+	entries, next, err := repo.ListByUser(ctx, userID, AuditFilter{From: from}, PageRequest{Limit: 2})
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, entries, 1)
+	assert.Equal(t, entryID, entries[0].ID)
+	assert.Equal(t, AuditUpdate, entries[0].Action)
+	assert.Equal(t, "req-1", entries[0].RequestID)
+}
@@ -2,11 +2,14 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"frame/config"
+	"frame/health"
 	"frame/logging"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -19,8 +22,42 @@ var (
 	mu             sync.RWMutex
 	ctx            context.Context
 	pingCancelFunc context.CancelFunc
+	pings          pingState
+	reconnecting   atomic.Bool
 )
 
+// errNotConnected is returned by pings made while there is no pool
+var errNotConnected = errors.New("not connected to the database")
+
+// pingState counts the pings that failed in a row, whether made periodically or by readiness checks
+type pingState struct {
+	mu       sync.Mutex
+	failures int
+	lastErr  error
+}
+
+// record adds the outcome of a ping
+func (s *pingState) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.failures, s.lastErr = 0, nil
+		return
+	}
+	s.failures++
+	s.lastErr = err
+}
+
+// failing returns the last ping error once threshold pings in a row failed, nil before
+func (s *pingState) failing(threshold int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures < max(threshold, 1) {
+		return nil
+	}
+	return fmt.Errorf("last %d pings failed: %w", s.failures, s.lastErr)
+}
+
 // Initialize creates a connection pool to the PostgreSQL database
 func Initialize(initCtx context.Context) error {
 	// Create a new context with cancel for the ping routine
@@ -33,11 +70,18 @@ func Initialize(initCtx context.Context) error {
 	// Start the periodic ping routine
 	go startPingRoutine()
 
+	// The server isn't ready while the database is unreachable
+	health.Register("database", Check)
+
 	// Register callback for config changes
 	config.RegisterCallback(func(cfg *config.Config) {
 		logger := logging.GetLogger()
 		logger.Info("Reconnecting to database due to configuration change")
 
+		// Readiness fails until the new pool is connected
+		reconnecting.Store(true)
+		defer reconnecting.Store(false)
+
 		mu.Lock()
 		defer mu.Unlock()
 
@@ -47,7 +91,10 @@ func Initialize(initCtx context.Context) error {
 		}
 
 		// Reconnect with new configuration
-		if err := connect(); err != nil {
+		// A failure counts as a failed ping, the periodic pings then fail until the next change
+		err := connect()
+		pings.record(err)
+		if err != nil {
 			logger.Error("Failed to reconnect to database",
 				zap.Error(err))
 		}
@@ -74,6 +121,7 @@ func connect() error {
 	if err != nil {
 		return fmt.Errorf("error parsing database config: %v", err)
 	}
+	config.ConnConfig.Tracer = queryTracer{}
 
 	newPool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
@@ -97,10 +145,23 @@ func GetPool() *pgxpool.Pool {
 	return pool
 }
 
-// startPingRoutine starts a goroutine that pings the database every minute
+// ping pings the database and records the outcome for Check
+func ping(ctx context.Context) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	err := errNotConnected
+	if pool != nil {
+		err = pool.Ping(ctx)
+	}
+	pings.record(err)
+	return err
+}
+
+// startPingRoutine starts a goroutine that pings the database every database.ping_interval
 func startPingRoutine() {
 	logger := logging.GetLogger()
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := time.NewTicker(viper.Get("config").(*config.Config).Database.PingInterval)
 	defer ticker.Stop()
 
 	for {
@@ -109,20 +170,31 @@ func startPingRoutine() {
 			logger.Info("Stopping database ping routine")
 			return
 		case <-ticker.C:
-			mu.RLock()
-			if pool != nil {
-				if err := pool.Ping(ctx); err != nil {
-					logger.Error("Database ping failed",
-						zap.Error(err))
-				} else {
-					logger.Debug("Database ping successful")
-				}
+			if err := ping(ctx); err != nil {
+				logger.Error("Database ping failed",
+					zap.Error(err))
+			} else {
+				logger.Debug("Database ping successful")
 			}
-			mu.RUnlock()
 		}
 	}
 }
 
+// Check is the readiness check of the database
+// It pings the database, and fails while reconnecting after a configuration change or once the
+// last database.ping_failure_threshold pings failed, so a single lost ping doesn't take the server
+// out of rotation.
+func Check(ctx context.Context) error {
+	if reconnecting.Load() {
+		return errors.New("reconnecting after a configuration change")
+	}
+	if err := ping(ctx); err != nil {
+		logging.FromContext(ctx).Warn("Database readiness ping failed",
+			zap.Error(err))
+	}
+	return pings.failing(viper.Get("config").(*config.Config).Database.PingFailureThreshold)
+}
+
 // Close closes the database connection pool and stops the ping routine
 func Close() {
 	if pingCancelFunc != nil {
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"frame/config"
+	"frame/logging"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingState(t *testing.T) {
+	var s pingState
+	assert.NoError(t, s.failing(2))
+
+	s.record(errors.New("connection refused"))
+	assert.NoError(t, s.failing(2), "a single failed ping is tolerated")
+
+	s.record(errors.New("timeout"))
+	assert.EqualError(t, s.failing(2), "last 2 pings failed: timeout")
+
+	s.record(nil)
+	assert.NoError(t, s.failing(2), "a successful ping resets the count")
+
+	// A threshold below 1 fails on the first failed ping
+	s.record(errors.New("timeout"))
+	assert.Error(t, s.failing(0))
+}
+
+func TestCheck(t *testing.T) {
+	viper.Set("config", &config.Config{Database: config.DatabaseConfig{PingFailureThreshold: 2}})
+	require.NoError(t, logging.Initialize())
+	pings = pingState{}
+	defer func() { pings = pingState{} }()
+
+	// Without a pool every ping fails
+	assert.NoError(t, Check(context.Background()))
+	assert.ErrorIs(t, Check(context.Background()), errNotConnected)
+
+	reconnecting.Store(true)
+	defer reconnecting.Store(false)
+	assert.EqualError(t, Check(context.Background()), "reconnecting after a configuration change")
+}
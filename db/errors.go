@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write collides with existing records
+	ErrConflict = errors.New("conflict")
+	// ErrTimeout is returned when the database didn't answer in time
+	ErrTimeout = errors.New("timeout")
+	// ErrPreconditionFailed is returned when a record changed since the caller read it
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// wrapError annotates an unexpected database error, marking timeouts with ErrTimeout
+func wrapError(msg string, err error) error {
+	if isTimeout(err) {
+		return fmt.Errorf("%s: %w: %v", msg, ErrTimeout, err)
+	}
+	return fmt.Errorf("%s: %v", msg, err)
+}
+
+// isTimeout reports whether err was caused by a deadline, statement timeout or lock timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	// 57014 is query_canceled (statement_timeout), 55P03 is lock_not_available (lock_timeout)
+	return errors.As(err, &pgErr) && (pgErr.Code == "57014" || pgErr.Code == "55P03")
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err was caused by a foreign key constraint violation
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
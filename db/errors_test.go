@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantTimeout bool
+	}{
+		{name: "context deadline", err: context.DeadlineExceeded, wantTimeout: true},
+		{name: "statement timeout", err: &pgconn.PgError{Code: "57014"}, wantTimeout: true},
+		{name: "lock timeout", err: &pgconn.PgError{Code: "55P03"}, wantTimeout: true},
+		{name: "syntax error", err: &pgconn.PgError{Code: "42601"}},
+		{name: "plain error", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapError("error listing users", tt.err)
+			assert.Contains(t, err.Error(), "error listing users: ")
+			assert.Equal(t, tt.wantTimeout, errors.Is(err, ErrTimeout))
+		})
+	}
+}
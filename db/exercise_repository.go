@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// exerciseColumns lists the exercise columns in the order expected by scanExercise
+const exerciseColumns = `id, name, created_at, updated_at`
+
+// ExerciseRepository handles all exercise catalog database operations
+type ExerciseRepository struct {
+	pool queryer
+}
+
+// NewExerciseRepository creates a new ExerciseRepository instance
+func NewExerciseRepository(pool queryer) *ExerciseRepository {
+	return &ExerciseRepository{pool: pool}
+}
+
+// NormalizeExerciseName trims the name and collapses runs of whitespace into single spaces
+// Names are compared case-insensitively after normalization
+func NormalizeExerciseName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// scanExercise reads a single exercise selected with exerciseColumns
+func scanExercise(row pgx.Row) (*models.Exercise, error) {
+	e := &models.Exercise{}
+	err := row.Scan(&e.ID, &e.Name, &e.CreatedAt, &e.UpdatedAt)
+	return e, err
+}
+
+// exerciseAudit describes a change to an exercise, before is nil when it was created and after when it was deleted
+func exerciseAudit(action string, before, after *models.Exercise) auditEntry {
+	e := after
+	if e == nil {
+		e = before
+	}
+	return auditEntry{action: action, entity: entityExercise, entityID: e.ID, before: before, after: after}
+}
+
+// Create inserts a new exercise with a normalized name
+// Returns ErrConflict if an exercise with the same normalized name exists
+func (r *ExerciseRepository) Create(ctx context.Context, name string) (*models.Exercise, error) {
+	name = NormalizeExerciseName(name)
+
+	query := `
+		INSERT INTO exercise_names (id, name, created_at, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + exerciseColumns
+
+	var created *models.Exercise
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		var err error
+		created, err = scanExercise(q.QueryRow(ctx, query, uuid.New(), name))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: exercise %q already exists", ErrConflict, name)
+		}
+		if err != nil {
+			return wrapError("error creating exercise", err)
+		}
+		return writeAudit(ctx, q, exerciseAudit(AuditCreate, nil, created))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetByID retrieves an exercise by its ID
+// Returns ErrNotFound if the exercise doesn't exist
+func (r *ExerciseRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Exercise, error) {
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercise_names
+		WHERE id = $1`
+
+	e, err := scanExercise(r.pool.QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("exercise %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error getting exercise by ID", err)
+	}
+
+	return e, nil
+}
+
+// List retrieves all exercises ordered by name
+func (r *ExerciseRepository) List(ctx context.Context) ([]models.Exercise, error) {
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercise_names
+		ORDER BY lower(name)`
+
+	return r.query(ctx, query)
+}
+
+// Search retrieves up to limit exercises whose normalized name starts with prefix, ignoring case
+// The lookup is a range scan of the text_pattern_ops index on lower(name)
+func (r *ExerciseRepository) Search(ctx context.Context, prefix string, limit int) ([]models.Exercise, error) {
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercise_names
+		WHERE lower(name) ~>=~ $1 AND lower(name) ~<~ $2
+		ORDER BY lower(name)
+		LIMIT $3`
+
+	from, to := prefixRange(NormalizeExerciseName(prefix))
+	return r.query(ctx, query, from, to, limit)
+}
+
+// query runs a SELECT of exerciseColumns and collects the results
+func (r *ExerciseRepository) query(ctx context.Context, query string, args ...any) ([]models.Exercise, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError("error listing exercises", err)
+	}
+	defer rows.Close()
+
+	exercises := []models.Exercise{}
+	for rows.Next() {
+		e, err := scanExercise(rows)
+		if err != nil {
+			return nil, wrapError("error scanning exercise", err)
+		}
+		exercises = append(exercises, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("error listing exercises", err)
+	}
+
+	return exercises, nil
+}
+
+// Rename changes the name of an existing exercise
+// Returns ErrNotFound if the exercise doesn't exist and ErrConflict if the new name is taken
+func (r *ExerciseRepository) Rename(ctx context.Context, id uuid.UUID, name string) (*models.Exercise, error) {
+	name = NormalizeExerciseName(name)
+
+	query := `
+		UPDATE exercise_names
+		SET name = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + exerciseColumns
+
+	var renamed *models.Exercise
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		before, err := scanExercise(q.QueryRow(ctx, `
+			SELECT `+exerciseColumns+`
+			FROM exercise_names
+			WHERE id = $1
+			FOR UPDATE`, id))
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("exercise %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return wrapError("error locking exercise", err)
+		}
+
+		renamed, err = scanExercise(q.QueryRow(ctx, query, id, name))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: exercise %q already exists", ErrConflict, name)
+		}
+		if err != nil {
+			return wrapError("error renaming exercise", err)
+		}
+		return writeAudit(ctx, q, exerciseAudit(AuditUpdate, before, renamed))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renamed, nil
+}
+
+// Delete removes an exercise by its ID
+// Returns ErrNotFound if the exercise doesn't exist
+func (r *ExerciseRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		DELETE FROM exercise_names
+		WHERE id = $1
+		RETURNING ` + exerciseColumns
+
+	return inTx(ctx, r.pool, func(q queryer) error {
+		deleted, err := scanExercise(q.QueryRow(ctx, query, id))
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("exercise %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return wrapError("error deleting exercise", err)
+		}
+		return writeAudit(ctx, q, exerciseAudit(AuditDelete, deleted, nil))
+	})
+}
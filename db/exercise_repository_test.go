@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeExerciseName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "already normalized", in: "Bench Press", want: "Bench Press"},
+		{name: "surrounding whitespace", in: "  Bench Press\t", want: "Bench Press"},
+		{name: "inner whitespace runs", in: "Bench \t  Press", want: "Bench Press"},
+		{name: "case is preserved", in: "bench PRESS", want: "bench PRESS"},
+		{name: "only whitespace", in: " \n ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NormalizeExerciseName(tt.in))
+		})
+	}
+}
+
+func TestExerciseRepository_Unit(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create stores normalized name", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				assert.Equal(t, "Bench Press", args[1])
+				return &mockRow{err: &pgconn.PgError{Code: "23505"}}
+			},
+		}
+
+		repo := NewExerciseRepository(mock)
+		_, err := repo.Create(ctx, "  Bench   Press ")
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("Search matches wildcards literally", func(t *testing.T) {
+		mock := &mockPool{
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				assert.NotContains(t, sql, "LIKE")
+				assert.Equal(t, "100% _rep", args[0])
+				assert.Equal(t, "100% _rep\U0010FFFF", args[1])
+				assert.Equal(t, 5, args[2])
+				return nil, assert.AnError
+			},
+		}
+
+		repo := NewExerciseRepository(mock)
+		_, err := repo.Search(ctx, " 100%  _Rep", 5)
+		assert.Error(t, err)
+	})
+
+	t.Run("Rename not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewExerciseRepository(mock)
+		_, err := repo.Rename(ctx, uuid.New(), "Squat")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
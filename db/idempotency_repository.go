@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"frame/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// idempotencyColumns lists the idempotency key columns in the order expected by scanIdempotencyKey
+const idempotencyColumns = `principal, key, method, path, request_hash, COALESCE(status_code, 0),
+	COALESCE(headers, '{}'::jsonb), COALESCE(body, ''::bytea), created_at, expires_at`
+
+// IdempotencyRepository stores Idempotency-Key headers and the responses they produced
+type IdempotencyRepository struct {
+	pool queryer
+}
+
+// NewIdempotencyRepository creates a new IdempotencyRepository instance
+func NewIdempotencyRepository(pool queryer) *IdempotencyRepository {
+	return &IdempotencyRepository{pool: pool}
+}
+
+// scanIdempotencyKey reads a single idempotency key selected with idempotencyColumns
+func scanIdempotencyKey(row pgx.Row) (*models.IdempotencyKey, error) {
+	k := &models.IdempotencyKey{}
+	err := row.Scan(&k.Principal, &k.Key, &k.Method, &k.Path, &k.RequestHash, &k.StatusCode, &k.Headers,
+		&k.Body, &k.CreatedAt, &k.ExpiresAt)
+	return k, err
+}
+
+// Reserve claims key for a request of principal to method and path with the given body hash until
+// ttl has passed, and holds it for the request until lease has passed
+// Returns the new key and true when the request should be processed, or the key stored by an
+// earlier request of the same principal and false when it should not. Expired keys are claimed
+// again as if they were new, and so are keys whose request never completed within its lease, such
+// as when the server was killed while running it.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, principal, key, method, path, requestHash string, ttl, lease time.Duration) (*models.IdempotencyKey, bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (principal, key, method, path, request_hash, created_at, expires_at, locked_until)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(secs => $6),
+			CURRENT_TIMESTAMP + make_interval(secs => $7))
+		ON CONFLICT (principal, key, method, path) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, headers = NULL, body = NULL,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.locked_until <= CURRENT_TIMESTAMP)
+		RETURNING ` + idempotencyColumns
+
+	reserved, err := scanIdempotencyKey(r.pool.QueryRow(ctx, query, principal, key, method, path, requestHash,
+		ttl.Seconds(), lease.Seconds()))
+	if err == nil {
+		return reserved, true, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, false, wrapError("error reserving idempotency key", err)
+	}
+
+	// The key is held by an earlier request that hasn't expired
+	query = `
+		SELECT ` + idempotencyColumns + `
+		FROM idempotency_keys
+		WHERE principal = $1 AND key = $2 AND method = $3 AND path = $4`
+
+	existing, err := scanIdempotencyKey(r.pool.QueryRow(ctx, query, principal, key, method, path))
+	if err == pgx.ErrNoRows {
+		return nil, false, fmt.Errorf("idempotency key %w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, false, wrapError("error getting idempotency key", err)
+	}
+
+	return existing, false, nil
+}
+
+// Complete stores the response of the request holding key so later requests can replay it
+// The lease is dropped, as a completed key is kept until its TTL has passed.
+func (r *IdempotencyRepository) Complete(ctx context.Context, principal, key, method, path string, statusCode int, headers map[string]string, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $5, headers = $6, body = $7, locked_until = NULL
+		WHERE principal = $1 AND key = $2 AND method = $3 AND path = $4 AND status_code IS NULL`
+
+	tag, err := r.pool.Exec(ctx, query, principal, key, method, path, statusCode, headers, body)
+	if err != nil {
+		return wrapError("error completing idempotency key", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("idempotency key %w: %s", ErrNotFound, key)
+	}
+
+	return nil
+}
+
+// Release removes a key whose request failed before producing a response worth replaying
+// Completed keys are left in place
+func (r *IdempotencyRepository) Release(ctx context.Context, principal, key, method, path string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE principal = $1 AND key = $2 AND method = $3 AND path = $4 AND status_code IS NULL`
+
+	if _, err := r.pool.Exec(ctx, query, principal, key, method, path); err != nil {
+		return wrapError("error releasing idempotency key", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired removes every key whose TTL has passed and returns how many were removed
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	tag, err := r.pool.Exec(ctx, query)
+	if err != nil {
+		return 0, wrapError("error deleting expired idempotency keys", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
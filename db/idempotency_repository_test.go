@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyRepository_Unit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	expires := now.Add(24 * time.Hour)
+
+	keyRow := func(hash string, status int, body string) *mockRow {
+		return &mockRow{vals: []interface{}{"api_key:1", "key-1", "POST", "/users", hash, status,
+			map[string]string{"Content-Type": "application/json"}, []byte(body), now, expires}}
+	}
+
+	t.Run("Reserve new key", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				assert.Contains(t, sql, "ON CONFLICT (principal, key, method, path) DO UPDATE")
+				assert.Equal(t, "api_key:1", args[0])
+				assert.Equal(t, "abc", args[4])
+				assert.Equal(t, float64(86400), args[5])
+				assert.Equal(t, float64(60), args[6])
+				return keyRow("abc", 0, "")
+			},
+		}
+
+		repo := NewIdempotencyRepository(mock)
+		key, reserved, err := repo.Reserve(ctx, "api_key:1", "key-1", "POST", "/users", "abc", 24*time.Hour, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, reserved)
+		assert.False(t, key.Completed())
+	})
+
+	t.Run("Reserve existing key", func(t *testing.T) {
+		calls := 0
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				calls++
+				if strings.Contains(sql, "INSERT") {
+					return &mockRow{err: pgx.ErrNoRows}
+				}
+				return keyRow("abc", 201, `{"id":"1"}`)
+			},
+		}
+
+		repo := NewIdempotencyRepository(mock)
+		key, reserved, err := repo.Reserve(ctx, "api_key:1", "key-1", "POST", "/users", "abc", time.Hour, time.Minute)
+		require.NoError(t, err)
+		assert.False(t, reserved)
+		assert.Equal(t, 2, calls)
+		assert.True(t, key.Completed())
+		assert.Equal(t, 201, key.StatusCode)
+		assert.Equal(t, `{"id":"1"}`, string(key.Body))
+		assert.Equal(t, "application/json", key.Headers["Content-Type"])
+	})
+
+	t.Run("Reserve takes over an abandoned key", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				// A key left incomplete past its lease is claimed again, long before its TTL
+				assert.Contains(t, sql, "status_code IS NULL AND idempotency_keys.locked_until <= CURRENT_TIMESTAMP")
+				return keyRow("abc", 0, "")
+			},
+		}
+
+		repo := NewIdempotencyRepository(mock)
+		_, reserved, err := repo.Reserve(ctx, "api_key:1", "key-1", "POST", "/users", "abc", time.Hour, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, reserved)
+	})
+
+	t.Run("Complete missing key", func(t *testing.T) {
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				return pgconn.NewCommandTag("UPDATE 0"), nil
+			},
+		}
+
+		repo := NewIdempotencyRepository(mock)
+		err := repo.Complete(ctx, "api_key:1", "key-1", "POST", "/users", 201, map[string]string{"Content-Type": "application/json"}, nil)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Release only pending keys", func(t *testing.T) {
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				assert.Contains(t, sql, "status_code IS NULL")
+				return pgconn.NewCommandTag("DELETE 1"), nil
+			},
+		}
+
+		repo := NewIdempotencyRepository(mock)
+		assert.NoError(t, repo.Release(ctx, "api_key:1", "key-1", "POST", "/users"))
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				return pgconn.NewCommandTag("DELETE 3"), nil
+			},
+		}
+
+		repo := NewIdempotencyRepository(mock)
+		n, err := repo.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+	})
+}
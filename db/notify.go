@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// UserEventsChannel is the channel the outbox_notify_user_event trigger announces user events on
+const UserEventsChannel = "frame_events"
+
+// userEventNotification is the payload sent by the outbox_notify_user_event trigger
+type userEventNotification struct {
+	ID        uuid.UUID      `json:"id"`
+	Type      string         `json:"type"`
+	Entity    string         `json:"entity"`
+	EntityID  uuid.UUID      `json:"entity_id"`
+	UserID    *uuid.UUID     `json:"user_id"`
+	Before    map[string]any `json:"before"`
+	After     map[string]any `json:"after"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ListenUserEvents calls fn with every user event written to the outbox by any instance, once its
+// transaction commits. It holds a connection of the pool until ctx is done or the connection fails,
+// and events written while nobody is listening aren't announced again.
+func ListenUserEvents(ctx context.Context, fn func(models.OutboxEvent)) error {
+	p := GetPool()
+	if p == nil {
+		return fmt.Errorf("error listening for user events: database isn't connected")
+	}
+
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return wrapError("error acquiring connection", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+UserEventsChannel); err != nil {
+		return wrapError("error listening for user events", err)
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return wrapError("error waiting for user events", err)
+		}
+
+		var e userEventNotification
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			logging.GetLogger().Error("Failed to decode user event",
+				zap.String("payload", n.Payload),
+				zap.Error(err))
+			continue
+		}
+		fn(models.OutboxEvent{
+			ID:        e.ID,
+			Type:      e.Type,
+			Entity:    e.Entity,
+			EntityID:  e.EntityID,
+			UserID:    e.UserID,
+			Before:    e.Before,
+			After:     e.After,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+}
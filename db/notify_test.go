@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frame/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUserEvents_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	testPool := setupTestDB(t)
+	defer testPool.Close()
+	mu.Lock()
+	pool = testPool
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		pool = nil
+		mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	received := make(chan models.OutboxEvent, 10)
+	go func() {
+		_ = ListenUserEvents(ctx, func(e models.OutboxEvent) { received <- e })
+	}()
+	// Give the listener time to run LISTEN before writing
+	time.Sleep(200 * time.Millisecond)
+
+	user, _, err := NewUserRepository(testPool).Create(ctx, "Notify", "Me", "notify."+time.Now().Format("150405.000000")+"@example.com")
+	require.NoError(t, err)
+
+	select {
+	case e := <-received:
+		assert.Equal(t, "user.created", e.Type)
+		assert.Equal(t, user.ID, e.EntityID)
+		assert.Equal(t, "Notify", e.After["first_name"])
+	case <-ctx.Done():
+		t.Fatal("no notification received")
+	}
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Delivery states of outbox events
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// eventActions maps audit actions to the past tense used in event types
+var eventActions = map[string]string{
+	AuditCreate:  "created",
+	AuditUpdate:  "updated",
+	AuditDelete:  "deleted",
+	AuditRestore: "restored",
+	AuditPurge:   "purged",
+}
+
+// publishedEntities lists the entities whose changes are written to the outbox
+var publishedEntities = map[string]bool{
+	entityUser:    true,
+	entityAddress: true,
+	entityPhone:   true,
+}
+
+// eventType names the event of an action on an entity, such as user.created
+func eventType(entity, action string) string {
+	return entity + "." + eventActions[action]
+}
+
+// recordChanges appends entries to the audit log and publishes the changes to users,
+// addresses and phones to the outbox, using q, which must be the transaction making the change
+func recordChanges(ctx context.Context, q queryer, entries ...auditEntry) error {
+	if err := writeAudit(ctx, q, entries...); err != nil {
+		return err
+	}
+	return writeOutbox(ctx, q, entries...)
+}
+
+// writeOutbox adds an event for each entry of a published entity, ready to be delivered at once
+func writeOutbox(ctx context.Context, q queryer, entries ...auditEntry) error {
+	query := `
+		INSERT INTO outbox (id, event_type, entity, entity_id, user_id, before, after, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, clock_timestamp(), clock_timestamp())`
+
+	for _, e := range entries {
+		if !publishedEntities[e.entity] {
+			continue
+		}
+
+		before, after, err := diff(e.before, e.after)
+		if err != nil {
+			return fmt.Errorf("error publishing %s of %s %s: %v", e.action, e.entity, e.entityID, err)
+		}
+
+		_, err = q.Exec(ctx, query, uuid.New(), eventType(e.entity, e.action), e.entity, e.entityID, e.userID, before, after)
+		if err != nil {
+			return wrapError("error writing outbox", err)
+		}
+	}
+	return nil
+}
+
+// publishAudited returns the tail of a bulk write starting "WITH audited AS (INSERT INTO audit_log ... RETURNING *)"
+// which publishes every audited row as an event of the type held by the typeArg placeholder
+func publishAudited(typeArg string) string {
+	return `
+		INSERT INTO outbox (id, event_type, entity, entity_id, user_id, before, after, created_at, next_attempt_at)
+		SELECT gen_random_uuid(), ` + typeArg + `, entity, entity_id, user_id, before, after, created_at, created_at
+		FROM audited`
+}
+
+// outboxColumns lists the columns scanned by scanOutboxEvent
+const outboxColumns = `id, event_type, entity, entity_id, user_id, before, after, created_at, status, attempts,
+	next_attempt_at, delivered_to, COALESCE(last_error, ''), delivered_at`
+
+func scanOutboxEvent(row pgx.Row) (*models.OutboxEvent, error) {
+	e := &models.OutboxEvent{}
+	err := row.Scan(&e.ID, &e.Type, &e.Entity, &e.EntityID, &e.UserID, &e.Before, &e.After, &e.CreatedAt, &e.Status,
+		&e.Attempts, &e.NextAttemptAt, &e.DeliveredTo, &e.LastError, &e.DeliveredAt)
+	return e, err
+}
+
+// OutboxRepository hands outbox events to the webhook dispatcher and records their delivery
+type OutboxRepository struct {
+	pool queryer
+}
+
+// NewOutboxRepository creates a new OutboxRepository instance
+func NewOutboxRepository(pool queryer) *OutboxRepository {
+	return &OutboxRepository{pool: pool}
+}
+
+// Claim returns up to limit pending events that are due, oldest first, and leases them for lease
+// A leased event isn't claimed again until the lease ends, so several dispatchers can share the outbox
+// and an event claimed by a dispatcher that stopped is picked up once its lease runs out
+func (r *OutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE outbox
+			SET next_attempt_at = clock_timestamp() + $2::interval
+			WHERE id IN (
+				SELECT id
+				FROM outbox
+				WHERE status = 'pending' AND next_attempt_at <= clock_timestamp()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT ` + outboxColumns + `
+		FROM claimed
+		ORDER BY created_at, id`
+
+	rows, err := r.pool.Query(ctx, query, limit, lease)
+	if err != nil {
+		return nil, wrapError("error claiming outbox events", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, wrapError("error scanning outbox event", err)
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("error claiming outbox events", err)
+	}
+	return events, nil
+}
+
+// MarkDelivered records that every webhook listed in deliveredTo has accepted the event
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, id uuid.UUID, deliveredTo []string) error {
+	query := `
+		UPDATE outbox
+		SET status = 'delivered', attempts = attempts + 1, delivered_to = $2, last_error = NULL,
+			delivered_at = clock_timestamp()
+		WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, deliveredTo); err != nil {
+		return wrapError("error marking outbox event delivered", err)
+	}
+	return nil
+}
+
+// SkipPending marks every pending event delivered without sending it and returns how many were marked
+// It is used when no webhook is configured, so events don't wait in the outbox for webhooks that
+// may never come. The events were still streamed to the clients of GET /events.
+func (r *OutboxRepository) SkipPending(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE outbox
+		SET status = 'delivered', delivered_at = clock_timestamp()
+		WHERE status = 'pending'`
+
+	tag, err := r.pool.Exec(ctx, query)
+	if err != nil {
+		return 0, wrapError("error skipping pending outbox events", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteDelivered removes the events delivered before the given time and returns how many were removed
+// Dead lettered events are kept until they are replayed.
+func (r *OutboxRepository) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM outbox
+		WHERE status = 'delivered' AND delivered_at < $1`
+
+	tag, err := r.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, wrapError("error deleting delivered outbox events", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkFailed records a failed delivery attempt and when to try again
+// deliveredTo lists the webhooks that did accept the event. A zero retryAt moves the
+// event to the dead letter state, where it stays until it's replayed.
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, deliveredTo []string, lastError string, retryAt time.Time) error {
+	status, next := OutboxPending, retryAt
+	if retryAt.IsZero() {
+		status, next = OutboxDead, time.Now()
+	}
+
+	query := `
+		UPDATE outbox
+		SET status = $2, attempts = attempts + 1, delivered_to = $3, last_error = $4, next_attempt_at = $5
+		WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, status, deliveredTo, lastError, next); err != nil {
+		return wrapError("error marking outbox event failed", err)
+	}
+	return nil
+}
+
+// List retrieves one page of outbox events, only those in status when it's set
+// Returns the events and the cursor of the next page, which is empty on the last page
+func (r *OutboxRepository) List(ctx context.Context, status string, page PageRequest) ([]models.OutboxEvent, string, error) {
+	q := NewListQuery(`
+		SELECT `+outboxColumns+`
+		FROM outbox`, nil)
+	if status != "" {
+		q.Where("status = " + q.Arg(status))
+	}
+
+	query, args, err := q.Build(page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", wrapError("error listing outbox", err)
+	}
+	defer rows.Close()
+
+	events := []models.OutboxEvent{}
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, "", wrapError("error scanning outbox event", err)
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", wrapError("error listing outbox", err)
+	}
+
+	events, next := NextPage(events, page, func(e models.OutboxEvent) Cursor {
+		return Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+	return events, next, nil
+}
+
+// Replay queues an event to be delivered again to every webhook, whatever its state
+// Returns ErrNotFound if the event doesn't exist
+func (r *OutboxRepository) Replay(ctx context.Context, id uuid.UUID) (*models.OutboxEvent, error) {
+	query := `
+		UPDATE outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = clock_timestamp(), delivered_to = '{}',
+			last_error = NULL, delivered_at = NULL
+		WHERE id = $1
+		RETURNING ` + outboxColumns
+
+	event, err := scanOutboxEvent(r.pool.QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("outbox event %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error replaying outbox event", err)
+	}
+	return event, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventType(t *testing.T) {
+	assert.Equal(t, "user.created", eventType(entityUser, AuditCreate))
+	assert.Equal(t, "address.restored", eventType(entityAddress, AuditRestore))
+	assert.Equal(t, "phone.purged", eventType(entityPhone, AuditPurge))
+}
+
+func TestRecordChangesPublishesUserRecords(t *testing.T) {
+	mock := &mockPool{}
+	userID := uuid.New()
+	phoneID := uuid.New()
+
+	err := recordChanges(context.Background(), mock,
+		auditEntry{action: AuditCreate, entity: entityExercise, entityID: uuid.New()},
+		auditEntry{action: AuditDelete, entity: entityPhone, entityID: phoneID, userID: &userID,
+			before: map[string]any{"deleted_at": nil}, after: map[string]any{"deleted_at": "2026-10-17T00:00:00Z"}})
+	require.NoError(t, err)
+
+	assert.Len(t, mock.audits, 2)
+	// Exercises aren't published
+	require.Len(t, mock.events, 1)
+	assert.Equal(t, "phone.deleted", mock.events[0][1])
+	assert.Equal(t, phoneID, mock.events[0][3])
+	assert.Equal(t, &userID, mock.events[0][4])
+	assert.JSONEq(t, `{"deleted_at":"2026-10-17T00:00:00Z"}`, string(mock.events[0][6].([]byte)))
+}
+
+func TestOutboxRepository_Unit(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	now := time.Now().UTC()
+
+	t.Run("Claim", func(t *testing.T) {
+		mock := &mockPool{
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				assert.Contains(t, sql, "FOR UPDATE SKIP LOCKED")
+				assert.Equal(t, []interface{}{10, time.Minute}, args)
+				return &mockRows{rows: [][]interface{}{
+					{id, "user.created", entityUser, id, nil, nil, nil, now, OutboxPending, 2, now, []string{"http://a"}, "", nil},
+				}}, nil
+			},
+		}
+
+		events, err := NewOutboxRepository(mock).Claim(ctx, 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "user.created", events[0].Type)
+		assert.Equal(t, 2, events[0].Attempts)
+		assert.Equal(t, []string{"http://a"}, events[0].DeliveredTo)
+	})
+
+	t.Run("MarkFailed", func(t *testing.T) {
+		var status []interface{}
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				status = append(status, args[1])
+				return pgconn.NewCommandTag("UPDATE 1"), nil
+			},
+		}
+
+		repo := NewOutboxRepository(mock)
+		require.NoError(t, repo.MarkFailed(ctx, id, nil, "boom", now.Add(time.Minute)))
+		// Without a retry time the event is dead lettered
+		require.NoError(t, repo.MarkFailed(ctx, id, nil, "boom", time.Time{}))
+		assert.Equal(t, []interface{}{OutboxPending, OutboxDead}, status)
+	})
+
+	t.Run("SkipPending", func(t *testing.T) {
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				assert.Contains(t, sql, "WHERE status = 'pending'")
+				return pgconn.NewCommandTag("UPDATE 4"), nil
+			},
+		}
+
+		n, err := NewOutboxRepository(mock).SkipPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), n)
+	})
+
+	t.Run("DeleteDelivered keeps dead letters", func(t *testing.T) {
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				assert.Contains(t, sql, "status = 'delivered' AND delivered_at < $1")
+				assert.Equal(t, []interface{}{now}, args)
+				return pgconn.NewCommandTag("DELETE 2"), nil
+			},
+		}
+
+		n, err := NewOutboxRepository(mock).DeleteDelivered(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+	})
+
+	t.Run("Replay not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		_, err := NewOutboxRepository(mock).Replay(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// phoneColumns lists the phone columns in the order expected by scanPhone
+const phoneColumns = `id, user_id, name, number, created_at, updated_at`
+
+// PhoneRepository handles all phone-related database operations
+type PhoneRepository struct {
+	pool queryer
+}
+
+// NewPhoneRepository creates a new PhoneRepository instance
+func NewPhoneRepository(pool queryer) *PhoneRepository {
+	return &PhoneRepository{pool: pool}
+}
+
+// scanPhone reads a single phone selected with phoneColumns
+func scanPhone(row pgx.Row) (*models.Phone, error) {
+	p := &models.Phone{}
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.Number, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// phoneAudit describes a change to a phone, before is nil when it was created and after when it was deleted
+func phoneAudit(action string, before, after *models.Phone) auditEntry {
+	p := after
+	if p == nil {
+		p = before
+	}
+	return auditEntry{action: action, entity: entityPhone, entityID: p.ID, userID: &p.UserID, before: before, after: after}
+}
+
+// lockPhone reads a phone of the given user and locks its row until the transaction ends
+// Returns ErrNotFound if the phone doesn't exist or belongs to another user
+func lockPhone(ctx context.Context, q queryer, userID, id uuid.UUID) (*models.Phone, error) {
+	query := `
+		SELECT ` + phoneColumns + `
+		FROM phone
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`
+
+	p, err := scanPhone(q.QueryRow(ctx, query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("phone %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error locking phone", err)
+	}
+	return p, nil
+}
+
+// Create inserts a new phone for p.UserID
+// Returns ErrNotFound if the user doesn't exist and ErrConflict if the user already has the number
+func (r *PhoneRepository) Create(ctx context.Context, p *models.Phone) (*models.Phone, error) {
+	query := `
+		INSERT INTO phone (id, user_id, name, number, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + phoneColumns
+
+	var created *models.Phone
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		var err error
+		created, err = scanPhone(q.QueryRow(ctx, query, uuid.New(), p.UserID, p.Name, p.Number))
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("user %w: %s", ErrNotFound, p.UserID)
+		}
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: phone number %s already exists for user", ErrConflict, p.Number)
+		}
+		if err != nil {
+			return wrapError("error creating phone", err)
+		}
+		return recordChanges(ctx, q, phoneAudit(AuditCreate, nil, created))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetByID retrieves a phone of the given user by its ID
+// Returns ErrNotFound if the phone doesn't exist or belongs to another user
+func (r *PhoneRepository) GetByID(ctx context.Context, userID, id uuid.UUID) (*models.Phone, error) {
+	query := `
+		SELECT ` + phoneColumns + `
+		FROM phone
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	p, err := scanPhone(r.pool.QueryRow(ctx, query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("phone %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error getting phone by ID", err)
+	}
+
+	return p, nil
+}
+
+// ListByUser retrieves all phones of a user ordered by creation time
+func (r *PhoneRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Phone, error) {
+	query := `
+		SELECT ` + phoneColumns + `
+		FROM phone
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at, id`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, wrapError("error listing phones", err)
+	}
+	defer rows.Close()
+
+	phones := []models.Phone{}
+	for rows.Next() {
+		p, err := scanPhone(rows)
+		if err != nil {
+			return nil, wrapError("error scanning phone", err)
+		}
+		phones = append(phones, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("error listing phones", err)
+	}
+
+	return phones, nil
+}
+
+// Update replaces the name and number of an existing phone
+// Returns ErrNotFound if the phone doesn't exist and ErrConflict if the user already has the number
+func (r *PhoneRepository) Update(ctx context.Context, p *models.Phone) (*models.Phone, error) {
+	query := `
+		UPDATE phone
+		SET name = $3, number = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + phoneColumns
+
+	var updated *models.Phone
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		before, err := lockPhone(ctx, q, p.UserID, p.ID)
+		if err != nil {
+			return err
+		}
+
+		updated, err = scanPhone(q.QueryRow(ctx, query, p.ID, p.UserID, p.Name, p.Number))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: phone number %s already exists for user", ErrConflict, p.Number)
+		}
+		if err != nil {
+			return wrapError("error updating phone", err)
+		}
+		return recordChanges(ctx, q, phoneAudit(AuditUpdate, before, updated))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Delete removes a phone of the given user
+// Returns ErrNotFound if the phone doesn't exist or belongs to another user
+func (r *PhoneRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+		DELETE FROM phone
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING ` + phoneColumns
+
+	return inTx(ctx, r.pool, func(q queryer) error {
+		deleted, err := scanPhone(q.QueryRow(ctx, query, id, userID))
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("phone %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return wrapError("error deleting phone", err)
+		}
+		return recordChanges(ctx, q, phoneAudit(AuditDelete, deleted, nil))
+	})
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhoneRepository_Unit(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	phoneID := uuid.New()
+	now := time.Now().UTC()
+
+	t.Run("Create success", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				assert.Equal(t, userID, args[1])
+				assert.Equal(t, "mobile", args[2])
+				assert.Equal(t, "+14155552671", args[3])
+				return &mockRow{vals: []interface{}{phoneID, userID, "mobile", "+14155552671", now, now}}
+			},
+		}
+
+		repo := NewPhoneRepository(mock)
+		p, err := repo.Create(ctx, &models.Phone{UserID: userID, Name: "mobile", Number: "+14155552671"})
+		require.NoError(t, err)
+		assert.Equal(t, phoneID, p.ID)
+		assert.Equal(t, "+14155552671", p.Number)
+	})
+
+	t.Run("Create duplicate number", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: &pgconn.PgError{Code: "23505"}}
+			},
+		}
+
+		repo := NewPhoneRepository(mock)
+		_, err := repo.Create(ctx, &models.Phone{UserID: userID, Name: "mobile", Number: "+14155552671"})
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("Create for missing user", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: &pgconn.PgError{Code: "23503"}}
+			},
+		}
+
+		repo := NewPhoneRepository(mock)
+		_, err := repo.Create(ctx, &models.Phone{UserID: userID, Name: "mobile", Number: "+14155552671"})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Update not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewPhoneRepository(mock)
+		_, err := repo.Update(ctx, &models.Phone{ID: phoneID, UserID: userID})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidCursor is returned when a page cursor can't be decoded or doesn't match the requested sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort is returned when results can't be ordered by the requested field
+	ErrInvalidSort = errors.New("invalid sort")
+)
+
+// likeEscaper escapes the LIKE wildcards in user supplied prefixes
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// prefixPattern returns a LIKE pattern matching values that start with prefix
+func prefixPattern(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+// prefixRange returns the bounds of the lowercased values that start with prefix, ignoring case
+// Unlike a parameterized LIKE, comparing with ~>=~ and ~<~ can use a text_pattern_ops index under
+// generic plans, and wildcards in prefix have no special meaning.
+func prefixRange(prefix string) (from, to string) {
+	from = strings.ToLower(prefix)
+	return from, from + string(utf8.MaxRune)
+}
+
+// Cursor identifies the last row of a page so the next page can continue after it
+// Rows are ordered by the sort value, then created_at, then id, so the position is always unique
+type Cursor struct {
+	Sort      string    `json:"s"`
+	Value     string    `json:"v,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"i"`
+}
+
+// Encode returns the opaque string representation of the cursor handed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c) // a struct of strings, times and UUIDs always marshals
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor previously returned by Cursor.Encode
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// PageRequest describes which page of a listing to return
+type PageRequest struct {
+	Limit  int    // maximum number of rows in the page
+	Cursor string // next_cursor of the previous page, empty for the first page
+	Sort   string // sort key name, prefixed with "-" for descending order
+}
+
+// ListQuery builds keyset-paginated SELECT statements over tables with id and created_at columns
+type ListQuery struct {
+	selectSQL string
+	sortKeys  map[string]string
+	where     []string
+	args      []any
+}
+
+// NewListQuery starts a query from a "SELECT ... FROM ..." statement without WHERE or ORDER BY clauses
+// sortKeys maps the public sort names to SQL expressions; "created_at" is always available
+func NewListQuery(selectSQL string, sortKeys map[string]string) *ListQuery {
+	keys := map[string]string{"created_at": "created_at"}
+	for name, expr := range sortKeys {
+		keys[name] = expr
+	}
+	return &ListQuery{selectSQL: selectSQL, sortKeys: keys}
+}
+
+// Arg adds a query argument and returns its placeholder
+func (q *ListQuery) Arg(value any) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// Where adds a condition that every returned row must satisfy
+// Values must be referenced through placeholders returned by Arg
+func (q *ListQuery) Where(cond string) *ListQuery {
+	q.where = append(q.where, cond)
+	return q
+}
+
+// parseSort splits a sort request such as "-last_name" into its name and direction
+func (q *ListQuery) parseSort(sort string) (name string, desc bool, err error) {
+	name = strings.TrimPrefix(sort, "-")
+	desc = name != sort
+	if name == "" {
+		name = "created_at"
+	}
+	if _, ok := q.sortKeys[name]; !ok {
+		return "", false, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, name)
+	}
+	return name, desc, nil
+}
+
+// Build returns the SQL and arguments selecting one row more than page.Limit
+// so that NextPage can tell whether another page follows
+func (q *ListQuery) Build(page PageRequest) (string, []any, error) {
+	if page.Limit < 1 {
+		return "", nil, fmt.Errorf("invalid page limit: %d", page.Limit)
+	}
+
+	name, desc, err := q.parseSort(page.Sort)
+	if err != nil {
+		return "", nil, err
+	}
+	expr := q.sortKeys[name]
+
+	op, dir := ">", "ASC"
+	if desc {
+		op, dir = "<", "DESC"
+	}
+
+	if page.Cursor != "" {
+		cursor, err := DecodeCursor(page.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		if cursor.Sort != page.Sort {
+			return "", nil, fmt.Errorf("%w: cursor was issued for sort %q", ErrInvalidCursor, cursor.Sort)
+		}
+
+		if name == "created_at" {
+			q.Where(fmt.Sprintf("(created_at, id) %s (%s, %s)", op, q.Arg(cursor.CreatedAt), q.Arg(cursor.ID)))
+		} else {
+			q.Where(fmt.Sprintf("(%s, created_at, id) %s (%s, %s, %s)",
+				expr, op, q.Arg(cursor.Value), q.Arg(cursor.CreatedAt), q.Arg(cursor.ID)))
+		}
+	}
+
+	sql := q.sql(name, dir) + "\n\t\tLIMIT " + q.Arg(page.Limit+1)
+	return sql, q.args, nil
+}
+
+// BuildAll returns the SQL and arguments selecting every matching row in the requested order
+// It is meant for exports that stream all rows instead of paging through them
+func (q *ListQuery) BuildAll(sort string) (string, []any, error) {
+	name, desc, err := q.parseSort(sort)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	return q.sql(name, dir), q.args, nil
+}
+
+// sql assembles the statement with its conditions, ordered by the named sort key then created_at and id
+func (q *ListQuery) sql(name, dir string) string {
+	var sql strings.Builder
+	sql.WriteString(q.selectSQL)
+	if len(q.where) > 0 {
+		sql.WriteString("\n\t\tWHERE ")
+		sql.WriteString(strings.Join(q.where, " AND "))
+	}
+
+	sql.WriteString("\n\t\tORDER BY ")
+	if name != "created_at" {
+		sql.WriteString(q.sortKeys[name] + " " + dir + ", ")
+	}
+	sql.WriteString("created_at " + dir + ", id " + dir)
+	return sql.String()
+}
+
+// NextPage trims the extra row fetched by ListQuery.Build and returns the cursor of the following page
+// cursorFor builds the cursor pointing at a row; the returned cursor is empty on the last page
+func NextPage[T any](rows []T, page PageRequest, cursorFor func(row T) Cursor) ([]T, string) {
+	if len(rows) <= page.Limit {
+		return rows, ""
+	}
+	rows = rows[:page.Limit]
+	cursor := cursorFor(rows[len(rows)-1])
+	cursor.Sort = page.Sort
+	return rows, cursor.Encode()
+}
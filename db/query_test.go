@@ -0,0 +1,128 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{
+		Sort:      "-last_name",
+		Value:     "Doe",
+		CreatedAt: time.Date(2025, 9, 25, 14, 0, 28, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, raw := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		_, err := DecodeCursor(raw)
+		assert.ErrorIs(t, err, ErrInvalidCursor, raw)
+	}
+}
+
+func TestListQueryBuild(t *testing.T) {
+	sortKeys := map[string]string{"last_name": "COALESCE(last_name, '')"}
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	id := uuid.New()
+
+	t.Run("first page with filter", func(t *testing.T) {
+		q := NewListQuery("SELECT id FROM users", sortKeys)
+		q.Where("created_at > " + q.Arg(createdAt))
+
+		sql, args, err := q.Build(PageRequest{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM users\n\t\tWHERE created_at > $1\n\t\tORDER BY created_at ASC, id ASC\n\t\tLIMIT $2", sql)
+		assert.Equal(t, []any{createdAt, 11}, args)
+	})
+
+	t.Run("next page by created_at", func(t *testing.T) {
+		cursor := Cursor{CreatedAt: createdAt, ID: id}.Encode()
+
+		sql, args, err := NewListQuery("SELECT id FROM users", sortKeys).Build(PageRequest{Limit: 5, Cursor: cursor})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM users\n\t\tWHERE (created_at, id) > ($1, $2)\n\t\tORDER BY created_at ASC, id ASC\n\t\tLIMIT $3", sql)
+		assert.Equal(t, []any{createdAt, id, 6}, args)
+	})
+
+	t.Run("next page by descending last name", func(t *testing.T) {
+		cursor := Cursor{Sort: "-last_name", Value: "Doe", CreatedAt: createdAt, ID: id}.Encode()
+
+		sql, args, err := NewListQuery("SELECT id FROM users", sortKeys).
+			Build(PageRequest{Limit: 5, Cursor: cursor, Sort: "-last_name"})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM users\n\t\tWHERE (COALESCE(last_name, ''), created_at, id) < ($1, $2, $3)\n\t\t"+
+			"ORDER BY COALESCE(last_name, '') DESC, created_at DESC, id DESC\n\t\tLIMIT $4", sql)
+		assert.Equal(t, []any{"Doe", createdAt, id, 6}, args)
+	})
+
+	t.Run("unknown sort", func(t *testing.T) {
+		_, _, err := NewListQuery("SELECT id FROM users", sortKeys).Build(PageRequest{Limit: 5, Sort: "email"})
+		assert.ErrorIs(t, err, ErrInvalidSort)
+	})
+
+	t.Run("all rows", func(t *testing.T) {
+		q := NewListQuery("SELECT id FROM users", sortKeys)
+		q.Where("created_at > " + q.Arg(createdAt))
+
+		sql, args, err := q.BuildAll("-last_name")
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM users\n\t\tWHERE created_at > $1\n\t\t"+
+			"ORDER BY COALESCE(last_name, '') DESC, created_at DESC, id DESC", sql)
+		assert.Equal(t, []any{createdAt}, args)
+	})
+
+	t.Run("cursor from another sort", func(t *testing.T) {
+		cursor := Cursor{Sort: "last_name", CreatedAt: createdAt, ID: id}.Encode()
+
+		_, _, err := NewListQuery("SELECT id FROM users", sortKeys).
+			Build(PageRequest{Limit: 5, Cursor: cursor, Sort: "-last_name"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestNextPage(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	cursorFor := func(id uuid.UUID) Cursor { return Cursor{ID: id} }
+
+	t.Run("more rows follow", func(t *testing.T) {
+		page := PageRequest{Limit: 2, Sort: "-created_at"}
+		rows, next := NextPage(ids, page, cursorFor)
+		assert.Equal(t, ids[:2], rows)
+
+		cursor, err := DecodeCursor(next)
+		require.NoError(t, err)
+		assert.Equal(t, ids[1], cursor.ID)
+		assert.Equal(t, "-created_at", cursor.Sort)
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		rows, next := NextPage(ids, PageRequest{Limit: 3}, cursorFor)
+		assert.Equal(t, ids, rows)
+		assert.Empty(t, next)
+	})
+}
+
+func TestPrefixPattern(t *testing.T) {
+	assert.Equal(t, `100\% \_rep\\%`, prefixPattern(`100% _rep\`))
+}
+
+func TestPrefixRange(t *testing.T) {
+	from, to := prefixRange("Bench%")
+	assert.Equal(t, "bench%", from)
+	// Byte-wise, as compared by ~<~, every value starting with the prefix sorts inside the range
+	for _, value := range []string{"bench%", "bench% press", "bench%é"} {
+		assert.True(t, value >= from && value < to, value)
+	}
+	for _, value := range []string{"bench press", "bench", "bencha"} {
+		assert.False(t, value >= from && value < to, value)
+	}
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"frame/logging"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// queryTracer logs every query at debug level with the fields of the request running it, so the
+// queries of a request can be joined with its other log lines by request_id
+// Query arguments aren't logged as they hold personal data.
+type queryTracer struct{}
+
+// queryStartKey keys the queryStart stored in the context of a traced query
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+// TraceQueryStart notes the query and when it started, only when debug logging is enabled
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if l := logging.GetLogger(); l == nil || !l.Core().Enabled(zap.DebugLevel) {
+		return ctx
+	}
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+// TraceQueryEnd logs the query noted by TraceQueryStart with its duration and outcome
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	q, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	logging.FromContext(ctx).Debug("Database query",
+		zap.String("sql", strings.Join(strings.Fields(q.sql), " ")),
+		zap.String("command_tag", data.CommandTag.String()),
+		zap.Duration("duration", time.Since(q.start)),
+		zap.Error(data.Err))
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// beginner is implemented by pools and transactions that can start a transaction
+type beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// inTx runs fn inside a transaction when q can start one, otherwise it runs fn against q directly
+func inTx(ctx context.Context, q queryer, fn func(q queryer) error) error {
+	b, ok := q.(beginner)
+	if !ok {
+		return fn(q)
+	}
+
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return wrapError("error starting transaction", err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return wrapError("error committing transaction", err)
+	}
+	return nil
+}
@@ -2,19 +2,31 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"frame/models"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-// queryer represents a subset of pgxpool.Pool methods needed by UserRepository
+// queryer represents a subset of pgxpool.Pool methods needed by the repositories
 type queryer interface {
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
 }
 
+// userColumns lists the user columns in the order expected by scanUser
+// The nullable names and email are read as empty strings
+const userColumns = `id, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(email, ''), created_at, updated_at, version, deleted_at`
+
 // UserRepository handles all user-related database operations
 type UserRepository struct {
 	pool queryer
@@ -25,33 +37,66 @@ func NewUserRepository(pool queryer) *UserRepository {
 	return &UserRepository{pool: pool}
 }
 
-// Exists checks if a user with the given first name and last name already exists
+// scanUser reads a single user selected with userColumns
+func scanUser(row pgx.Row) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Version,
+		&user.DeletedAt)
+	return user, err
+}
+
+// lockUser reads a user that isn't deleted and locks their row until the transaction ends
+// Returns ErrNotFound if the user doesn't exist or is deleted
+func lockUser(ctx context.Context, q queryer, id uuid.UUID) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`
+
+	user, err := scanUser(q.QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("user %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, wrapError("error locking user", err)
+	}
+	return user, nil
+}
+
+// userAudit describes a change to a user, before is nil when the user was created
+func userAudit(action string, before, after *models.User) auditEntry {
+	return auditEntry{action: action, entity: entityUser, entityID: after.ID, userID: &after.ID, before: before, after: after}
+}
+
+// Exists checks if a user with the given email already exists, ignoring case and deleted users
 // Returns (nil, nil) if user doesn't exist, (uuid.UUID, nil) if user exists, and (nil, error) if there's an error
-func (r *UserRepository) Exists(ctx context.Context, firstName, lastName string) (*uuid.UUID, error) {
+func (r *UserRepository) Exists(ctx context.Context, email string) (*uuid.UUID, error) {
 	query := `
 		SELECT id
-		FROM users 
-		WHERE first_name = $1 AND last_name = $2
+		FROM users
+		WHERE lower(email) = lower($1) AND deleted_at IS NULL
 		LIMIT 1`
 
 	var id uuid.UUID
-	err := r.pool.QueryRow(ctx, query, firstName, lastName).Scan(&id)
+	err := r.pool.QueryRow(ctx, query, email).Scan(&id)
 
 	if err == pgx.ErrNoRows {
 		return nil, nil // User doesn't exist
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error checking if user exists: %v", err)
+		return nil, wrapError("error checking if user exists", err)
 	}
 
 	return &id, nil
 }
 
-// Create inserts a new user into the database or returns existing user
-// Returns (user, isNewUser, error) where isNewUser indicates if the user was created or found
-func (r *UserRepository) Create(ctx context.Context, firstName, lastName string) (*models.User, bool, error) {
+// Create inserts a new user into the database or returns the existing user with the same email
+// Returns (user, isNewUser, error) where isNewUser indicates if the user was created or found,
+// and ErrConflict if the email is taken by a user that can't be found
+func (r *UserRepository) Create(ctx context.Context, firstName, lastName, email string) (*models.User, bool, error) {
 	// Check if user already exists
-	existingID, err := r.Exists(ctx, firstName, lastName)
+	existingID, err := r.Exists(ctx, email)
 	if err != nil {
 		return nil, false, err
 	}
@@ -63,41 +108,619 @@ func (r *UserRepository) Create(ctx context.Context, firstName, lastName string)
 		ID:        uuid.New(),
 		FirstName: firstName,
 		LastName:  lastName,
+		Email:     email,
 	}
 
 	query := `
-		INSERT INTO users (id, first_name, last_name, created_at, updated_at)
-		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		RETURNING id, first_name, last_name, created_at, updated_at`
+		INSERT INTO users (id, first_name, last_name, email, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + userColumns
 
-	err = r.pool.QueryRow(ctx, query, user.ID, user.FirstName, user.LastName).
-		Scan(&user.ID, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+	var created *models.User
+	err = inTx(ctx, r.pool, func(q queryer) error {
+		var err error
+		created, err = scanUser(q.QueryRow(ctx, query, user.ID, user.FirstName, user.LastName, user.Email))
+		if isUniqueViolation(err) {
+			return err // resolved below, once the transaction has rolled back
+		}
+		if err != nil {
+			return wrapError("error creating user", err)
+		}
+		return recordChanges(ctx, q, userAudit(AuditCreate, nil, created))
+	})
+	if isUniqueViolation(err) {
+		// Another request created the same email between our check and insert
+		existingID, existsErr := r.Exists(ctx, email)
+		if existsErr != nil {
+			return nil, false, existsErr
+		}
+		if existingID != nil {
+			return &models.User{ID: *existingID}, false, nil
+		}
+		// The row holding the email isn't visible to us, such as one deleted since the insert
+		return nil, false, fmt.Errorf("%w: email %s is already taken", ErrConflict, email)
+	}
 	if err != nil {
-		return nil, false, fmt.Errorf("error creating user: %v", err)
+		return nil, false, err
 	}
 
-	return user, true, nil
+	return created, true, nil
 }
 
 // GetByID retrieves a user by their ID
-// Returns (nil, error) if user not found or there's an error
+// Returns (nil, error) if user not found, deleted or there's an error
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, first_name, last_name, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 		LIMIT 1`
 
-	user := &models.User{}
-	err := r.pool.QueryRow(ctx, query, id).
-		Scan(&user.ID, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(r.pool.QueryRow(ctx, query, id))
 
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("user not found: %s", id)
+		return nil, fmt.Errorf("user %w: %s", ErrNotFound, id)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error getting user by ID: %v", err)
+		return nil, wrapError("error getting user by ID", err)
 	}
 
 	return user, nil
 }
+
+// GetByEmail retrieves a user by their email address, ignoring case
+// Returns (nil, error) if user not found, deleted or there's an error
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE lower(email) = lower($1) AND deleted_at IS NULL
+		LIMIT 1`
+
+	user, err := scanUser(r.pool.QueryRow(ctx, query, email))
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("user %w: %s", ErrNotFound, email)
+	}
+	if err != nil {
+		return nil, wrapError("error getting user by email", err)
+	}
+
+	return user, nil
+}
+
+// UserFilter restricts which users are returned by List and Export
+// Deleted users are left out unless IncludeDeleted is set
+type UserFilter struct {
+	Email          string    // exact email match, ignoring case
+	NamePrefix     string    // first or last name starts with this prefix, ignoring case
+	CreatedAfter   time.Time // only users created after this time when set
+	IncludeDeleted bool      // also return soft deleted users
+}
+
+// userSortKeys are the fields users can be ordered by in addition to created_at
+var userSortKeys = map[string]string{
+	"first_name": "COALESCE(first_name, '')",
+	"last_name":  "COALESCE(last_name, '')",
+}
+
+// apply adds the conditions of the filter to a query over the users table
+func (f UserFilter) apply(q *ListQuery) {
+	if f.Email != "" {
+		q.Where("lower(email) = lower(" + q.Arg(f.Email) + ")")
+	}
+	if f.NamePrefix != "" {
+		pattern := q.Arg(prefixPattern(f.NamePrefix))
+		q.Where("(lower(first_name) LIKE lower(" + pattern + ") OR lower(last_name) LIKE lower(" + pattern + "))")
+	}
+	if !f.CreatedAfter.IsZero() {
+		q.Where("created_at > " + q.Arg(f.CreatedAfter))
+	}
+	if !f.IncludeDeleted {
+		q.Where("deleted_at IS NULL")
+	}
+}
+
+// List retrieves one page of users matching the filter
+// Returns the users and the cursor of the next page, which is empty on the last page
+func (r *UserRepository) List(ctx context.Context, filter UserFilter, page PageRequest) ([]models.User, string, error) {
+	q := NewListQuery(`
+		SELECT `+userColumns+`
+		FROM users`, userSortKeys)
+	filter.apply(q)
+
+	query, args, err := q.Build(page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", wrapError("error listing users", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, "", wrapError("error scanning user", err)
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", wrapError("error listing users", err)
+	}
+
+	users, next := NextPage(users, page, func(user models.User) Cursor {
+		cursor := Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+		switch strings.TrimPrefix(page.Sort, "-") {
+		case "first_name":
+			cursor.Value = user.FirstName
+		case "last_name":
+			cursor.Value = user.LastName
+		}
+		return cursor
+	})
+
+	return users, next, nil
+}
+
+// ExportOptions selects the related records included with exported users
+type ExportOptions struct {
+	Addresses bool
+	Phones    bool
+}
+
+// ExportedUser is a user with the related records requested by ExportOptions
+type ExportedUser struct {
+	models.User
+	Addresses []models.Address
+	Phones    []models.Phone
+}
+
+// The related records are aggregated as JSON objects keyed by the model field names,
+// so they decode straight into the models. A deleted user is exported with the records deleted along with it.
+const (
+	exportAddressesSQL = `
+			(SELECT COALESCE(json_agg(json_build_object(
+				'ID', a.id, 'UserID', a.user_id, 'Name', COALESCE(a.name, ''), 'Street', COALESCE(a.street, ''),
+				'Suite', COALESCE(a.suite, ''), 'City', COALESCE(a.city, ''), 'State', COALESCE(a.state, ''),
+				'Zip', COALESCE(a.zip, ''), 'IsPrimary', a.is_primary, 'CreatedAt', a.created_at, 'UpdatedAt', a.updated_at
+			) ORDER BY a.created_at, a.id), '[]')
+			FROM address a WHERE a.user_id = users.id AND a.deleted_at IS NOT DISTINCT FROM users.deleted_at)`
+	exportPhonesSQL = `
+			(SELECT COALESCE(json_agg(json_build_object(
+				'ID', p.id, 'UserID', p.user_id, 'Name', p.name, 'Number', p.number,
+				'CreatedAt', p.created_at, 'UpdatedAt', p.updated_at
+			) ORDER BY p.created_at, p.id), '[]')
+			FROM phone p WHERE p.user_id = users.id AND p.deleted_at IS NOT DISTINCT FROM users.deleted_at)`
+)
+
+// Export streams every user matching the filter to fn in the requested sort order
+// Rows are read from the server as fn consumes them, so memory use doesn't grow with the number of users.
+// Iteration stops at the first error returned by fn, which Export returns unchanged.
+func (r *UserRepository) Export(ctx context.Context, filter UserFilter, sort string, opts ExportOptions, fn func(*ExportedUser) error) error {
+	addresses, phones := "'[]'::json", "'[]'::json"
+	if opts.Addresses {
+		addresses = exportAddressesSQL
+	}
+	if opts.Phones {
+		phones = exportPhonesSQL
+	}
+
+	q := NewListQuery(`
+		SELECT `+userColumns+`, `+addresses+` AS addresses, `+phones+` AS phones
+		FROM users`, userSortKeys)
+	filter.apply(q)
+
+	query, args, err := q.BuildAll(sort)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return wrapError("error exporting users", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user ExportedUser
+		var addressJSON, phoneJSON []byte
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt, &user.UpdatedAt,
+			&user.Version, &user.DeletedAt, &addressJSON, &phoneJSON)
+		if err != nil {
+			return wrapError("error scanning exported user", err)
+		}
+		if opts.Addresses {
+			if err := json.Unmarshal(addressJSON, &user.Addresses); err != nil {
+				return fmt.Errorf("error decoding addresses of user %s: %v", user.ID, err)
+			}
+		}
+		if opts.Phones {
+			if err := json.Unmarshal(phoneJSON, &user.Phones); err != nil {
+				return fmt.Errorf("error decoding phones of user %s: %v", user.ID, err)
+			}
+		}
+
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return wrapError("error exporting users", err)
+	}
+
+	return nil
+}
+
+// ImportRow is a validated user read from one line of an import file
+type ImportRow struct {
+	Line      int
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+// ImportResult reports whether the user of an import line was created
+// ID is only set for created users
+type ImportResult struct {
+	Line    int
+	Created bool
+	ID      uuid.UUID
+}
+
+// copier is implemented by connections and transactions that support the COPY protocol
+type copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// Import creates the users of a batch in one transaction, copying them into a staging table first
+// Rows whose email is already in use, or repeated earlier in the batch, are reported as not created
+func (r *UserRepository) Import(ctx context.Context, rows []ImportRow) ([]ImportResult, error) {
+	ids := make([]uuid.UUID, len(rows))
+	for i := range rows {
+		ids[i] = uuid.New()
+	}
+
+	created := make(map[uuid.UUID]bool, len(rows))
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		c, ok := q.(copier)
+		if !ok {
+			return fmt.Errorf("error importing users: connection doesn't support COPY")
+		}
+
+		_, err := q.Exec(ctx, `
+			CREATE TEMPORARY TABLE user_import (
+				line integer NOT NULL,
+				id uuid NOT NULL,
+				first_name text NOT NULL,
+				last_name text NOT NULL,
+				email text NOT NULL
+			) ON COMMIT DROP`)
+		if err != nil {
+			return wrapError("error creating import table", err)
+		}
+
+		_, err = c.CopyFrom(ctx, pgx.Identifier{"user_import"},
+			[]string{"line", "id", "first_name", "last_name", "email"},
+			pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+				return []any{rows[i].Line, ids[i], rows[i].FirstName, rows[i].LastName, rows[i].Email}, nil
+			}))
+		if err != nil {
+			return wrapError("error copying users", err)
+		}
+
+		// The first line wins when the batch repeats an email
+		result, err := q.Query(ctx, `
+			INSERT INTO users (id, first_name, last_name, email, created_at, updated_at)
+			SELECT DISTINCT ON (lower(email)) id, first_name, last_name, email, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+			FROM user_import
+			ORDER BY lower(email), line
+			ON CONFLICT DO NOTHING
+			RETURNING id`)
+		if err != nil {
+			return wrapError("error importing users", err)
+		}
+		defer result.Close()
+
+		for result.Next() {
+			var id uuid.UUID
+			if err := result.Scan(&id); err != nil {
+				return wrapError("error scanning imported user", err)
+			}
+			created[id] = true
+		}
+		if err := result.Err(); err != nil {
+			return wrapError("error importing users", err)
+		}
+		result.Close()
+
+		if len(created) == 0 {
+			return nil
+		}
+		// The snapshots use the same names as recordChanges so imported users read like created ones
+		_, err = q.Exec(ctx, `
+			WITH audited AS (
+				INSERT INTO audit_log (id, actor, action, entity, entity_id, user_id, after, request_id, created_at)
+				SELECT gen_random_uuid(), NULLIF($1, ''), $2, $3, u.id, u.id,
+					jsonb_build_object('id', u.id, 'first_name', u.first_name, 'last_name', u.last_name,
+						'email', COALESCE(u.email, ''), 'created_at', u.created_at, 'updated_at', u.updated_at,
+						'version', u.version, 'deleted_at', u.deleted_at),
+					NULLIF($4, ''), clock_timestamp()
+				FROM users u
+				JOIN user_import i ON i.id = u.id
+				RETURNING *
+			)`+publishAudited("$5"),
+			contextString(ctx, actorKey), AuditCreate, entityUser, contextString(ctx, requestIDKey),
+			eventType(entityUser, AuditCreate))
+		if err != nil {
+			return wrapError("error writing audit log", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ImportResult, len(rows))
+	for i, row := range rows {
+		results[i] = ImportResult{Line: row.Line, Created: created[ids[i]]}
+		if results[i].Created {
+			results[i].ID = ids[i]
+		}
+	}
+	return results, nil
+}
+
+// Versions are the versions of a record a conditional write may change, read from an If-Match header
+type Versions struct {
+	Any  bool  // any version of an existing record, for If-Match: *
+	List []int // the versions the caller has read
+}
+
+// Match reports whether a record at version may be changed
+func (v Versions) Match(version int) bool {
+	return v.Any || slices.Contains(v.List, version)
+}
+
+// String lists the versions for error messages
+func (v Versions) String() string {
+	if v.Any {
+		return "any version"
+	}
+	versions := make([]string, len(v.List))
+	for i, version := range v.List {
+		versions[i] = strconv.Itoa(version)
+	}
+	return strings.Join(versions, " or ")
+}
+
+// Update replaces the names and email of an existing user and increments its version
+// versions must hold the version the caller last read, so concurrent edits don't overwrite each other
+// Returns ErrNotFound if the user doesn't exist or is deleted, ErrPreconditionFailed if the user has changed
+// since it was read and ErrConflict if the email belongs to another user
+func (r *UserRepository) Update(ctx context.Context, id uuid.UUID, versions Versions, firstName, lastName, email string) (*models.User, error) {
+	return r.Patch(ctx, id, versions, UserPatch{FirstName: &firstName, LastName: &lastName, Email: &email})
+}
+
+// UserPatch holds the fields a partial update changes, nil for those it leaves as they are
+type UserPatch struct {
+	FirstName *string
+	LastName  *string
+	Email     *string
+}
+
+// Patch changes the fields of an existing user set in patch and increments its version
+// The other fields are taken from the user once it is locked, so a concurrent edit of them is never
+// overwritten with a value read earlier. Errors are those of Update.
+func (r *UserRepository) Patch(ctx context.Context, id uuid.UUID, versions Versions, patch UserPatch) (*models.User, error) {
+	query := `
+		UPDATE users
+		SET first_name = $2, last_name = $3, email = NULLIF($4, ''), updated_at = CURRENT_TIMESTAMP,
+			version = version + 1
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	var updated *models.User
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		before, err := lockUser(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		if !versions.Match(before.Version) {
+			return fmt.Errorf("%w: user %s is at version %d, not %s", ErrPreconditionFailed, id, before.Version, versions)
+		}
+
+		firstName, lastName, email := before.FirstName, before.LastName, before.Email
+		if patch.FirstName != nil {
+			firstName = *patch.FirstName
+		}
+		if patch.LastName != nil {
+			lastName = *patch.LastName
+		}
+		if patch.Email != nil {
+			email = *patch.Email
+		}
+
+		updated, err = scanUser(q.QueryRow(ctx, query, id, firstName, lastName, email))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: email %s is already in use", ErrConflict, email)
+		}
+		if err != nil {
+			return wrapError("error updating user", err)
+		}
+
+		return recordChanges(ctx, q, userAudit(AuditUpdate, before, updated))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Delete soft deletes a user along with their addresses and phones
+// The rows are kept until Purge removes them, so the user can be restored in the meantime
+// Returns ErrNotFound if the user doesn't exist or is already deleted
+func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	return inTx(ctx, r.pool, func(q queryer) error {
+		before, err := lockUser(ctx, q, id)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := scanUser(q.QueryRow(ctx, query, id))
+		if err != nil {
+			return wrapError("error deleting user", err)
+		}
+
+		// CURRENT_TIMESTAMP is fixed for the transaction, so the children share the user's deleted_at
+		children, err := setChildrenDeletedAt(ctx, q, AuditDelete, id, nil, "CURRENT_TIMESTAMP")
+		if err != nil {
+			return err
+		}
+
+		return recordChanges(ctx, q, append([]auditEntry{userAudit(AuditDelete, before, deleted)}, children...)...)
+	})
+}
+
+// Restore undoes the soft delete of a user along with the addresses and phones deleted with them
+// Returns ErrNotFound if the user doesn't exist or was purged, and ErrConflict if the user isn't
+// deleted or their email has since been taken by another user
+func (r *UserRepository) Restore(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	var restored *models.User
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		before, err := scanUser(q.QueryRow(ctx, `
+			SELECT `+userColumns+`
+			FROM users
+			WHERE id = $1
+			FOR UPDATE`, id))
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("user %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return wrapError("error getting deleted user", err)
+		}
+		if before.DeletedAt == nil {
+			return fmt.Errorf("%w: user %s is not deleted", ErrConflict, id)
+		}
+
+		restored, err = scanUser(q.QueryRow(ctx, query, id))
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: email of user %s is now in use by another user", ErrConflict, id)
+		}
+		if err != nil {
+			return wrapError("error restoring user", err)
+		}
+
+		children, err := setChildrenDeletedAt(ctx, q, AuditRestore, id, before.DeletedAt, "NULL")
+		if err != nil {
+			return err
+		}
+
+		return recordChanges(ctx, q, append([]auditEntry{userAudit(AuditRestore, before, restored)}, children...)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// setChildrenDeletedAt sets deleted_at to the SQL expression to on the addresses and phones of a user
+// whose deleted_at is currently from, returning an audit entry for each changed row
+func setChildrenDeletedAt(ctx context.Context, q queryer, action string, userID uuid.UUID, from *time.Time, to string) ([]auditEntry, error) {
+	var entries []auditEntry
+	// The entity names are also the table names
+	for _, entity := range []string{entityAddress, entityPhone} {
+		query := `
+			UPDATE ` + entity + `
+			SET deleted_at = ` + to + `
+			WHERE user_id = $1 AND deleted_at IS NOT DISTINCT FROM $2
+			RETURNING id, deleted_at`
+
+		rows, err := q.Query(ctx, query, userID, from)
+		if err != nil {
+			return nil, wrapError("error updating "+entity+" of user", err)
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			var deletedAt *time.Time
+			if err := rows.Scan(&id, &deletedAt); err != nil {
+				rows.Close()
+				return nil, wrapError("error scanning "+entity+" of user", err)
+			}
+			entries = append(entries, auditEntry{
+				action:   action,
+				entity:   entity,
+				entityID: id,
+				userID:   &userID,
+				before:   map[string]any{"deleted_at": from},
+				after:    map[string]any{"deleted_at": deletedAt},
+			})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, wrapError("error updating "+entity+" of user", err)
+		}
+	}
+	return entries, nil
+}
+
+// purgeTargets lists the tables Purge deletes from, children first so the user_fk constraints hold
+var purgeTargets = []struct {
+	table, entity, userColumn, where string
+}{
+	{"address", entityAddress, "user_id", "user_id IN (SELECT id FROM users WHERE deleted_at < $1)"},
+	{"phone", entityPhone, "user_id", "user_id IN (SELECT id FROM users WHERE deleted_at < $1)"},
+	{"users", entityUser, "id", "deleted_at < $1"},
+}
+
+// Purge permanently removes the users deleted before the given time with all of their addresses and phones
+// Returns the number of users removed
+func (r *UserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := inTx(ctx, r.pool, func(q queryer) error {
+		for _, target := range purgeTargets {
+			_, err := q.Exec(ctx, `
+				WITH audited AS (
+					INSERT INTO audit_log (id, actor, action, entity, entity_id, user_id, request_id, created_at)
+					SELECT gen_random_uuid(), NULLIF($2, ''), $3, $4, id, `+target.userColumn+`, NULLIF($5, ''), clock_timestamp()
+					FROM `+target.table+`
+					WHERE `+target.where+`
+					RETURNING *
+				)`+publishAudited("$6"),
+				before, contextString(ctx, actorKey), AuditPurge, target.entity, contextString(ctx, requestIDKey),
+				eventType(target.entity, AuditPurge))
+			if err != nil {
+				return wrapError("error writing audit log", err)
+			}
+
+			tag, err := q.Exec(ctx, `
+				DELETE FROM `+target.table+`
+				WHERE `+target.where, before)
+			if err != nil {
+				return wrapError("error purging deleted "+target.entity+" rows", err)
+			}
+			if target.table == "users" {
+				purged = tag.RowsAffected()
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
@@ -2,11 +2,14 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -39,15 +42,22 @@ func TestUserRepository_Integration(t *testing.T) {
 	repo := NewUserRepository(pool)
 	ctx := context.Background()
 
+	// uniqueEmail returns an email address that hasn't been used by a previous test run
+	uniqueEmail := func(name string) string {
+		return fmt.Sprintf("%s.%s@example.com", name, uuid.NewString()[:8])
+	}
+
 	t.Run("Create new user", func(t *testing.T) {
 		// Test creating a new user
-		user, isNew, err := repo.Create(ctx, "John", "Doe")
+		email := uniqueEmail("john")
+		user, isNew, err := repo.Create(ctx, "John", "Doe", email)
 		require.NoError(t, err)
 		assert.True(t, isNew)
 		assert.NotNil(t, user)
 		assert.NotEmpty(t, user.ID)
 		assert.Equal(t, "John", user.FirstName)
 		assert.Equal(t, "Doe", user.LastName)
+		assert.Equal(t, email, user.Email)
 		assert.False(t, user.CreatedAt.IsZero())
 		assert.False(t, user.UpdatedAt.IsZero())
 
@@ -57,45 +67,121 @@ func TestUserRepository_Integration(t *testing.T) {
 		assert.Equal(t, user.ID, found.ID)
 		assert.Equal(t, user.FirstName, found.FirstName)
 		assert.Equal(t, user.LastName, found.LastName)
+		assert.Equal(t, user.Email, found.Email)
 		assert.Equal(t, user.CreatedAt, found.CreatedAt)
 		assert.Equal(t, user.UpdatedAt, found.UpdatedAt)
 	})
 
 	t.Run("Create duplicate user", func(t *testing.T) {
 		// Create first user
-		first, isNew, err := repo.Create(ctx, "Jane", "Smith")
+		email := uniqueEmail("jane")
+		first, isNew, err := repo.Create(ctx, "Jane", "Smith", email)
 		require.NoError(t, err)
 		assert.True(t, isNew)
 		assert.NotNil(t, first)
 
-		// Try to create the same user again
-		second, isNew, err := repo.Create(ctx, "Jane", "Smith")
+		// Try to create the same user again with a differently cased email
+		second, isNew, err := repo.Create(ctx, "Jane", "Smith", strings.ToUpper(email))
 		require.NoError(t, err)
 		assert.False(t, isNew)
 		assert.Equal(t, first.ID, second.ID)
 	})
 
+	t.Run("Same name different email", func(t *testing.T) {
+		first, isNew, err := repo.Create(ctx, "Sam", "Lee", uniqueEmail("sam"))
+		require.NoError(t, err)
+		assert.True(t, isNew)
+
+		second, isNew, err := repo.Create(ctx, "Sam", "Lee", uniqueEmail("sam"))
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.NotEqual(t, first.ID, second.ID)
+	})
+
+	t.Run("GetByEmail", func(t *testing.T) {
+		email := uniqueEmail("mail")
+		user, _, err := repo.Create(ctx, "Mail", "Lookup", email)
+		require.NoError(t, err)
+
+		found, err := repo.GetByEmail(ctx, strings.ToUpper(email))
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+
+		_, err = repo.GetByEmail(ctx, uniqueEmail("missing"))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
 	t.Run("GetByID non-existent user", func(t *testing.T) {
 		_, err := repo.GetByID(ctx, uuid.New())
 		assert.Error(t, err)
 	})
 
+	t.Run("Delete and restore", func(t *testing.T) {
+		email := uniqueEmail("deleted")
+		user, _, err := repo.Create(ctx, "Soft", "Deleted", email)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.Delete(ctx, user.ID))
+		_, err = repo.GetByID(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, user.ID), ErrNotFound)
+
+		users, _, err := repo.List(ctx, UserFilter{Email: email, IncludeDeleted: true}, PageRequest{Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.NotNil(t, users[0].DeletedAt)
+
+		restored, err := repo.Restore(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		_, err = repo.Restore(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		entries, _, err := NewAuditRepository(pool).ListByUser(ctx, user.ID, AuditFilter{}, PageRequest{Limit: 10})
+		require.NoError(t, err)
+		var actions []string
+		for _, e := range entries {
+			actions = append(actions, e.Action)
+		}
+		assert.Equal(t, []string{AuditCreate, AuditDelete, AuditRestore}, actions)
+
+		rows, err := pool.Query(ctx, "SELECT event_type FROM outbox WHERE entity_id = $1 ORDER BY created_at", user.ID)
+		require.NoError(t, err)
+		types, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user.created", "user.deleted", "user.restored"}, types)
+	})
+
 	t.Run("Exists check", func(t *testing.T) {
 		// Check non-existent user
-		id, err := repo.Exists(ctx, "Test", "User")
+		email := uniqueEmail("test")
+		id, err := repo.Exists(ctx, email)
 		require.NoError(t, err)
 		assert.Nil(t, id)
 
 		// Create a user
-		user, _, err := repo.Create(ctx, "Test", "User")
+		user, _, err := repo.Create(ctx, "Test", "User", email)
 		require.NoError(t, err)
 
 		// Check existing user
-		id, err = repo.Exists(ctx, "Test", "User")
+		id, err = repo.Exists(ctx, email)
 		require.NoError(t, err)
 		assert.NotNil(t, id)
 		assert.Equal(t, user.ID, *id)
 	})
+
+	t.Run("Users without names", func(t *testing.T) {
+		// Rows written before the API required names may lack them
+		id := uuid.New()
+		_, err := pool.Exec(ctx, `INSERT INTO users (id, email, created_at, updated_at)
+			VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`, id, uniqueEmail("nameless"))
+		require.NoError(t, err)
+
+		user, err := repo.GetByID(ctx, id)
+		require.NoError(t, err)
+		assert.Empty(t, user.FirstName)
+		assert.Empty(t, user.LastName)
+	})
 }
 
 // Mock implementations for unit tests
@@ -116,19 +202,85 @@ func (m *mockRow) Scan(dest ...interface{}) error {
 			*v = val.(string)
 		case *time.Time:
 			*v = val.(time.Time)
+		case **time.Time:
+			if val != nil {
+				t := val.(time.Time)
+				*v = &t
+			}
+		case *bool:
+			*v = val.(bool)
+		case *int:
+			*v = val.(int)
+		case *[]byte:
+			*v = val.([]byte)
+		case *[]string:
+			*v = val.([]string)
+		case *map[string]string:
+			*v = val.(map[string]string)
 		}
 	}
 	return nil
 }
 
+// mockRows returns each of its rows in turn, scanning them like mockRow
+type mockRows struct {
+	rows [][]interface{}
+	pos  int
+}
+
+func (m *mockRows) Close()                                       {}
+func (m *mockRows) Err() error                                   { return nil }
+func (m *mockRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (m *mockRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (m *mockRows) Values() ([]any, error)                       { return m.rows[m.pos-1], nil }
+func (m *mockRows) RawValues() [][]byte                          { return nil }
+func (m *mockRows) Conn() *pgx.Conn                              { return nil }
+
+func (m *mockRows) Next() bool {
+	m.pos++
+	return m.pos <= len(m.rows)
+}
+
+func (m *mockRows) Scan(dest ...interface{}) error {
+	return (&mockRow{vals: m.rows[m.pos-1]}).Scan(dest...)
+}
+
 type mockPool struct {
 	queryRowFunc func(context.Context, string, ...interface{}) pgx.Row
+	queryFunc    func(context.Context, string, ...interface{}) (pgx.Rows, error)
+	execFunc     func(context.Context, string, ...interface{}) (pgconn.CommandTag, error)
+	copyFromFunc func(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error)
+
+	// audits holds the arguments of every audit_log insert, which don't reach execFunc
+	audits [][]interface{}
+	// events holds the arguments of every outbox insert, which don't reach execFunc either
+	events [][]interface{}
+}
+
+func (m *mockPool) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return m.copyFromFunc(ctx, tableName, columnNames, rowSrc)
 }
 
 func (m *mockPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
 	return m.queryRowFunc(ctx, sql, args...)
 }
 
+func (m *mockPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return m.queryFunc(ctx, sql, args...)
+}
+
+func (m *mockPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "INSERT INTO audit_log") {
+		m.audits = append(m.audits, args)
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	if strings.Contains(sql, "INSERT INTO outbox") {
+		m.events = append(m.events, args)
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	return m.execFunc(ctx, sql, args...)
+}
+
 func TestUserRepository_Unit(t *testing.T) {
 	ctx := context.Background()
 	testID := uuid.New()
@@ -143,6 +295,7 @@ func TestUserRepository_Unit(t *testing.T) {
 						testID,
 						"John",
 						"Doe",
+						"john@example.com",
 						now,
 						now,
 					},
@@ -156,6 +309,7 @@ func TestUserRepository_Unit(t *testing.T) {
 		assert.Equal(t, testID, user.ID)
 		assert.Equal(t, "John", user.FirstName)
 		assert.Equal(t, "Doe", user.LastName)
+		assert.Equal(t, "john@example.com", user.Email)
 		assert.Equal(t, now, user.CreatedAt)
 		assert.Equal(t, now, user.UpdatedAt)
 	})
@@ -169,20 +323,19 @@ func TestUserRepository_Unit(t *testing.T) {
 
 		repo := NewUserRepository(mock)
 		_, err := repo.GetByID(ctx, testID)
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrNotFound)
 	})
 
 	t.Run("Exists found", func(t *testing.T) {
 		mock := &mockPool{
 			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
-				assert.Equal(t, "John", args[0])
-				assert.Equal(t, "Doe", args[1])
+				assert.Equal(t, "john@example.com", args[0])
 				return &mockRow{vals: []interface{}{testID}}
 			},
 		}
 
 		repo := NewUserRepository(mock)
-		id, err := repo.Exists(ctx, "John", "Doe")
+		id, err := repo.Exists(ctx, "john@example.com")
 		require.NoError(t, err)
 		assert.NotNil(t, id)
 		assert.Equal(t, testID, *id)
@@ -196,7 +349,7 @@ func TestUserRepository_Unit(t *testing.T) {
 		}
 
 		repo := NewUserRepository(mock)
-		id, err := repo.Exists(ctx, "John", "Doe")
+		id, err := repo.Exists(ctx, "john@example.com")
 		require.NoError(t, err)
 		assert.Nil(t, id)
 	})
@@ -206,22 +359,23 @@ func TestUserRepository_Unit(t *testing.T) {
 		createCount := 0
 		mock := &mockPool{
 			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
-				if sql == "\n\t\tSELECT id\n\t\tFROM users \n\t\tWHERE first_name = $1 AND last_name = $2\n\t\tLIMIT 1" {
+				if sql == "\n\t\tSELECT id\n\t\tFROM users\n\t\tWHERE lower(email) = lower($1) AND deleted_at IS NULL\n\t\tLIMIT 1" {
 					existsCount++
 					return &mockRow{err: pgx.ErrNoRows}
 				}
 				createCount++
-				return &mockRow{vals: []interface{}{testID, "John", "Doe", now, now}}
+				return &mockRow{vals: []interface{}{testID, "John", "Doe", "john@example.com", now, now}}
 			},
 		}
 
 		repo := NewUserRepository(mock)
-		user, isNew, err := repo.Create(ctx, "John", "Doe")
+		user, isNew, err := repo.Create(ctx, "John", "Doe", "john@example.com")
 		require.NoError(t, err)
 		assert.True(t, isNew)
 		assert.Equal(t, testID, user.ID)
 		assert.Equal(t, "John", user.FirstName)
 		assert.Equal(t, "Doe", user.LastName)
+		assert.Equal(t, "john@example.com", user.Email)
 		assert.Equal(t, now, user.CreatedAt)
 		assert.Equal(t, now, user.UpdatedAt)
 		assert.Equal(t, 1, existsCount)
@@ -236,9 +390,347 @@ func TestUserRepository_Unit(t *testing.T) {
 		}
 
 		repo := NewUserRepository(mock)
-		user, isNew, err := repo.Create(ctx, "John", "Doe")
+		user, isNew, err := repo.Create(ctx, "John", "Doe", "john@example.com")
 		require.NoError(t, err)
 		assert.False(t, isNew)
 		assert.Equal(t, testID, user.ID)
 	})
+
+	t.Run("Create conflict with a user that can't be found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				if strings.Contains(sql, "INSERT INTO users") {
+					return &mockRow{err: &pgconn.PgError{Code: "23505"}}
+				}
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		_, _, err := repo.Create(ctx, "John", "Doe", "john@example.com")
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	// lockedUser answers the SELECT ... FOR UPDATE issued before a user is changed
+	lockedUser := func(sql string, version int) (pgx.Row, bool) {
+		if !strings.Contains(sql, "FOR UPDATE") {
+			return nil, false
+		}
+		return &mockRow{vals: []interface{}{testID, "John", "Doe", "john@example.com", now, now, version}}, true
+	}
+
+	t.Run("Update success", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				if row, ok := lockedUser(sql, 1); ok {
+					return row
+				}
+				assert.Equal(t, testID, args[0])
+				assert.Equal(t, "Jane", args[1])
+				assert.Equal(t, "Roe", args[2])
+				assert.Equal(t, "jane@example.com", args[3])
+				return &mockRow{vals: []interface{}{testID, "Jane", "Roe", "jane@example.com", now, now, 2}}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		user, err := repo.Update(ctx, testID, Versions{List: []int{1}}, "Jane", "Roe", "jane@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, testID, user.ID)
+		assert.Equal(t, "Jane", user.FirstName)
+		assert.Equal(t, "Roe", user.LastName)
+		assert.Equal(t, "jane@example.com", user.Email)
+		assert.Equal(t, 2, user.Version)
+
+		// Only the changed fields are recorded
+		require.Len(t, mock.audits, 1)
+		assert.Equal(t, AuditUpdate, mock.audits[0][2])
+		assert.Equal(t, testID, mock.audits[0][4])
+		assert.JSONEq(t, `{"first_name":"John","last_name":"Doe","email":"john@example.com","version":1}`,
+			string(mock.audits[0][6].([]byte)))
+		assert.JSONEq(t, `{"first_name":"Jane","last_name":"Roe","email":"jane@example.com","version":2}`,
+			string(mock.audits[0][7].([]byte)))
+
+		// The same change is published to the outbox
+		require.Len(t, mock.events, 1)
+		assert.Equal(t, "user.updated", mock.events[0][1])
+		assert.Equal(t, mock.audits[0][7], mock.events[0][6])
+	})
+
+	t.Run("Update email conflict", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				if row, ok := lockedUser(sql, 1); ok {
+					return row
+				}
+				return &mockRow{err: &pgconn.PgError{Code: "23505"}}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		_, err := repo.Update(ctx, testID, Versions{List: []int{1}}, "Jane", "Roe", "taken@example.com")
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("Update not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		_, err := repo.Update(ctx, testID, Versions{List: []int{1}}, "Jane", "Roe", "jane@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Update stale version", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				row, ok := lockedUser(sql, 3)
+				require.True(t, ok, "nothing may be written for a stale version")
+				return row
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		_, err := repo.Update(ctx, testID, Versions{List: []int{1}}, "Jane", "Roe", "jane@example.com")
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.Contains(t, err.Error(), "version 3, not 1")
+	})
+
+	t.Run("Update any listed version", func(t *testing.T) {
+		for name, versions := range map[string]Versions{
+			"list": {List: []int{2, 3}},
+			"any":  {Any: true},
+		} {
+			mock := &mockPool{
+				queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+					if row, ok := lockedUser(sql, 3); ok {
+						return row
+					}
+					return &mockRow{vals: []interface{}{testID, "Jane", "Roe", "jane@example.com", now, now, 4}}
+				},
+			}
+
+			repo := NewUserRepository(mock)
+			user, err := repo.Update(ctx, testID, versions, "Jane", "Roe", "jane@example.com")
+			require.NoError(t, err, name)
+			assert.Equal(t, 4, user.Version, name)
+		}
+	})
+
+	t.Run("Patch keeps fields changed since the caller read them", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				if strings.Contains(sql, "FOR UPDATE") {
+					// Another request changed the last name and email after the caller read version 1
+					return &mockRow{vals: []interface{}{testID, "John", "Smith", "smith@example.com", now, now, 2}}
+				}
+				assert.Equal(t, []interface{}{testID, "Jane", "Smith", "smith@example.com"}, args)
+				return &mockRow{vals: []interface{}{testID, "Jane", "Smith", "smith@example.com", now, now, 3}}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		firstName := "Jane"
+		user, err := repo.Patch(ctx, testID, Versions{Any: true}, UserPatch{FirstName: &firstName})
+		require.NoError(t, err)
+		assert.Equal(t, "Smith", user.LastName)
+		assert.Equal(t, 3, user.Version)
+	})
+
+	t.Run("Import reports created and duplicate rows", func(t *testing.T) {
+		var copied [][]interface{}
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				assert.Contains(t, sql, "CREATE TEMPORARY TABLE user_import")
+				return pgconn.NewCommandTag("CREATE TABLE"), nil
+			},
+			copyFromFunc: func(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+				assert.Equal(t, pgx.Identifier{"user_import"}, table)
+				for src.Next() {
+					values, err := src.Values()
+					require.NoError(t, err)
+					copied = append(copied, values)
+				}
+				return int64(len(copied)), nil
+			},
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				assert.Contains(t, sql, "ON CONFLICT DO NOTHING")
+				// Only the first row is new
+				return &mockRows{rows: [][]interface{}{{copied[0][1]}}}, nil
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		results, err := repo.Import(ctx, []ImportRow{
+			{Line: 2, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"},
+			{Line: 3, FirstName: "Jane", LastName: "Doe", Email: "JANE@example.com"},
+		})
+		require.NoError(t, err)
+		require.Len(t, copied, 2)
+		assert.Equal(t, 2, copied[0][0])
+		assert.Equal(t, "jane@example.com", copied[0][4])
+
+		require.Len(t, results, 2)
+		assert.Equal(t, ImportResult{Line: 2, Created: true, ID: copied[0][1].(uuid.UUID)}, results[0])
+		assert.Equal(t, ImportResult{Line: 3}, results[1])
+		assert.Len(t, mock.audits, 1, "created users are audited in one statement")
+	})
+
+	t.Run("Export decodes nested phones", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		phones := []byte(`[{"ID":"` + testID.String() + `","UserID":"` + testID.String() + `","Name":"mobile","Number":"+14155552671"}]`)
+		mock := &mockPool{
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				assert.Contains(t, sql, "'[]'::json AS addresses")
+				assert.Contains(t, sql, "FROM phone p")
+				assert.NotContains(t, sql, "LIMIT")
+				assert.Equal(t, []interface{}{"a%"}, args)
+				return &mockRows{rows: [][]interface{}{
+					{testID, "Jane", "Doe", "jane@example.com", now, now, 2, nil, []byte("[]"), phones},
+				}}, nil
+			},
+		}
+
+		var exported []ExportedUser
+		repo := NewUserRepository(mock)
+		err := repo.Export(ctx, UserFilter{NamePrefix: "a"}, "", ExportOptions{Phones: true}, func(u *ExportedUser) error {
+			exported = append(exported, *u)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, exported, 1)
+		assert.Equal(t, 2, exported[0].Version)
+		assert.Empty(t, exported[0].Addresses)
+		require.Len(t, exported[0].Phones, 1)
+		assert.Equal(t, "+14155552671", exported[0].Phones[0].Number)
+	})
+
+	t.Run("Delete soft deletes the user and children", func(t *testing.T) {
+		addressID, phoneID := uuid.New(), uuid.New()
+		var tables []string
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				if row, ok := lockedUser(sql, 1); ok {
+					return row
+				}
+				assert.Contains(t, sql, "SET deleted_at = CURRENT_TIMESTAMP")
+				return &mockRow{vals: []interface{}{testID, "John", "Doe", "john@example.com", now, now, 2, now}}
+			},
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				assert.Equal(t, testID, args[0])
+				assert.Contains(t, sql, "SET deleted_at = CURRENT_TIMESTAMP")
+				if strings.Contains(sql, "UPDATE address") {
+					tables = append(tables, "address")
+					return &mockRows{rows: [][]interface{}{{addressID, now}}}, nil
+				}
+				tables = append(tables, "phone")
+				return &mockRows{rows: [][]interface{}{{phoneID, now}}}, nil
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		require.NoError(t, repo.Delete(ctx, testID))
+		assert.Equal(t, []string{"address", "phone"}, tables)
+
+		require.Len(t, mock.audits, 3)
+		for i, id := range []uuid.UUID{testID, addressID, phoneID} {
+			assert.Equal(t, AuditDelete, mock.audits[i][2])
+			assert.Equal(t, id, mock.audits[i][4])
+			assert.Equal(t, &testID, mock.audits[i][5])
+		}
+	})
+
+	t.Run("Delete not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		err := repo.Delete(ctx, testID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Restore brings back children deleted with the user", func(t *testing.T) {
+		deletedAt := time.Now().UTC()
+		var restored []string
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				if strings.Contains(sql, "FOR UPDATE") {
+					return &mockRow{vals: []interface{}{testID, "Jane", "Doe", "jane@example.com", now, deletedAt, 2, deletedAt}}
+				}
+				assert.Contains(t, sql, "SET deleted_at = NULL")
+				return &mockRow{vals: []interface{}{testID, "Jane", "Doe", "jane@example.com", now, now, 3, nil}}
+			},
+			queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+				assert.Equal(t, testID, args[0])
+				assert.Equal(t, deletedAt, *args[1].(*time.Time))
+				restored = append(restored, sql)
+				return &mockRows{rows: [][]interface{}{{uuid.New(), nil}}}, nil
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		user, err := repo.Restore(ctx, testID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, user.Version)
+		assert.Nil(t, user.DeletedAt)
+		assert.Len(t, restored, 2)
+
+		require.Len(t, mock.audits, 3)
+		assert.Equal(t, AuditRestore, mock.audits[0][2])
+		assert.JSONEq(t, `{"deleted_at":null}`, string(mock.audits[1][7].([]byte)))
+	})
+
+	t.Run("Restore user that isn't deleted", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{vals: []interface{}{testID, "Jane", "Doe", "jane@example.com", now, now, 1, nil}}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		_, err := repo.Restore(ctx, testID)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("Restore not found", func(t *testing.T) {
+		mock := &mockPool{
+			queryRowFunc: func(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+				return &mockRow{err: pgx.ErrNoRows}
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		_, err := repo.Restore(ctx, testID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Purge removes children before users", func(t *testing.T) {
+		before := time.Now().AddDate(0, 0, -30)
+		var statements []string
+		mock := &mockPool{
+			execFunc: func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+				assert.Equal(t, before, args[0])
+				statements = append(statements, sql)
+				// Only the users count is returned, however many addresses and phones went with them
+				if strings.Contains(sql, "DELETE FROM users") {
+					return pgconn.NewCommandTag("DELETE 2"), nil
+				}
+				return pgconn.NewCommandTag("DELETE 5"), nil
+			},
+		}
+
+		repo := NewUserRepository(mock)
+		n, err := repo.Purge(ctx, before)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		require.Len(t, statements, 3)
+		assert.Contains(t, statements[2], "DELETE FROM users")
+		assert.Len(t, mock.audits, 3, "each purged table is audited before it's deleted from")
+	})
 }
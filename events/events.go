@@ -0,0 +1,184 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"frame/config"
+	"frame/logging"
+	"frame/models"
+	"frame/webhook"
+
+	"go.uber.org/zap"
+)
+
+// Event is a change ready to be written to a Server-Sent Events stream
+type Event struct {
+	ID   string
+	Type string
+	Data []byte
+}
+
+// FromOutbox converts an outbox event to a stream event
+// The data is the same JSON document posted to webhooks
+func FromOutbox(e models.OutboxEvent) Event {
+	data, _ := json.Marshal(webhook.NewPayload(&e)) // maps decoded from JSON always marshal
+	return Event{ID: e.ID.String(), Type: e.Type, Data: data}
+}
+
+// Subscription receives the events published after it was made
+// Events is closed when the subscriber falls too far behind, is unsubscribed or the broker is closed.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+}
+
+// Broker fans published events out to every subscriber and keeps the most recent ones for replay
+// A subscriber whose queue is full is dropped instead of making Publish wait, so one slow client
+// can't hold up the others. It can reconnect and resume from the last event it received.
+type Broker struct {
+	mu           sync.Mutex
+	recent       []Event // ring buffer of the last replaySize events, oldest at start
+	start        int
+	replaySize   int
+	clientBuffer int
+	subs         map[*Subscription]struct{}
+}
+
+// NewBroker creates a broker replaying up to replaySize events and queueing up to clientBuffer per subscriber
+func NewBroker(replaySize, clientBuffer int) *Broker {
+	return &Broker{
+		recent:       make([]Event, 0, replaySize),
+		replaySize:   replaySize,
+		clientBuffer: clientBuffer,
+		subs:         map[*Subscription]struct{}{},
+	}
+}
+
+// Publish records an event for replay and queues it for every subscriber
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.replaySize > 0 {
+		if len(b.recent) < b.replaySize {
+			b.recent = append(b.recent, e)
+		} else {
+			b.recent[b.start] = e
+			b.start = (b.start + 1) % b.replaySize
+		}
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.events <- e:
+		default:
+			delete(b.subs, sub)
+			close(sub.events)
+			logging.GetLogger().Warn("Dropped slow event stream subscriber",
+				zap.Int("queued", b.clientBuffer))
+		}
+	}
+}
+
+// Subscribe starts receiving events published from now on
+// lastID is the ID of the last event the client received, empty for a new client. The events
+// published after it are returned for replay. resumed is false when lastID has left the replay
+// buffer, in which case events may have been missed and nothing is replayed.
+func (b *Broker) Subscribe(lastID string) (sub *Subscription, replay []Event, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan Event, b.clientBuffer)
+	sub = &Subscription{Events: events, events: events}
+	b.subs[sub] = struct{}{}
+
+	if lastID == "" {
+		return sub, nil, true
+	}
+	ordered := append(append([]Event{}, b.recent[b.start:]...), b.recent[:b.start]...)
+	for i, e := range ordered {
+		if e.ID == lastID {
+			return sub, ordered[i+1:], true
+		}
+	}
+	return sub, nil, false
+}
+
+// Unsubscribe stops delivering events to sub and closes its channel
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Close closes the channel of every subscriber, ending their streams
+// It is called when the server shuts down, as event streams would otherwise keep it from draining.
+// Clients reconnect to another instance and resume from the last event they received.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Bounds on the wait before listening again after the connection failed
+const (
+	minListenRetry = time.Second
+	maxListenRetry = 30 * time.Second
+)
+
+// Listen publishes the events announced through listen until ctx is done, listening again
+// whenever it fails. listen is db.ListenUserEvents outside of tests.
+func (b *Broker) Listen(ctx context.Context, listen func(context.Context, func(models.OutboxEvent)) error) {
+	wait := minListenRetry
+	for {
+		started := time.Now()
+		err := listen(ctx, func(e models.OutboxEvent) { b.Publish(FromOutbox(e)) })
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > maxListenRetry {
+			wait = minListenRetry
+		}
+		logging.GetLogger().Error("Stopped listening for events, retrying",
+			zap.Duration("retry_in", wait),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxListenRetry)
+	}
+}
+
+var (
+	broker   *Broker
+	brokerMu sync.RWMutex
+)
+
+// Initialize creates the broker returned by GetBroker
+func Initialize(cfg config.EventsConfig) *Broker {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+	broker = NewBroker(cfg.ReplayBuffer, cfg.ClientBuffer)
+	return broker
+}
+
+// GetBroker returns the broker of the server, nil until Initialize is called
+func GetBroker() *Broker {
+	brokerMu.RLock()
+	defer brokerMu.RUnlock()
+	return broker
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"frame/config"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func event(n int) Event {
+	return Event{ID: fmt.Sprint(n), Type: "user.created", Data: []byte("{}")}
+}
+
+func ids(events []Event) []string {
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestMain(m *testing.M) {
+	viper.Set("config", &config.Config{})
+	if err := logging.Initialize(); err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestBrokerReplay(t *testing.T) {
+	b := NewBroker(3, 10)
+	for i := 1; i <= 5; i++ {
+		b.Publish(event(i))
+	}
+
+	_, replay, resumed := b.Subscribe("3")
+	assert.True(t, resumed)
+	assert.Equal(t, []string{"4", "5"}, ids(replay))
+
+	_, replay, resumed = b.Subscribe("5")
+	assert.True(t, resumed)
+	assert.Empty(t, replay)
+
+	// Event 1 has been pushed out of the buffer by later events
+	_, replay, resumed = b.Subscribe("1")
+	assert.False(t, resumed)
+	assert.Empty(t, replay)
+
+	_, replay, resumed = b.Subscribe("")
+	assert.True(t, resumed)
+	assert.Empty(t, replay)
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	b := NewBroker(10, 2)
+	slow, _, _ := b.Subscribe("")
+	fast, _, _ := b.Subscribe("")
+
+	b.Publish(event(1))
+	b.Publish(event(2))
+	assert.Equal(t, []string{"1", "2"}, ids([]Event{<-fast.Events, <-fast.Events}))
+
+	// The slow subscriber's queue is full, so it's dropped instead of holding up the fast one
+	b.Publish(event(3))
+	assert.Equal(t, "3", (<-fast.Events).ID)
+
+	var got []Event
+	for e := range slow.Events {
+		got = append(got, e)
+	}
+	assert.Equal(t, []string{"1", "2"}, ids(got))
+
+	// Unsubscribing a dropped subscriber is harmless
+	b.Unsubscribe(slow)
+	b.Unsubscribe(fast)
+	_, open := <-fast.Events
+	assert.False(t, open)
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(10, 10)
+	sub, _, _ := b.Subscribe("")
+	b.Publish(event(1))
+
+	b.Close()
+	// Queued events are still delivered before the channel is closed
+	assert.Equal(t, "1", (<-sub.Events).ID)
+	_, open := <-sub.Events
+	assert.False(t, open)
+
+	// Unsubscribing afterwards is harmless, and later subscribers are served as usual
+	b.Unsubscribe(sub)
+	later, _, _ := b.Subscribe("1")
+	b.Publish(event(2))
+	assert.Equal(t, "2", (<-later.Events).ID)
+}
+
+func TestBrokerListen(t *testing.T) {
+	b := NewBroker(10, 10)
+	sub, _, _ := b.Subscribe("")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID := uuid.New()
+	calls := 0
+	listen := func(ctx context.Context, fn func(models.OutboxEvent)) error {
+		calls++
+		if calls == 1 {
+			return errors.New("connection lost")
+		}
+		fn(models.OutboxEvent{ID: uuid.New(), Type: "user.updated", Entity: "user", EntityID: userID,
+			After: map[string]any{"first_name": "Jane"}})
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Listen(ctx, listen)
+	}()
+
+	select {
+	case e := <-sub.Events:
+		assert.Equal(t, "user.updated", e.Type)
+		var data map[string]any
+		require.NoError(t, json.Unmarshal(e.Data, &data))
+		assert.Equal(t, userID.String(), data["entity_id"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after listening again")
+	}
+
+	cancel()
+	<-done
+	assert.Equal(t, 2, calls)
+}
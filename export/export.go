@@ -0,0 +1,284 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"frame/db"
+	"frame/models"
+)
+
+// Format is the file format of an export
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+	JSON   Format = "json"
+)
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case CSV, NDJSON, JSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, expected csv, ndjson or json", name)
+}
+
+// ContentType returns the media type of files in the format
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// Source streams the users to export, implemented by db.UserRepository
+type Source interface {
+	Export(ctx context.Context, filter db.UserFilter, sort string, opts db.ExportOptions, fn func(*db.ExportedUser) error) error
+}
+
+// User is the exported form of a user, using the same field names as the API
+type User struct {
+	ID        string     `json:"id"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Addresses []Address  `json:"addresses,omitempty"`
+	Phones    []Phone    `json:"phones,omitempty"`
+}
+
+// Address is the exported form of an address
+type Address struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Street    string    `json:"street,omitempty"`
+	Suite     string    `json:"suite,omitempty"`
+	City      string    `json:"city,omitempty"`
+	State     string    `json:"state,omitempty"`
+	Zip       string    `json:"zip,omitempty"`
+	IsPrimary bool      `json:"is_primary"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Phone is the exported form of a phone number
+type Phone struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Number    string    `json:"number"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// newUser converts an exported user row to its exported form
+func newUser(u *db.ExportedUser) User {
+	user := User{
+		ID:        u.ID.String(),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		DeletedAt: u.DeletedAt,
+	}
+	for _, a := range u.Addresses {
+		user.Addresses = append(user.Addresses, newAddress(a))
+	}
+	for _, p := range u.Phones {
+		user.Phones = append(user.Phones, Phone{
+			ID:        p.ID.String(),
+			Name:      p.Name,
+			Number:    p.Number,
+			CreatedAt: p.CreatedAt,
+			UpdatedAt: p.UpdatedAt,
+		})
+	}
+	return user
+}
+
+func newAddress(a models.Address) Address {
+	return Address{
+		ID:        a.ID.String(),
+		Name:      a.Name,
+		Street:    a.Street,
+		Suite:     a.Suite,
+		City:      a.City,
+		State:     a.State,
+		Zip:       a.Zip,
+		IsPrimary: a.IsPrimary,
+		CreatedAt: a.CreatedAt,
+		UpdatedAt: a.UpdatedAt,
+	}
+}
+
+// recordWriter writes users one at a time in a file format
+type recordWriter interface {
+	Write(user User) error
+	// Close finishes the file, it doesn't close the underlying writer
+	Close() error
+}
+
+// Users writes every user from src matching filter to w and returns how many were written
+// Users are encoded as they are read, so memory use doesn't grow with the size of the export.
+// In CSV files the addresses and phones columns hold JSON arrays.
+func Users(ctx context.Context, src Source, w io.Writer, format Format, filter db.UserFilter, sort string, opts db.ExportOptions) (int, error) {
+	buf := bufio.NewWriter(w)
+
+	var rw recordWriter
+	switch format {
+	case CSV:
+		rw = newCSVWriter(buf, opts)
+	case NDJSON:
+		rw = &ndjsonWriter{enc: json.NewEncoder(buf)}
+	case JSON:
+		rw = &jsonWriter{w: buf}
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	count := 0
+	err := src.Export(ctx, filter, sort, opts, func(u *db.ExportedUser) error {
+		count++
+		return rw.Write(newUser(u))
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if err := rw.Close(); err != nil {
+		return count, err
+	}
+	return count, buf.Flush()
+}
+
+// ndjsonWriter writes one JSON object per line
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(user User) error { return nw.enc.Encode(user) }
+func (nw *ndjsonWriter) Close() error          { return nil }
+
+// jsonWriter writes a single JSON array, one element at a time
+type jsonWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (jw *jsonWriter) Write(user User) error {
+	sep := ",\n"
+	if jw.count == 0 {
+		sep = "[\n"
+	}
+	jw.count++
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	if _, err := jw.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = jw.w.Write(data)
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "\n]\n"
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+	_, err := jw.w.WriteString(end)
+	return err
+}
+
+// csvWriter writes a header followed by one record per user
+type csvWriter struct {
+	w      *csv.Writer
+	opts   db.ExportOptions
+	header bool
+}
+
+func newCSVWriter(w io.Writer, opts db.ExportOptions) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w), opts: opts}
+}
+
+// columns returns the CSV header
+func (cw *csvWriter) columns() []string {
+	columns := []string{"id", "first_name", "last_name", "email", "created_at", "updated_at", "deleted_at"}
+	if cw.opts.Addresses {
+		columns = append(columns, "addresses")
+	}
+	if cw.opts.Phones {
+		columns = append(columns, "phones")
+	}
+	return columns
+}
+
+func (cw *csvWriter) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+	cw.header = true
+	return cw.w.Write(cw.columns())
+}
+
+func (cw *csvWriter) Write(user User) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+
+	record := []string{
+		user.ID,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.CreatedAt.Format(time.RFC3339Nano),
+		user.UpdatedAt.Format(time.RFC3339Nano),
+		"",
+	}
+	if user.DeletedAt != nil {
+		record[6] = user.DeletedAt.Format(time.RFC3339Nano)
+	}
+	if cw.opts.Addresses {
+		record = append(record, jsonColumn(user.Addresses))
+	}
+	if cw.opts.Phones {
+		record = append(record, jsonColumn(user.Phones))
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	// An empty export still gets its header
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonColumn encodes nested records for a CSV column, using [] when there are none
+func jsonColumn[T any](records []T) string {
+	if len(records) == 0 {
+		return "[]"
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
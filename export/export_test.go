@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/db"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceSource exports a fixed list of users
+type sliceSource struct {
+	users []db.ExportedUser
+	err   error
+}
+
+func (s *sliceSource) Export(ctx context.Context, filter db.UserFilter, sort string, opts db.ExportOptions, fn func(*db.ExportedUser) error) error {
+	for i := range s.users {
+		if err := fn(&s.users[i]); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func testUsers() []db.ExportedUser {
+	created := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	first := db.ExportedUser{User: models.User{ID: uuid.New(), FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", CreatedAt: created, UpdatedAt: created}}
+	first.Phones = []models.Phone{{ID: uuid.New(), Name: "mobile", Number: "+14155552671", CreatedAt: created, UpdatedAt: created}}
+	second := db.ExportedUser{User: models.User{ID: uuid.New(), FirstName: "John", LastName: "Roe, Jr.", CreatedAt: created, UpdatedAt: created}}
+	return []db.ExportedUser{first, second}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"csv", "ndjson", "json"} {
+		f, err := ParseFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, Format(name), f)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	users := testUsers()
+	opts := db.ExportOptions{Phones: true}
+
+	t.Run("ndjson", func(t *testing.T) {
+		var buf bytes.Buffer
+		count, err := Users(ctx, &sliceSource{users: users}, &buf, NDJSON, db.UserFilter{}, "", opts)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		var got User
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+		assert.Equal(t, users[0].ID.String(), got.ID)
+		require.Len(t, got.Phones, 1)
+		assert.Equal(t, "+14155552671", got.Phones[0].Number)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Users(ctx, &sliceSource{users: users}, &buf, JSON, db.UserFilter{}, "", opts)
+		require.NoError(t, err)
+
+		var got []User
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+		require.Len(t, got, 2)
+		assert.Equal(t, "Roe, Jr.", got[1].LastName)
+	})
+
+	t.Run("empty json", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Users(ctx, &sliceSource{}, &buf, JSON, db.UserFilter{}, "", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "[]\n", buf.String())
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Users(ctx, &sliceSource{users: users}, &buf, CSV, db.UserFilter{}, "", opts)
+		require.NoError(t, err)
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, []string{"id", "first_name", "last_name", "email", "created_at", "updated_at", "deleted_at", "phones"}, records[0])
+		assert.Equal(t, "2026-10-17T10:00:00Z", records[1][4])
+		assert.Contains(t, records[1][7], `"number":"+14155552671"`)
+		assert.Equal(t, "Roe, Jr.", records[2][2])
+		assert.Equal(t, "[]", records[2][7])
+	})
+
+	t.Run("empty csv has a header", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Users(ctx, &sliceSource{}, &buf, CSV, db.UserFilter{}, "", db.ExportOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "id,first_name,last_name,email,created_at,updated_at,deleted_at\n", buf.String())
+	})
+
+	t.Run("source error", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Users(ctx, &sliceSource{users: users, err: assert.AnError}, &buf, NDJSON, db.UserFilter{}, "", opts)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -0,0 +1,117 @@
+package health
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of a whole report
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Check reports why a dependency can't serve requests, nil when it can
+// It must return once ctx is done, as readiness probes wait for every check.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every registered check, failing when any of them fails
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Registry holds the checks deciding whether the server is ready
+// Dependencies register their own check, so readiness covers them without the caller knowing them.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// NewRegistry creates a registry without checks
+func NewRegistry() *Registry {
+	return &Registry{checks: map[string]Check{}}
+}
+
+// Register adds a check under name, replacing the check already registered under it
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// Unregister removes the check registered under name
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+}
+
+// Run runs every check concurrently and reports their results sorted by name
+// A registry without checks is ready.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := maps.Clone(r.checks)
+	r.mu.RUnlock()
+
+	results := make([]Result, 0, len(checks))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range checks {
+		wg.Go(func() {
+			started := time.Now()
+			err := check(ctx)
+			result := Result{
+				Name:      name,
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status, result.Error = StatusFailing, err.Error()
+			}
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	slices.SortFunc(results, func(a, b Result) int { return strings.Compare(a.Name, b.Name) })
+	report := Report{Status: StatusOK, Checks: results}
+	if slices.ContainsFunc(results, func(r Result) bool { return r.Status != StatusOK }) {
+		report.Status = StatusFailing
+	}
+	return report
+}
+
+// registry holds the checks of the server
+var registry = NewRegistry()
+
+// Register adds a check to the readiness checks of the server
+func Register(name string, check Check) {
+	registry.Register(name, check)
+}
+
+// GetRegistry returns the registry holding the readiness checks of the server
+func GetRegistry() *Registry {
+	return registry
+}
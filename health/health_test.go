@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	assert.Equal(t, Report{Status: StatusOK, Checks: []Result{}}, r.Run(context.Background()), "no checks is ready")
+
+	r.Register("server", func(context.Context) error { return nil })
+	r.Register("database", func(context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("last 3 pings failed")
+	})
+
+	report := r.Run(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, StatusFailing, report.Status)
+	require.Len(t, report.Checks, 2)
+
+	database := report.Checks[0]
+	assert.Equal(t, "database", database.Name)
+	assert.Equal(t, StatusFailing, database.Status)
+	assert.Equal(t, "last 3 pings failed", database.Error)
+	assert.GreaterOrEqual(t, database.LatencyMS, 10.0)
+	assert.Equal(t, Result{Name: "server", Status: StatusOK, LatencyMS: report.Checks[1].LatencyMS}, report.Checks[1])
+
+	// Registering under the same name replaces the check
+	r.Register("database", func(context.Context) error { return nil })
+	assert.True(t, r.Run(context.Background()).OK())
+
+	r.Register("cache", func(context.Context) error { return errors.New("unreachable") })
+	assert.False(t, r.Run(context.Background()).OK())
+	r.Unregister("cache")
+	assert.True(t, r.Run(context.Background()).OK())
+}
+
+func TestRegistryRunsChecksConcurrently(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		r.Register(name, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	report := r.Run(ctx)
+	assert.Less(t, time.Since(started), 150*time.Millisecond, "checks share the timeout")
+	for _, result := range report.Checks {
+		assert.Equal(t, context.DeadlineExceeded.Error(), result.Error)
+	}
+}
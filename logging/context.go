@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// requestLogKey keys the requestLog stored in a context
+type requestLogKey struct{}
+
+// requestLog holds the fields shared by every log line of a request
+// It is shared by every context derived from the request's, so fields added deep in the handler
+// chain, such as the principal, also appear in the request line written by Middleware.
+type requestLog struct {
+	id     string
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+// NewContext returns a context whose loggers carry the request ID and fields
+func NewContext(ctx context.Context, requestID string, fields ...zap.Field) context.Context {
+	rl := &requestLog{id: requestID, fields: append([]zap.Field{zap.String("request_id", requestID)}, fields...)}
+	return context.WithValue(ctx, requestLogKey{}, rl)
+}
+
+// AddFields adds fields to every later log line of the request of ctx
+// It does nothing when ctx doesn't belong to a request.
+func AddFields(ctx context.Context, fields ...zap.Field) {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		rl.fields = append(rl.fields, fields...)
+	}
+}
+
+// RequestID returns the ID of the request of ctx, empty when it doesn't belong to a request
+func RequestID(ctx context.Context) string {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.id
+	}
+	return ""
+}
+
+// FromContext returns the logger with the fields of the request of ctx, such as request_id, method,
+// path and principal, so the lines logged while serving a request can be joined
+// It returns the plain logger when ctx doesn't belong to a request.
+func FromContext(ctx context.Context) *zap.Logger {
+	l := GetLogger()
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok || l == nil {
+		return l
+	}
+	rl.mu.Lock()
+	fields := slices.Clone(rl.fields)
+	rl.mu.Unlock()
+	return l.With(fields...)
+}
@@ -7,6 +7,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -100,22 +101,35 @@ func IsDebugMode() bool {
 	return GetLogLevel() == zapcore.DebugLevel
 }
 
+// RequestIDHeader carries the identifier correlating a request with its logs
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients, longer ones are replaced
+const maxRequestIDLength = 128
+
 // Middleware creates a logging middleware that logs HTTP requests
+// The request ID supplied by the client or a proxy is kept, or one is generated, and echoed in the
+// response. It is stored in the request context with the method and path for FromContext.
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := NewContext(r.Context(), id, zap.String("method", r.Method), zap.String("path", r.URL.Path))
+
 		// Create a response writer wrapper to capture the status code
 		rw := &responseWriter{w, http.StatusOK}
 
 		// Call the next handler
-		next.ServeHTTP(rw, r)
+		next.ServeHTTP(rw, r.WithContext(ctx))
 
 		// Log the request details
-		if l := logger.Load(); l != nil {
+		if l := FromContext(ctx); l != nil {
 			l.Info("HTTP Request",
-				zap.String("method", r.Method),
-				zap.String("path", r.URL.Path),
 				zap.String("remote_addr", r.RemoteAddr),
 				zap.Int("status", rw.status),
 				zap.Duration("latency", time.Since(start)),
@@ -125,6 +139,20 @@ func Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// validRequestID reports whether a client supplied request ID is short and printable ASCII,
+// so it can't forge log lines or bloat them
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
 // responseWriter is a wrapper around http.ResponseWriter that captures the status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -136,3 +164,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush streamed responses
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
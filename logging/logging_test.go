@@ -1,14 +1,18 @@
 package logging
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestLoggingInitialization(t *testing.T) {
@@ -117,3 +121,69 @@ func TestMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "OK", rr.Body.String())
 }
+
+// observe replaces the logger with one recording every entry until the test ends
+func observe(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.DebugLevel)
+	previous := logger.Load()
+	logger.Store(zap.New(core))
+	t.Cleanup(func() { logger.Store(previous) })
+	return logs
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	logs := observe(t)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddFields(r.Context(), zap.String("principal", "api_key:abcdefgh"))
+		FromContext(r.Context()).Info("Handled")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("req-123")
+	assert.Equal(t, "req-123", rr.Header().Get(RequestIDHeader))
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		fields := entry.ContextMap()
+		assert.Equal(t, "req-123", fields["request_id"], entry.Message)
+		assert.Equal(t, http.MethodPost, fields["method"], entry.Message)
+		assert.Equal(t, "/users", fields["path"], entry.Message)
+		assert.Equal(t, "api_key:abcdefgh", fields["principal"], entry.Message)
+	}
+	assert.Equal(t, int64(http.StatusTeapot), entries[1].ContextMap()["status"])
+
+	// Missing and unsafe IDs are replaced with a generated one
+	for _, id := range []string{"", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		generated := serve(id).Header().Get(RequestIDHeader)
+		assert.NotEqual(t, id, generated)
+		assert.Len(t, generated, 36)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	logs := observe(t)
+
+	// Outside a request the plain logger is returned and AddFields does nothing
+	ctx := context.Background()
+	AddFields(ctx, zap.String("principal", "ignored"))
+	FromContext(ctx).Info("Background")
+	assert.Empty(t, logs.TakeAll()[0].Context)
+	assert.Empty(t, RequestID(ctx))
+
+	ctx = NewContext(ctx, "req-456")
+	assert.Equal(t, "req-456", RequestID(ctx))
+	FromContext(ctx).Info("Request")
+	assert.Equal(t, map[string]any{"request_id": "req-456"}, logs.TakeAll()[0].ContextMap())
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"frame/api"
+	"frame/auth"
 	"frame/config"
+	"frame/db"
+	"frame/export"
 	"frame/hello"
 	"frame/logging"
 	"frame/server"
@@ -12,6 +22,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
 )
 
 func main() {
@@ -75,12 +86,28 @@ func main() {
 		Use:   "serve",
 		Short: "Start HTTP API server",
 		Run: func(cmd *cobra.Command, args []string) {
+			// The exit code tells supervisors whether the server shut down cleanly
 			if err := server.Start(); err != nil {
 				fmt.Println("Server error:", err)
+				os.Exit(1)
 			}
 		},
 	})
 
+	// Add export command
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export data from the database",
+	}
+	exportCmd.AddCommand(newExportUsersCommand())
+	rootCmd.AddCommand(exportCmd)
+
+	// Add apikey command
+	rootCmd.AddCommand(newAPIKeyCommand())
+
+	// Add routes command
+	rootCmd.AddCommand(newRoutesCommand())
+
 	// Add version command
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -98,3 +125,212 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newExportUsersCommand creates the command streaming users to a file or stdout
+// It accepts the same filters as GET /users:export
+func newExportUsersCommand() *cobra.Command {
+	var (
+		format       string
+		output       string
+		email        string
+		namePrefix   string
+		createdAfter string
+		sort         string
+		include      []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "users",
+		Short: "Export users as CSV, NDJSON or JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := export.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+
+			filter := db.UserFilter{Email: email, NamePrefix: namePrefix}
+			if createdAfter != "" {
+				if filter.CreatedAfter, err = time.Parse(time.RFC3339, createdAfter); err != nil {
+					return fmt.Errorf("--created-after must be an RFC 3339 timestamp: %v", err)
+				}
+			}
+
+			var opts db.ExportOptions
+			for _, name := range include {
+				switch name {
+				case "addresses":
+					opts.Addresses = true
+				case "phones":
+					opts.Phones = true
+				default:
+					return fmt.Errorf("--include must list addresses or phones, not %q", name)
+				}
+			}
+
+			w := os.Stdout
+			if output == "-" {
+				// Logs are written to stdout too, keep them out of the exported file
+				if err := logging.SetLogLevel(zapcore.ErrorLevel); err != nil {
+					return err
+				}
+			} else {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				w = file
+			}
+
+			ctx := cmd.Context()
+			if err := db.Initialize(ctx); err != nil {
+				return err
+			}
+			defer db.Close()
+
+			count, err := export.Users(ctx, db.NewUserRepository(db.GetPool()), w, f, filter, sort, opts)
+			if err != nil {
+				return err
+			}
+			if output != "-" {
+				fmt.Fprintf(os.Stderr, "Exported %d users to %s\n", count, output)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", string(export.NDJSON), "Output format: csv, ndjson or json")
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "File to write, - for stdout")
+	cmd.Flags().StringVar(&email, "email", "", "Only export the user with this email")
+	cmd.Flags().StringVar(&namePrefix, "name-prefix", "", "Only export users whose first or last name starts with this prefix")
+	cmd.Flags().StringVar(&createdAfter, "created-after", "", "Only export users created after this RFC 3339 timestamp")
+	cmd.Flags().StringVar(&sort, "sort", "", "Sort key: created_at, first_name or last_name, prefix with - for descending")
+	cmd.Flags().StringSliceVar(&include, "include", nil, "Related records to include: addresses, phones")
+
+	return cmd
+}
+
+// newAPIKeyCommand creates the commands managing the API keys clients authenticate with
+func newAPIKeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys",
+	}
+
+	var name string
+	var scopes []string
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key and print it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, scope := range scopes {
+				if !slices.Contains(auth.Scopes, scope) {
+					return fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(auth.Scopes, ", "))
+				}
+			}
+
+			return withAPIKeys(cmd.Context(), func(ctx context.Context, repo *db.APIKeyRepository) error {
+				key, prefix, hash, err := auth.NewKey()
+				if err != nil {
+					return err
+				}
+				if _, err := repo.Create(ctx, name, prefix, hash, scopes); err != nil {
+					return err
+				}
+
+				// Only the key goes to stdout so it can be captured by scripts
+				fmt.Fprintf(os.Stderr, "Created API key %q with prefix %s, it won't be shown again\n", name, prefix)
+				fmt.Println(key)
+				return nil
+			})
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "Name describing who uses the key")
+	_ = create.MarkFlagRequired("name")
+	create.Flags().StringSliceVar(&scopes, "scope", nil, "Scope granted to the key, repeat or separate with commas: "+strings.Join(auth.Scopes, ", "))
+	_ = create.MarkFlagRequired("scope")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withAPIKeys(cmd.Context(), func(ctx context.Context, repo *db.APIKeyRepository) error {
+				keys, err := repo.List(ctx)
+				if err != nil {
+					return err
+				}
+
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "PREFIX\tNAME\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+				for _, k := range keys {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.Prefix, k.Name, strings.Join(k.Scopes, ","),
+						k.CreatedAt.Format(time.RFC3339), formatOptionalTime(k.LastUsedAt), formatOptionalTime(k.RevokedAt))
+				}
+				return tw.Flush()
+			})
+		},
+	}
+
+	revoke := &cobra.Command{
+		Use:   "revoke <prefix>",
+		Short: "Revoke an API key so it can no longer authenticate",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withAPIKeys(cmd.Context(), func(ctx context.Context, repo *db.APIKeyRepository) error {
+				if err := repo.Revoke(ctx, args[0]); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Revoked API key %s\n", args[0])
+				return nil
+			})
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
+
+// newRoutesCommand creates the command printing every route with the scope it requires
+// It reads the route table of the API, so its output is what the server enforces
+func newRoutesCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "routes",
+		Short: "Print every API route and the scope callers need to use it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "METHOD\tPATH\tSCOPE\tSUMMARY")
+			for _, route := range api.Routes() {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", route.Method, route.Path, route.Scope, route.Summary)
+			}
+			for _, path := range api.PublicPaths() {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", http.MethodGet, path, "-", "Served without authentication")
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+// withAPIKeys connects to the database and runs fn with the API key repository
+func withAPIKeys(ctx context.Context, fn func(ctx context.Context, repo *db.APIKeyRepository) error) error {
+	// Keep logs out of the command output
+	if err := logging.SetLogLevel(zapcore.ErrorLevel); err != nil {
+		return err
+	}
+	if err := db.Initialize(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(ctx, db.NewAPIKeyRepository(db.GetPool()))
+}
+
+// formatOptionalTime formats t as RFC 3339, or - when it isn't set
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,2 @@
+-- Create index "users_email_key" to table: "users"
+CREATE UNIQUE INDEX "users_email_key" ON "users" ((lower((email)::text))) WHERE (email IS NOT NULL);
@@ -0,0 +1,6 @@
+-- Modify "address" table
+ALTER TABLE "address" ADD COLUMN "is_primary" boolean NOT NULL DEFAULT false;
+-- Create index "address_user_id_idx" to table: "address"
+CREATE INDEX "address_user_id_idx" ON "address" ("user_id");
+-- Create index "address_user_primary_key" to table: "address"
+CREATE UNIQUE INDEX "address_user_primary_key" ON "address" ("user_id") WHERE is_primary;
@@ -0,0 +1,2 @@
+-- Create index "phone_user_number_key" to table: "phone"
+CREATE UNIQUE INDEX "phone_user_number_key" ON "phone" ("user_id", "number");
@@ -0,0 +1,6 @@
+-- Normalize whitespace in existing exercise names
+UPDATE "exercise_names" SET "name" = regexp_replace(btrim("name"), '\s+', ' ', 'g');
+-- Create index "exercise_names_name_key" to table: "exercise_names"
+CREATE UNIQUE INDEX "exercise_names_name_key" ON "exercise_names" ((lower(name)));
+-- Create index "exercise_names_name_prefix_idx" to table: "exercise_names"
+CREATE INDEX "exercise_names_name_prefix_idx" ON "exercise_names" ((lower(name)) text_pattern_ops);
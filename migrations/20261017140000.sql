@@ -0,0 +1,2 @@
+-- Create index "users_created_at_id_idx" to table: "users"
+CREATE INDEX "users_created_at_id_idx" ON "users" ("created_at", "id");
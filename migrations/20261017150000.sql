@@ -0,0 +1,17 @@
+-- Create "idempotency_keys" table
+CREATE TABLE "idempotency_keys" (
+  "principal" text NOT NULL,
+  "key" text NOT NULL,
+  "method" text NOT NULL,
+  "path" text NOT NULL,
+  "request_hash" text NOT NULL,
+  "status_code" integer NULL,
+  "headers" jsonb NULL,
+  "body" bytea NULL,
+  "created_at" timestamptz NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "locked_until" timestamptz NULL,
+  PRIMARY KEY ("principal", "key", "method", "path")
+);
+-- Create index "idempotency_keys_expires_at_idx" to table: "idempotency_keys"
+CREATE INDEX "idempotency_keys_expires_at_idx" ON "idempotency_keys" ("expires_at");
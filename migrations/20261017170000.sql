@@ -0,0 +1,12 @@
+-- Modify "users" table
+ALTER TABLE "users" ADD COLUMN "deleted_at" timestamptz NULL;
+-- Modify "address" table
+ALTER TABLE "address" ADD COLUMN "deleted_at" timestamptz NULL;
+-- Modify "phone" table
+ALTER TABLE "phone" ADD COLUMN "deleted_at" timestamptz NULL;
+-- Drop index "users_email_key" from table: "users"
+DROP INDEX "users_email_key";
+-- Create index "users_email_key" to table: "users"
+CREATE UNIQUE INDEX "users_email_key" ON "users" ((lower((email)::text))) WHERE ((email IS NOT NULL) AND (deleted_at IS NULL));
+-- Create index "users_deleted_at_idx" to table: "users"
+CREATE INDEX "users_deleted_at_idx" ON "users" ("deleted_at") WHERE (deleted_at IS NOT NULL);
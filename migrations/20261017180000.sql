@@ -0,0 +1,16 @@
+-- Create "audit_log" table
+CREATE TABLE "audit_log" (
+  "id" uuid NOT NULL,
+  "actor" text NULL,
+  "action" text NOT NULL,
+  "entity" text NOT NULL,
+  "entity_id" uuid NOT NULL,
+  "user_id" uuid NULL,
+  "before" jsonb NULL,
+  "after" jsonb NULL,
+  "request_id" text NULL,
+  "created_at" timestamptz NOT NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "audit_log_user_id_created_at_idx" to table: "audit_log"
+CREATE INDEX "audit_log_user_id_created_at_idx" ON "audit_log" ("user_id", "created_at", "id");
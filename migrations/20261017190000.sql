@@ -0,0 +1,24 @@
+-- Create "outbox" table
+CREATE TABLE "outbox" (
+  "id" uuid NOT NULL,
+  "event_type" text NOT NULL,
+  "entity" text NOT NULL,
+  "entity_id" uuid NOT NULL,
+  "user_id" uuid NULL,
+  "before" jsonb NULL,
+  "after" jsonb NULL,
+  "created_at" timestamptz NOT NULL,
+  "status" text NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL,
+  "delivered_to" text[] NOT NULL DEFAULT '{}',
+  "last_error" text NULL,
+  "delivered_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "outbox_created_at_id_idx" to table: "outbox"
+CREATE INDEX "outbox_created_at_id_idx" ON "outbox" ("created_at", "id");
+-- Create index "outbox_pending_idx" to table: "outbox"
+CREATE INDEX "outbox_pending_idx" ON "outbox" ("next_attempt_at") WHERE (status = 'pending'::text);
+-- Create index "outbox_delivered_at_idx" to table: "outbox"
+CREATE INDEX "outbox_delivered_at_idx" ON "outbox" ("delivered_at") WHERE (status = 'delivered'::text);
@@ -0,0 +1,11 @@
+-- Create "notify_user_event" function
+CREATE FUNCTION "notify_user_event" () RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM pg_notify('frame_events', json_build_object(
+    'id', NEW.id, 'type', NEW.event_type, 'entity', NEW.entity, 'entity_id', NEW.entity_id, 'user_id', NEW.user_id,
+    'before', NEW.before, 'after', NEW.after, 'created_at', NEW.created_at)::text);
+  RETURN NULL;
+END;
+$$;
+-- Create trigger "outbox_notify_user_event"
+CREATE TRIGGER "outbox_notify_user_event" AFTER INSERT ON "outbox" FOR EACH ROW WHEN (NEW.entity = 'user') EXECUTE FUNCTION "notify_user_event"();
@@ -0,0 +1,13 @@
+-- Create "api_keys" table
+CREATE TABLE "api_keys" (
+  "id" uuid NOT NULL,
+  "name" text NOT NULL,
+  "prefix" text NOT NULL,
+  "hash" bytea NOT NULL,
+  "created_at" timestamptz NOT NULL,
+  "last_used_at" timestamptz NULL,
+  "revoked_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "api_keys_prefix_key" to table: "api_keys"
+CREATE UNIQUE INDEX "api_keys_prefix_key" ON "api_keys" ("prefix");
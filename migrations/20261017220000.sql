@@ -0,0 +1,6 @@
+-- Modify "api_keys" table
+ALTER TABLE "api_keys" ADD COLUMN "scopes" text[] NOT NULL DEFAULT '{}';
+-- Keys created before scopes existed keep access to users, but not to the admin routes.
+-- Keys that need exercises or admin must be granted those scopes explicitly, e.g.
+-- UPDATE "api_keys" SET "scopes" = array_append("scopes", 'admin') WHERE "prefix" = '...';
+UPDATE "api_keys" SET "scopes" = '{users:read,users:write}';
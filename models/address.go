@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Address represents a postal address belonging to a user
+type Address struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	Street    string
+	Suite     string
+	City      string
+	State     string
+	Zip       string
+	IsPrimary bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records one change made through the repositories
+// Before and After hold only the fields that changed, keyed by their snake_case names.
+// Before is nil for created entities and After is nil for removed ones.
+type AuditEntry struct {
+	ID        uuid.UUID
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  uuid.UUID
+	UserID    *uuid.UUID // the user the entity belongs to, nil for entities outside a user
+	Before    map[string]any
+	After     map[string]any
+	RequestID string
+	CreatedAt time.Time
+}
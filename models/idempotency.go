@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a request made with an Idempotency-Key header and the response it produced
+// StatusCode is zero while the original request is still being processed
+// Keys are scoped to the principal that sent them, so callers can't replay each other's responses.
+type IdempotencyKey struct {
+	Principal   string
+	Key         string
+	Method      string
+	Path        string
+	RequestHash string
+	StatusCode  int
+	Headers     map[string]string // response headers replayed with the body, such as Content-Type and ETag
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Completed reports whether the response of the original request has been stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
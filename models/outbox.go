@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent is a change published to webhooks, written in the transaction that made it
+// Before and After hold the changed fields like an AuditEntry.
+// DeliveredTo lists the webhook URLs that have accepted the event so retries skip them.
+type OutboxEvent struct {
+	ID            uuid.UUID
+	Type          string // entity and past tense action, such as user.created
+	Entity        string
+	EntityID      uuid.UUID
+	UserID        *uuid.UUID
+	Before        map[string]any
+	After         map[string]any
+	CreatedAt     time.Time
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	DeliveredTo   []string
+	LastError     string
+	DeliveredAt   *time.Time
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Phone represents a telephone number belonging to a user
+// Number is always stored in E.164 format
+type Phone struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	Number    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
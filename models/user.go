@@ -7,10 +7,15 @@ import (
 )
 
 // User represents a user in the database
+// Version starts at 1 and is incremented by every update
+// DeletedAt is set while the user is soft deleted
 type User struct {
 	ID        uuid.UUID
 	FirstName string
 	LastName  string
+	Email     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Version   int
+	DeletedAt *time.Time
 }
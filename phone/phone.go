@@ -0,0 +1,174 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Limits on the number of digits in an E.164 number, excluding the leading "+"
+const (
+	minDigits = 8
+	maxDigits = 15
+)
+
+var (
+	// ErrEmpty is returned when no number was given
+	ErrEmpty = errors.New("phone number is required")
+	// ErrInvalidCharacters is returned when the number contains anything other than digits and separators
+	ErrInvalidCharacters = errors.New("phone number may only contain digits, spaces, '-', '.', '(', ')' and a leading '+'")
+	// ErrTooShort is returned when the number has too few digits to be dialed
+	ErrTooShort = errors.New("phone number is too short")
+	// ErrTooLong is returned when the number has more digits than E.164 allows
+	ErrTooLong = errors.New("phone number is too long")
+	// ErrUnknownRegion is returned when a national number is given for a region we don't know
+	ErrUnknownRegion = errors.New("unknown phone region")
+)
+
+// region describes the numbering plan of a country
+type region struct {
+	callingCode string
+	exitCode    string // dialed inside the country before a country calling code, instead of "+"
+	trunkPrefix string // dialed before national numbers inside the country, removed in E.164
+	minLength   int    // shortest national significant number
+	maxLength   int    // longest national significant number
+}
+
+// regions maps ISO 3166-1 alpha-2 codes to their numbering plans
+var regions = map[string]region{
+	"AT": {callingCode: "43", exitCode: "00", trunkPrefix: "0", minLength: 4, maxLength: 13},
+	"AU": {callingCode: "61", exitCode: "0011", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"BE": {callingCode: "32", exitCode: "00", trunkPrefix: "0", minLength: 8, maxLength: 9},
+	"BR": {callingCode: "55", exitCode: "00", trunkPrefix: "0", minLength: 10, maxLength: 11},
+	"CA": {callingCode: "1", exitCode: "011", trunkPrefix: "1", minLength: 10, maxLength: 10},
+	"CH": {callingCode: "41", exitCode: "00", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"CN": {callingCode: "86", exitCode: "00", trunkPrefix: "0", minLength: 10, maxLength: 11},
+	"DE": {callingCode: "49", exitCode: "00", trunkPrefix: "0", minLength: 6, maxLength: 13},
+	"DK": {callingCode: "45", exitCode: "00", minLength: 8, maxLength: 8},
+	"ES": {callingCode: "34", exitCode: "00", minLength: 9, maxLength: 9},
+	"FR": {callingCode: "33", exitCode: "00", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"GB": {callingCode: "44", exitCode: "00", trunkPrefix: "0", minLength: 9, maxLength: 10},
+	"IE": {callingCode: "353", exitCode: "00", trunkPrefix: "0", minLength: 7, maxLength: 9},
+	"IN": {callingCode: "91", exitCode: "00", trunkPrefix: "0", minLength: 10, maxLength: 10},
+	"IT": {callingCode: "39", exitCode: "00", minLength: 6, maxLength: 11},
+	"JP": {callingCode: "81", exitCode: "010", trunkPrefix: "0", minLength: 9, maxLength: 10},
+	"MX": {callingCode: "52", exitCode: "00", minLength: 10, maxLength: 10},
+	"NL": {callingCode: "31", exitCode: "00", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"NO": {callingCode: "47", exitCode: "00", minLength: 8, maxLength: 8},
+	"NZ": {callingCode: "64", exitCode: "00", trunkPrefix: "0", minLength: 8, maxLength: 10},
+	"PL": {callingCode: "48", exitCode: "00", minLength: 9, maxLength: 9},
+	"SE": {callingCode: "46", exitCode: "00", trunkPrefix: "0", minLength: 7, maxLength: 9},
+	"US": {callingCode: "1", exitCode: "011", trunkPrefix: "1", minLength: 10, maxLength: 10},
+	"ZA": {callingCode: "27", exitCode: "00", trunkPrefix: "0", minLength: 9, maxLength: 9},
+}
+
+// Normalize parses number and returns it in E.164 format such as "+14155552671"
+// Numbers without "+" are interpreted in defaultRegion, and are international when they start with
+// its exit code, such as 011 in the US or 00 in most of Europe. The exit codes of other regions are
+// national numbers there, such as 0117 in the UK.
+func Normalize(number, defaultRegion string) (string, error) {
+	number = strings.TrimSpace(number)
+	if number == "" {
+		return "", ErrEmpty
+	}
+
+	international := strings.HasPrefix(number, "+")
+	digits, err := stripSeparators(strings.TrimPrefix(number, "+"))
+	if err != nil {
+		return "", err
+	}
+
+	if reg, ok := regions[strings.ToUpper(defaultRegion)]; ok && !international && strings.HasPrefix(digits, reg.exitCode) {
+		digits = strings.TrimPrefix(digits, reg.exitCode)
+		international = true
+	}
+
+	if international {
+		return normalizeInternational(digits)
+	}
+	return normalizeNational(digits, defaultRegion)
+}
+
+// stripSeparators removes formatting characters, rejecting anything that isn't a digit
+func stripSeparators(number string) (string, error) {
+	var b strings.Builder
+	for _, c := range number {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')':
+			// formatting only
+		default:
+			return "", ErrInvalidCharacters
+		}
+	}
+	return b.String(), nil
+}
+
+// normalizeInternational validates digits that start with a country calling code
+func normalizeInternational(digits string) (string, error) {
+	if strings.HasPrefix(digits, "0") {
+		return "", fmt.Errorf("invalid country calling code: %s", digits)
+	}
+	if len(digits) < minDigits {
+		return "", ErrTooShort
+	}
+	if len(digits) > maxDigits {
+		return "", ErrTooLong
+	}
+
+	// Apply the national length rules when we know the country
+	if reg, ok := regionForNumber(digits); ok {
+		if err := checkLength(digits[len(reg.callingCode):], reg); err != nil {
+			return "", err
+		}
+	}
+
+	return "+" + digits, nil
+}
+
+// normalizeNational prefixes a national number with the calling code of regionCode
+func normalizeNational(digits, regionCode string) (string, error) {
+	reg, ok := regions[strings.ToUpper(regionCode)]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRegion, regionCode)
+	}
+
+	if reg.trunkPrefix != "" && len(digits) > reg.minLength && strings.HasPrefix(digits, reg.trunkPrefix) {
+		digits = strings.TrimPrefix(digits, reg.trunkPrefix)
+	}
+	if err := checkLength(digits, reg); err != nil {
+		return "", err
+	}
+
+	return "+" + reg.callingCode + digits, nil
+}
+
+// checkLength validates the length of a national significant number
+func checkLength(national string, reg region) error {
+	if len(national) < reg.minLength {
+		return ErrTooShort
+	}
+	if len(national) > reg.maxLength {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// regionForNumber finds a numbering plan whose calling code prefixes digits
+// Calling codes form a prefix code, so at most one code can match. Regions sharing a code, such as
+// US and CA under the North American +1, have the same length rules, so any of them will do.
+func regionForNumber(digits string) (region, bool) {
+	for _, reg := range regions {
+		if strings.HasPrefix(digits, reg.callingCode) {
+			return reg, true
+		}
+	}
+	return region{}, false
+}
+
+// IsKnownRegion reports whether Normalize can interpret national numbers in regionCode
+func IsKnownRegion(regionCode string) bool {
+	_, ok := regions[strings.ToUpper(regionCode)]
+	return ok
+}
@@ -0,0 +1,75 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		number  string
+		region  string
+		want    string
+		wantErr error
+	}{
+		{name: "US national", number: "(415) 555-2671", region: "US", want: "+14155552671"},
+		{name: "US national with trunk prefix", number: "1-415-555-2671", region: "US", want: "+14155552671"},
+		{name: "US international", number: "+1 415 555 2671", region: "GB", want: "+14155552671"},
+		{name: "US international via 011", number: "011 44 20 7946 0958", region: "US", want: "+442079460958"},
+		{name: "GB national drops trunk zero", number: "020 7946 0958", region: "GB", want: "+442079460958"},
+		{name: "DE international via 00", number: "0044 20 7946 0958", region: "DE", want: "+442079460958"},
+		{name: "00 is national in the US", number: "0044 20 7946 0958", region: "US", wantErr: ErrTooLong},
+		{name: "GB national starting with 0117", number: "0117 496 0000", region: "GB", want: "+441174960000"},
+		{name: "GB national starting with 0114", number: "0114 496 0000", region: "GB", want: "+441144960000"},
+		{name: "AU international via 0011", number: "0011 1 415 555 2671", region: "AU", want: "+14155552671"},
+		{name: "lower case region", number: "01 23 45 67 89", region: "fr", want: "+33123456789"},
+		{name: "dots as separators", number: "415.555.2671", region: "US", want: "+14155552671"},
+		{name: "unknown country code only checks E.164 length", number: "+999 1234 5678", region: "US", want: "+99912345678"},
+		{name: "empty", number: "  ", region: "US", wantErr: ErrEmpty},
+		{name: "letters", number: "415-CALL-NOW", region: "US", wantErr: ErrInvalidCharacters},
+		{name: "extension", number: "415 555 2671 x12", region: "US", wantErr: ErrInvalidCharacters},
+		{name: "too short national", number: "555-2671", region: "US", wantErr: ErrTooShort},
+		{name: "too long national", number: "415 555 2671 99", region: "US", wantErr: ErrTooLong},
+		{name: "too long international", number: "+1234567890123456", region: "US", wantErr: ErrTooLong},
+		{name: "too short for known country", number: "+44 20 7946", region: "US", wantErr: ErrTooShort},
+		{name: "unknown region", number: "4155552671", region: "XX", wantErr: ErrUnknownRegion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.number, tt.region)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizeRejectsZeroCountryCode(t *testing.T) {
+	_, err := Normalize("+0 415 555 2671", "US")
+	assert.Error(t, err)
+}
+
+func TestIsKnownRegion(t *testing.T) {
+	assert.True(t, IsKnownRegion("US"))
+	assert.True(t, IsKnownRegion("gb"))
+	assert.False(t, IsKnownRegion("XX"))
+}
+
+func TestSharedCallingCodes(t *testing.T) {
+	// regionForNumber may pick any region of a shared calling code, so they must agree on lengths
+	byCode := map[string]region{}
+	for code, reg := range regions {
+		if other, ok := byCode[reg.callingCode]; ok {
+			assert.Equal(t, other.minLength, reg.minLength, code)
+			assert.Equal(t, other.maxLength, reg.maxLength, code)
+		}
+		byCode[reg.callingCode] = reg
+	}
+}
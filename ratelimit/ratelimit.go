@@ -0,0 +1,244 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"frame/config"
+	"frame/logging"
+
+	"go.uber.org/zap"
+)
+
+// What requests are counted by
+const (
+	// KeyAPIKey gives every caller its own limit, identified by its API key or token subject
+	KeyAPIKey = "api_key"
+	// KeyIP gives every client address its own limit
+	KeyIP = "ip"
+	// KeyRoute shares the limit of a route between every client
+	KeyRoute = "route"
+)
+
+// sweepInterval is how often buckets that have refilled are forgotten
+const sweepInterval = time.Minute
+
+// Decision is the outcome of a request checked against its limit
+type Decision struct {
+	// Allowed is false when the request is over its limit
+	Allowed bool
+	// Limit is the burst of the limit applied, zero when rate limiting is disabled
+	Limit int
+	// Remaining is the number of requests that can be made right away
+	Remaining int
+	// Reset is how long until the limit is fully available again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, zero when this one was
+	RetryAfter time.Duration
+}
+
+// limit is a token bucket refilling at perSecond up to burst tokens
+type limit struct {
+	perSecond float64
+	burst     int
+}
+
+type bucket struct {
+	limit   limit
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter counts requests in token buckets and decides whether they are allowed
+// Its settings can be replaced with Update while requests are being checked.
+type Limiter struct {
+	mu      sync.Mutex
+	enabled bool
+	key     string
+	limit   limit
+	ipLimit limit
+	routes  map[string]limit
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// New creates a limiter with the settings of cfg
+func New(cfg config.RateLimitConfig) (*Limiter, error) {
+	l := &Limiter{buckets: map[string]*bucket{}, now: time.Now}
+	if err := l.Update(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Update replaces the settings of the limiter with those of cfg
+// Buckets are kept, so a reload doesn't hand every client a full burst, and are clamped to their new
+// limit when next used. The previous settings are kept when cfg is invalid.
+func (l *Limiter) Update(cfg config.RateLimitConfig) error {
+	if cfg.Key != KeyAPIKey && cfg.Key != KeyIP && cfg.Key != KeyRoute {
+		return fmt.Errorf("invalid rate limit key %q, expected %s, %s or %s", cfg.Key, KeyAPIKey, KeyIP, KeyRoute)
+	}
+	def, err := newLimit(cfg.RequestsPerSecond, cfg.Burst)
+	if err != nil {
+		return err
+	}
+	ipLimit, err := newLimit(cfg.IPRequestsPerSecond, cfg.IPBurst)
+	if err != nil {
+		return fmt.Errorf("ip limit: %v", err)
+	}
+	routes := map[string]limit{}
+	for _, r := range cfg.Routes {
+		method, path, ok := strings.Cut(r.Route, " ")
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid rate limited route %q, expected a method and path such as POST /users", r.Route)
+		}
+		if routes[r.Route], err = newLimit(r.RequestsPerSecond, r.Burst); err != nil {
+			return fmt.Errorf("route %s: %v", r.Route, err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled, l.key, l.limit, l.ipLimit, l.routes = cfg.Enabled, cfg.Key, def, ipLimit, routes
+	return nil
+}
+
+func newLimit(perSecond float64, burst int) (limit, error) {
+	if perSecond <= 0 || burst < 1 {
+		return limit{}, fmt.Errorf("rate limits need a positive requests_per_second and a burst of at least 1")
+	}
+	return limit{perSecond: perSecond, burst: burst}, nil
+}
+
+// AllowIP takes a token for a request from ip before it is authenticated
+// Every address gets a bucket of its own, apart from those of Allow, so floods of requests with
+// missing or invalid credentials are refused before they cost an API key lookup.
+func (l *Limiter) AllowIP(ip string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.enabled {
+		return Decision{Allowed: true}
+	}
+
+	now := l.now()
+	l.sweep(now)
+	return l.take("unauthenticated ip:"+ip, l.ipLimit, now)
+}
+
+// Allow takes a token for a request to route, such as POST /users, made by caller from ip
+// caller is the subject of the principal the request authenticated as.
+// Requests share one bucket per client across routes, except on routes with their own limit
+// which get a bucket per route and client.
+func (l *Limiter) Allow(route, caller, ip string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.enabled {
+		return Decision{Allowed: true}
+	}
+
+	var client string
+	switch l.key {
+	case KeyAPIKey:
+		client = caller
+	case KeyIP:
+		client = "ip:" + ip
+	}
+
+	lim, ok := l.routes[route]
+	key := client
+	if ok || l.key == KeyRoute {
+		key = route + " " + client
+	}
+	if !ok {
+		lim = l.limit
+	}
+
+	now := l.now()
+	l.sweep(now)
+	return l.take(key, lim, now)
+}
+
+// take takes a token from the bucket under key, refilled at lim since it was last used
+func (l *Limiter) take(key string, lim limit, now time.Time) Decision {
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(lim.burst), updated: now}
+		l.buckets[key] = b
+	}
+	// The limit may have been updated since the bucket was last used, lowering its burst
+	b.limit = lim
+	b.tokens = math.Min(float64(lim.burst), b.tokens+now.Sub(b.updated).Seconds()*lim.perSecond)
+	b.updated = now
+
+	d := Decision{Limit: lim.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / lim.perSecond)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((float64(lim.burst) - b.tokens) / lim.perSecond)
+	return d
+}
+
+// sweep forgets the buckets that have refilled since they were last used, as a new one is the same
+// It runs at most once per sweepInterval so clients that come and go don't grow the map forever.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.perSecond >= float64(b.limit.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+var (
+	limiter   *Limiter
+	limiterMu sync.RWMutex
+)
+
+// Initialize creates the limiter returned by GetLimiter
+// It is updated whenever the configuration changes, and keeps its settings if the new ones are invalid
+func Initialize(cfg config.RateLimitConfig) error {
+	l, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	limiterMu.Lock()
+	limiter = l
+	limiterMu.Unlock()
+
+	config.RegisterCallback(func(cfg *config.Config) {
+		if err := l.Update(cfg.Server.RateLimit); err != nil {
+			logging.GetLogger().Error("Failed to update rate limits, keeping the previous ones", zap.Error(err))
+			return
+		}
+		logging.GetLogger().Info("Updated rate limits",
+			zap.Bool("enabled", cfg.Server.RateLimit.Enabled),
+			zap.String("key", cfg.Server.RateLimit.Key))
+	})
+	return nil
+}
+
+// GetLimiter returns the limiter of the server, nil until Initialize is called
+func GetLimiter() *Limiter {
+	limiterMu.RLock()
+	defer limiterMu.RUnlock()
+	return limiter
+}
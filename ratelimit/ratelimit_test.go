@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"frame/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLimiter creates a limiter whose clock only moves when the returned function is called
+func newTestLimiter(t *testing.T, cfg config.RateLimitConfig) (*Limiter, func(time.Duration)) {
+	t.Helper()
+	l, err := New(cfg)
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLimiter(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled:             true,
+		Key:                 KeyAPIKey,
+		RequestsPerSecond:   1,
+		Burst:               2,
+		IPRequestsPerSecond: 1,
+		IPBurst:             3,
+		Routes:              []config.RouteRateLimit{{Route: "POST /users", RequestsPerSecond: 0.5, Burst: 1}},
+	}
+
+	t.Run("bucket refills", func(t *testing.T) {
+		l, advance := newTestLimiter(t, cfg)
+
+		d := l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, d)
+		assert.True(t, l.Allow("GET /users/{id}", "api_key:a", "10.0.0.1").Allowed)
+
+		d = l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		assert.False(t, d.Allowed)
+		assert.Equal(t, 0, d.Remaining)
+		assert.Equal(t, time.Second, d.RetryAfter)
+		assert.Equal(t, 2*time.Second, d.Reset)
+
+		advance(time.Second)
+		assert.True(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+		assert.False(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+	})
+
+	t.Run("callers are counted apart", func(t *testing.T) {
+		l, _ := newTestLimiter(t, cfg)
+		for range 2 {
+			l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		}
+		assert.False(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+		assert.True(t, l.Allow("GET /users", "api_key:b", "10.0.0.1").Allowed)
+	})
+
+	t.Run("addresses before authentication", func(t *testing.T) {
+		l, _ := newTestLimiter(t, cfg)
+		for range 3 {
+			assert.True(t, l.AllowIP("10.0.0.1").Allowed)
+		}
+		d := l.AllowIP("10.0.0.1")
+		assert.False(t, d.Allowed)
+		assert.Equal(t, 3, d.Limit)
+		assert.True(t, l.AllowIP("10.0.0.2").Allowed)
+
+		// Authenticated callers keep their own buckets
+		assert.True(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+	})
+
+	t.Run("routes with their own limit", func(t *testing.T) {
+		l, advance := newTestLimiter(t, cfg)
+		assert.True(t, l.Allow("POST /users", "api_key:a", "10.0.0.1").Allowed)
+		d := l.Allow("POST /users", "api_key:a", "10.0.0.1")
+		assert.False(t, d.Allowed)
+		assert.Equal(t, 1, d.Limit)
+		assert.Equal(t, 2*time.Second, d.RetryAfter)
+
+		// The other routes keep their own bucket
+		assert.True(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+
+		advance(2 * time.Second)
+		assert.True(t, l.Allow("POST /users", "api_key:a", "10.0.0.1").Allowed)
+	})
+
+	t.Run("by ip", func(t *testing.T) {
+		byIP := cfg
+		byIP.Key = KeyIP
+		l, _ := newTestLimiter(t, byIP)
+		for range 2 {
+			l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		}
+		assert.False(t, l.Allow("GET /users", "api_key:b", "10.0.0.1").Allowed)
+		assert.True(t, l.Allow("GET /users", "api_key:a", "10.0.0.2").Allowed)
+	})
+
+	t.Run("by route", func(t *testing.T) {
+		byRoute := cfg
+		byRoute.Key = KeyRoute
+		l, _ := newTestLimiter(t, byRoute)
+		for range 2 {
+			l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		}
+		assert.False(t, l.Allow("GET /users", "api_key:b", "10.0.0.2").Allowed)
+		assert.True(t, l.Allow("GET /users/{id}", "api_key:a", "10.0.0.1").Allowed)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		l, advance := newTestLimiter(t, cfg)
+		for range 2 {
+			l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		}
+		assert.False(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+
+		// A reload keeps the buckets rather than refilling them
+		raised := cfg
+		raised.Burst = 5
+		require.NoError(t, l.Update(raised))
+		assert.False(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+
+		advance(3 * time.Second)
+		d := l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 5, d.Limit)
+		assert.Equal(t, 2, d.Remaining)
+
+		// A lowered burst clamps the tokens left
+		lowered := cfg
+		lowered.Burst = 1
+		require.NoError(t, l.Update(lowered))
+		d = l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 0, d.Remaining)
+		assert.False(t, l.Allow("GET /users", "api_key:a", "10.0.0.1").Allowed)
+
+		disabled := cfg
+		disabled.Enabled = false
+		require.NoError(t, l.Update(disabled))
+		for range 10 {
+			assert.Equal(t, Decision{Allowed: true}, l.Allow("GET /users", "api_key:a", "10.0.0.1"))
+		}
+
+		// Invalid settings keep the previous ones
+		invalid := cfg
+		invalid.Key = "user_agent"
+		assert.Error(t, l.Update(invalid))
+		assert.Equal(t, Decision{Allowed: true}, l.Allow("GET /users", "api_key:a", "10.0.0.1"))
+	})
+
+	t.Run("refilled buckets are swept", func(t *testing.T) {
+		l, advance := newTestLimiter(t, cfg)
+		l.Allow("GET /users", "api_key:a", "10.0.0.1")
+		l.Allow("GET /users", "api_key:b", "10.0.0.1")
+		require.Len(t, l.buckets, 2)
+
+		advance(sweepInterval)
+		l.Allow("GET /users", "api_key:c", "10.0.0.1")
+		assert.Len(t, l.buckets, 1)
+	})
+}
+
+func TestLimiterConfig(t *testing.T) {
+	valid := config.RateLimitConfig{Key: KeyIP, RequestsPerSecond: 1, Burst: 1, IPRequestsPerSecond: 1, IPBurst: 1}
+
+	for name, change := range map[string]func(*config.RateLimitConfig){
+		"key":      func(c *config.RateLimitConfig) { c.Key = "" },
+		"rate":     func(c *config.RateLimitConfig) { c.RequestsPerSecond = 0 },
+		"burst":    func(c *config.RateLimitConfig) { c.Burst = 0 },
+		"ip burst": func(c *config.RateLimitConfig) { c.IPBurst = 0 },
+		"route": func(c *config.RateLimitConfig) {
+			c.Routes = []config.RouteRateLimit{{Route: "/users", RequestsPerSecond: 1, Burst: 1}}
+		},
+		"route rate": func(c *config.RateLimitConfig) { c.Routes = []config.RouteRateLimit{{Route: "POST /users", Burst: 1}} },
+	} {
+		cfg := valid
+		change(&cfg)
+		_, err := New(cfg)
+		assert.Error(t, err, name)
+	}
+
+	_, err := New(valid)
+	assert.NoError(t, err)
+}
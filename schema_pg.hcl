@@ -24,9 +24,32 @@ table "users" {
     null = false
     type = timestamptz
   }
+  column "version" {
+    null    = false
+    type    = integer
+    default = 1
+  }
+  column "deleted_at" {
+    null = true
+    type = timestamptz
+  }
   primary_key {
     columns = [column.id]
   }
+  index "users_email_key" {
+    unique = true
+    on {
+      expr = "lower((email)::text)"
+    }
+    where = "((email IS NOT NULL) AND (deleted_at IS NULL))"
+  }
+  index "users_created_at_id_idx" {
+    columns = [column.created_at, column.id]
+  }
+  index "users_deleted_at_idx" {
+    columns = [column.deleted_at]
+    where   = "(deleted_at IS NOT NULL)"
+  }
 }
 schema "public" {
 }
@@ -65,6 +88,11 @@ table "address" {
     null = true
     type = text
   }
+  column "is_primary" {
+    null = false
+    type = boolean
+    default = false
+  }
   column "created_at" {
     null = false
     type = timestamptz
@@ -73,6 +101,10 @@ table "address" {
     null = false
     type = timestamptz
   }
+  column "deleted_at" {
+    null = true
+    type = timestamptz
+  }
   primary_key {
     columns = [column.id]
   }
@@ -80,6 +112,14 @@ table "address" {
     columns     = [column.user_id]
     ref_columns = [table.users.column.id]
   }
+  index "address_user_id_idx" {
+    columns = [column.user_id]
+  }
+  index "address_user_primary_key" {
+    unique  = true
+    columns = [column.user_id]
+    where   = "is_primary"
+  }
 }
 
 table "phone" {
@@ -108,6 +148,10 @@ table "phone" {
     null = false
     type = timestamptz
   }
+  column "deleted_at" {
+    null = true
+    type = timestamptz
+  }
   primary_key {
     columns = [column.id]
   }
@@ -115,6 +159,10 @@ table "phone" {
     columns     = [column.user_id]
     ref_columns = [table.users.column.id]
   }
+  index "phone_user_number_key" {
+    unique  = true
+    columns = [column.user_id, column.number]
+  }
 }
 
 table "exercise_names" {
@@ -138,4 +186,239 @@ table "exercise_names" {
   primary_key {
     columns = [column.id]
   }
+  index "exercise_names_name_key" {
+    unique = true
+    on {
+      expr = "lower(name)"
+    }
+  }
+  index "exercise_names_name_prefix_idx" {
+    on {
+      expr = "lower(name)"
+      ops  = text_pattern_ops
+    }
+  }
+}
+
+table "idempotency_keys" {
+  schema = schema.public
+  column "principal" {
+    null = false
+    type = text
+  }
+  column "key" {
+    null = false
+    type = text
+  }
+  column "method" {
+    null = false
+    type = text
+  }
+  column "path" {
+    null = false
+    type = text
+  }
+  column "request_hash" {
+    null = false
+    type = text
+  }
+  column "status_code" {
+    null = true
+    type = integer
+  }
+  column "headers" {
+    null = true
+    type = jsonb
+  }
+  column "body" {
+    null = true
+    type = bytea
+  }
+  column "created_at" {
+    null = false
+    type = timestamptz
+  }
+  column "expires_at" {
+    null = false
+    type = timestamptz
+  }
+  column "locked_until" {
+    null = true
+    type = timestamptz
+  }
+  primary_key {
+    columns = [column.principal, column.key, column.method, column.path]
+  }
+  index "idempotency_keys_expires_at_idx" {
+    columns = [column.expires_at]
+  }
+}
+
+table "audit_log" {
+  schema = schema.public
+  column "id" {
+    type = uuid
+  }
+  column "actor" {
+    null = true
+    type = text
+  }
+  column "action" {
+    null = false
+    type = text
+  }
+  column "entity" {
+    null = false
+    type = text
+  }
+  column "entity_id" {
+    null = false
+    type = uuid
+  }
+  column "user_id" {
+    null = true
+    type = uuid
+  }
+  column "before" {
+    null = true
+    type = jsonb
+  }
+  column "after" {
+    null = true
+    type = jsonb
+  }
+  column "request_id" {
+    null = true
+    type = text
+  }
+  column "created_at" {
+    null = false
+    type = timestamptz
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "audit_log_user_id_created_at_idx" {
+    columns = [column.user_id, column.created_at, column.id]
+  }
+}
+
+# The outbox_notify_user_event trigger announces user events with pg_notify, see migrations/20261017200000.sql
+table "outbox" {
+  schema = schema.public
+  column "id" {
+    type = uuid
+  }
+  column "event_type" {
+    null = false
+    type = text
+  }
+  column "entity" {
+    null = false
+    type = text
+  }
+  column "entity_id" {
+    null = false
+    type = uuid
+  }
+  column "user_id" {
+    null = true
+    type = uuid
+  }
+  column "before" {
+    null = true
+    type = jsonb
+  }
+  column "after" {
+    null = true
+    type = jsonb
+  }
+  column "created_at" {
+    null = false
+    type = timestamptz
+  }
+  column "status" {
+    null    = false
+    type    = text
+    default = "pending"
+  }
+  column "attempts" {
+    null    = false
+    type    = integer
+    default = 0
+  }
+  column "next_attempt_at" {
+    null = false
+    type = timestamptz
+  }
+  column "delivered_to" {
+    null    = false
+    type    = sql("text[]")
+    default = sql("'{}'::text[]")
+  }
+  column "last_error" {
+    null = true
+    type = text
+  }
+  column "delivered_at" {
+    null = true
+    type = timestamptz
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "outbox_created_at_id_idx" {
+    columns = [column.created_at, column.id]
+  }
+  index "outbox_pending_idx" {
+    columns = [column.next_attempt_at]
+    where   = "(status = 'pending'::text)"
+  }
+  index "outbox_delivered_at_idx" {
+    columns = [column.delivered_at]
+    where   = "(status = 'delivered'::text)"
+  }
+}
+
+table "api_keys" {
+  schema = schema.public
+  column "id" {
+    type = uuid
+  }
+  column "name" {
+    null = false
+    type = text
+  }
+  column "prefix" {
+    null = false
+    type = text
+  }
+  column "hash" {
+    null = false
+    type = bytea
+  }
+  column "created_at" {
+    null = false
+    type = timestamptz
+  }
+  column "last_used_at" {
+    null = true
+    type = timestamptz
+  }
+  column "revoked_at" {
+    null = true
+    type = timestamptz
+  }
+  column "scopes" {
+    null    = false
+    type    = sql("text[]")
+    default = sql("'{}'::text[]")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "api_keys_prefix_key" {
+    unique  = true
+    columns = [column.prefix]
+  }
 }
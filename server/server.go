@@ -2,17 +2,50 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"frame/api"
+	"frame/auth"
 	"frame/config"
+	"frame/cors"
 	"frame/db"
+	"frame/events"
+	"frame/health"
 	"frame/logging"
+	"frame/ratelimit"
+	"frame/webhook"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+// ready is true while the server accepts requests, and false again once it starts shutting down
+var ready atomic.Bool
+
+// Ready reports whether the server is accepting requests and not shutting down
+func Ready() bool {
+	return ready.Load()
+}
+
+// checkReady is the readiness check of the server itself, failing while it starts or shuts down
+func checkReady(context.Context) error {
+	if !Ready() {
+		return errors.New("not accepting requests, the server is starting or shutting down")
+	}
+	return nil
+}
+
+// Start serves the API until SIGINT or SIGTERM, then shuts down gracefully
+// Shutdown reports the server as not ready, stops reloading the config, lets in-flight requests
+// finish within server.shutdown_timeout, stops the background work, then closes the database and
+// flushes the logs. An error is returned when the server couldn't start or requests were cut off.
 func Start() error {
 	// Initialize logger
 	if err := logging.Initialize(); err != nil {
@@ -24,23 +57,67 @@ func Start() error {
 		}
 	}()
 
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
 	// Initialize database connection
-	ctx := context.Background()
-	if err := db.Initialize(ctx); err != nil {
+	if err := db.Initialize(context.Background()); err != nil {
 		return err
 	}
 	defer db.Close()
 
+	// Background work runs until the server has drained, so requests can still rely on it
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var workers sync.WaitGroup
+	run := func(work func(context.Context)) {
+		workers.Go(func() { work(background) })
+	}
+
+	run(purgeIdempotencyKeys)
+	run(purgeDeletedUsers)
+	run(purgeOutbox)
+	run(flushAPIKeyUsage)
+	run(runWebhooks)
+
+	// Every instance listens, so its event stream includes writes made through the others
+	broker := events.Initialize(viper.Get("config").(*config.Config).Events)
+	run(func(ctx context.Context) { broker.Listen(ctx, db.ListenUserEvents) })
+
+	// Service-to-service callers may present JWTs instead of API keys when keys are configured
+	if err := auth.Initialize(viper.Get("config").(*config.Config).JWT); err != nil {
+		return err
+	}
+
+	// Rate limits can be changed while the server runs, so the limiter exists even when disabled
+	if err := ratelimit.Initialize(viper.Get("config").(*config.Config).Server.RateLimit); err != nil {
+		return err
+	}
+
+	// Browsers may call the API from the allowed origins, changes apply without a restart
+	policy, err := cors.Initialize(viper.Get("config").(*config.Config).Server.CORS)
+	if err != nil {
+		return err
+	}
+
 	// Create a new mux for routing
 	mux := http.NewServeMux()
-	mux.HandleFunc("/user", api.UserHandler)
+	api.RegisterRoutes(mux)
 
-	// Wrap the mux with our logging middleware
-	handler := logging.Middleware(mux)
+	// Wrap the mux with our logging, CORS, rate limiting and authentication middleware
+	// CORS runs first so preflights, which carry no credentials, are answered before authentication.
+	// Client addresses are limited before authentication, callers and routes once they are known.
+	handler := logging.Middleware(policy.Handler(api.RateLimitIP(api.Authenticate(api.ProblemHandler(mux)))))
 
 	cfg := viper.Get("config").(*config.Config)
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 
+	health.Register("server", checkReady)
+
+	srv := &http.Server{Addr: addr, Handler: handler}
+	// Event streams never go idle, so they are ended for Shutdown to finish draining
+	srv.RegisterOnShutdown(broker.Close)
+
 	// Log startup information
 	logger := logging.GetLogger()
 	logLevel := "INFO"
@@ -55,5 +132,218 @@ func Start() error {
 		zap.String("database_name", cfg.Database.Name),
 	)
 
-	return http.ListenAndServe(addr, handler)
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+	ready.Store(true)
+
+	select {
+	case err := <-served:
+		ready.Store(false)
+		stopBackground()
+		workers.Wait()
+		return fmt.Errorf("error serving on %s: %v", addr, err)
+	case <-signals.Done():
+	}
+	// A second signal stops the process without waiting for the shutdown
+	stopSignals()
+
+	return shutdown(srv, cfg.Server, func() {
+		stopBackground()
+		workers.Wait()
+	})
+}
+
+// shutdown drains srv and stops the background work, in the order requests depend on them
+func shutdown(srv *http.Server, cfg config.ServerConfig, stopBackground func()) error {
+	logger := logging.GetLogger()
+	logger.Info("Shutting down server",
+		zap.Duration("shutdown_delay", cfg.ShutdownDelay),
+		zap.Duration("shutdown_timeout", cfg.ShutdownTimeout))
+
+	// Load balancers polling readiness stop sending requests during the delay
+	ready.Store(false)
+	time.Sleep(cfg.ShutdownDelay)
+
+	// A config change must not reconnect the database while requests are draining
+	config.StopWatching()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		err = fmt.Errorf("requests still running after %s were cut off: %v", cfg.ShutdownTimeout, err)
+		logger.Error("Server didn't drain in time", zap.Error(err))
+		_ = srv.Close()
+	}
+
+	stopBackground()
+	logger.Info("Stopped background work")
+	return err
+}
+
+// Background jobs run for as long as the server while the database pool is replaced whenever the
+// config changes, so they build their repository from the current pool on every run through these.
+var (
+	idempotencyKeys = func() *db.IdempotencyRepository { return db.NewIdempotencyRepository(db.GetPool()) }
+	users           = func() *db.UserRepository { return db.NewUserRepository(db.GetPool()) }
+	outbox          = func() *db.OutboxRepository { return db.NewOutboxRepository(db.GetPool()) }
+)
+
+// idempotencyPurgeInterval is how often expired idempotency keys are deleted
+const idempotencyPurgeInterval = time.Hour
+
+// purgeIdempotencyKeys periodically deletes idempotency keys whose TTL has passed
+func purgeIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := idempotencyKeys().DeleteExpired(ctx)
+			if err != nil {
+				logging.GetLogger().Error("Failed to purge idempotency keys",
+					zap.Error(err))
+				continue
+			}
+			logging.GetLogger().Debug("Purged idempotency keys",
+				zap.Int64("deleted", n))
+		}
+	}
+}
+
+// userPurgeInterval is how often soft deleted users past database.purge_after_days are removed
+const userPurgeInterval = time.Hour
+
+// purgeDeletedUsers periodically removes users that were soft deleted more than
+// database.purge_after_days ago, along with their addresses and phones
+// Setting purge_after_days to 0 keeps deleted users forever
+func purgeDeletedUsers(ctx context.Context) {
+	days := viper.Get("config").(*config.Config).Database.PurgeAfterDays
+	if days <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(userPurgeInterval)
+	defer ticker.Stop()
+
+	// Purges aren't made on behalf of a request, so the audit log attributes them to the system
+	ctx = db.WithActor(ctx, "system")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := users().Purge(ctx, time.Now().AddDate(0, 0, -days))
+			if err != nil {
+				logging.GetLogger().Error("Failed to purge deleted users",
+					zap.Error(err))
+				continue
+			}
+			logging.GetLogger().Debug("Purged deleted users",
+				zap.Int64("deleted", n))
+		}
+	}
+}
+
+// apiKeyUsageInterval is how often the last use of API keys is written to the database
+const apiKeyUsageInterval = time.Minute
+
+// apiKeyUsageFlushTimeout bounds the last flush made when the server shuts down
+const apiKeyUsageFlushTimeout = 5 * time.Second
+
+// flushAPIKeyUsage periodically stores when API keys were last used
+// The usage recorded since the previous flush is stored once more when ctx is done.
+func flushAPIKeyUsage(ctx context.Context) {
+	ticker := time.NewTicker(apiKeyUsageInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), apiKeyUsageFlushTimeout)
+			defer cancel()
+			if err := api.FlushKeyUsage(flushCtx); err != nil {
+				logging.GetLogger().Error("Failed to record API key usage",
+					zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := api.FlushKeyUsage(ctx); err != nil {
+				logging.GetLogger().Error("Failed to record API key usage",
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// runWebhooks delivers outbox events to the configured webhooks until ctx is done
+// Without webhooks events are marked delivered unsent, so they don't stay pending in the outbox forever
+func runWebhooks(ctx context.Context) {
+	cfg := viper.Get("config").(*config.Config).Webhooks
+	if len(cfg.Endpoints) == 0 {
+		logging.GetLogger().Info("No webhooks configured, outbox events won't be delivered")
+		skipOutboxEvents(ctx, cfg.PollInterval)
+		return
+	}
+
+	dispatcher := webhook.NewDispatcher(func() webhook.Store { return outbox() }, cfg)
+	dispatcher.Run(ctx)
+}
+
+// skipOutboxEvents periodically marks pending outbox events delivered until ctx is done
+func skipOutboxEvents(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := outbox().SkipPending(ctx)
+			if err != nil {
+				logging.GetLogger().Error("Failed to skip outbox events",
+					zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				logging.GetLogger().Debug("Skipped outbox events without webhooks",
+					zap.Int64("skipped", n))
+			}
+		}
+	}
+}
+
+// outboxPurgeInterval is how often outbox events delivered more than webhooks.retention ago are removed
+const outboxPurgeInterval = time.Hour
+
+// purgeOutbox periodically removes the outbox events delivered more than webhooks.retention ago
+// Setting retention to 0 keeps delivered events forever
+func purgeOutbox(ctx context.Context) {
+	retention := viper.Get("config").(*config.Config).Webhooks.Retention
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(outboxPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := outbox().DeleteDelivered(ctx, time.Now().Add(-retention))
+			if err != nil {
+				logging.GetLogger().Error("Failed to purge outbox events",
+					zap.Error(err))
+				continue
+			}
+			logging.GetLogger().Debug("Purged outbox events",
+				zap.Int64("deleted", n))
+		}
+	}
 }
@@ -0,0 +1,263 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every field that failed validation
+type Errors []FieldError
+
+// Error joins all field errors into one message
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// rule checks a single constraint on a field value
+// value is never a nil pointer; pointers are dereferenced before rules run
+type rule struct {
+	check func(value reflect.Value) bool
+	msg   string
+}
+
+// field holds the parsed rules of one struct field
+type field struct {
+	index    int
+	name     string
+	required bool
+	rules    []rule
+}
+
+// cache maps struct types to their parsed fields
+var cache sync.Map // map[reflect.Type][]field
+
+// Struct validates v, a struct or pointer to a struct, against its `validate` tags
+// Returns nil when every field is valid
+//
+// Supported rules, separated by commas:
+//
+//	required     the field must be present and not empty
+//	min=N        strings have at least N characters, numbers are at least N
+//	max=N        strings have at most N characters, numbers are at most N
+//	email        the string is a single bare address such as "jane@example.com"
+//	enum=a|b|c   the string is one of the listed values
+//	pattern=RE   the string matches the regular expression; must be the last rule
+//
+// Nil pointers are only checked by required, so optional fields of partial updates can be left out
+// Empty strings are skipped by every rule but required, unless they were set through a pointer
+func Struct(v any) Errors {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	for _, f := range fieldsOf(rv.Type()) {
+		value := rv.Field(f.index)
+		present := false
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				if f.required {
+					errs = append(errs, FieldError{Field: f.name, Message: f.name + " is required"})
+				}
+				continue
+			}
+			value = value.Elem()
+			present = true
+		}
+
+		if value.IsZero() {
+			if f.required {
+				errs = append(errs, FieldError{Field: f.name, Message: f.name + " is required"})
+				continue
+			}
+			if value.Kind() == reflect.String && !present {
+				continue
+			}
+		}
+
+		for _, r := range f.rules {
+			if !r.check(value) {
+				errs = append(errs, FieldError{Field: f.name, Message: f.name + " " + r.msg})
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// fieldsOf returns the parsed rules of a struct type, parsing them on first use
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := cache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		fields = append(fields, parseField(i, sf, tag))
+	}
+
+	cache.Store(t, fields)
+	return fields
+}
+
+// parseField parses the validate tag of a struct field
+// Invalid tags are programming errors and panic when the type is first validated
+func parseField(index int, sf reflect.StructField, tag string) field {
+	f := field{index: index, name: JSONName(sf)}
+
+	unit := ""
+	switch base := sf.Type; {
+	case base.Kind() == reflect.String || base.Kind() == reflect.Pointer && base.Elem().Kind() == reflect.String:
+		unit = " characters"
+	case base.Kind() == reflect.Slice:
+		unit = " items"
+	}
+
+	for _, c := range Parse(tag) {
+		name, arg := c.Rule, c.Arg
+		switch name {
+		case "required":
+			f.required = true
+		case "min":
+			f.rules = append(f.rules, minRule(mustInt(sf, name, arg), unit))
+		case "max":
+			f.rules = append(f.rules, maxRule(mustInt(sf, name, arg), unit))
+		case "email":
+			f.rules = append(f.rules, rule{check: isEmail, msg: "must be a valid email address"})
+		case "enum":
+			f.rules = append(f.rules, enumRule(strings.Split(arg, "|")))
+		case "pattern":
+			f.rules = append(f.rules, patternRule(regexp.MustCompile(arg)))
+		default:
+			panic(fmt.Sprintf("validation: unknown rule %q on field %s", name, sf.Name))
+		}
+	}
+
+	return f
+}
+
+// Constraint is a single rule of a validate tag, such as max=100
+type Constraint struct {
+	Rule string
+	Arg  string
+}
+
+// Parse splits a validate tag into its rules without checking them
+// It lets other packages, such as API documentation, describe the same constraints
+func Parse(tag string) []Constraint {
+	var constraints []Constraint
+	for tag != "" {
+		var spec string
+		if strings.HasPrefix(tag, "pattern=") {
+			spec, tag = tag, ""
+		} else {
+			spec, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, arg, _ := strings.Cut(strings.TrimSpace(spec), "=")
+		constraints = append(constraints, Constraint{Rule: name, Arg: arg})
+	}
+	return constraints
+}
+
+// JSONName returns the name clients use for a struct field
+func JSONName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+// mustInt parses the numeric argument of a rule
+func mustInt(sf reflect.StructField, rule, arg string) int64 {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: rule %s on field %s needs a number: %v", rule, sf.Name, err))
+	}
+	return n
+}
+
+// size returns the number of characters in strings and the value of numbers
+func size(value reflect.Value) (int64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(value.String())), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint()), true
+	case reflect.Slice, reflect.Map:
+		return int64(value.Len()), true
+	}
+	return 0, false
+}
+
+func minRule(n int64, unit string) rule {
+	msg := fmt.Sprintf("must be at least %d%s", n, unit)
+	return rule{msg: msg, check: func(value reflect.Value) bool {
+		s, ok := size(value)
+		return !ok || s >= n
+	}}
+}
+
+func maxRule(n int64, unit string) rule {
+	msg := fmt.Sprintf("must be at most %d%s", n, unit)
+	return rule{msg: msg, check: func(value reflect.Value) bool {
+		s, ok := size(value)
+		return !ok || s <= n
+	}}
+}
+
+// isEmail checks that a string is a single bare address such as "jane@example.com"
+func isEmail(value reflect.Value) bool {
+	addr, err := mail.ParseAddress(value.String())
+	return err == nil && addr.Address == value.String()
+}
+
+func enumRule(values []string) rule {
+	msg := "must be one of: " + strings.Join(values, ", ")
+	return rule{msg: msg, check: func(value reflect.Value) bool {
+		for _, v := range values {
+			if value.String() == v {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+func patternRule(re *regexp.Regexp) rule {
+	msg := "must match the pattern " + re.String()
+	return rule{msg: msg, check: func(value reflect.Value) bool {
+		return re.MatchString(value.String())
+	}}
+}
@@ -0,0 +1,94 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type signup struct {
+	Name    string  `json:"name" validate:"required,max=5"`
+	Email   string  `json:"email" validate:"required,email"`
+	Plan    string  `json:"plan" validate:"enum=free|pro"`
+	Code    string  `json:"code" validate:"pattern=^[A-Z]{2,3}$"`
+	Age     int     `json:"age" validate:"min=18,max=130"`
+	Nick    *string `json:"nick,omitempty" validate:"min=1,max=3"`
+	Comment string  `json:"comment"`
+}
+
+func TestStruct(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		input signup
+		want  Errors
+	}{
+		{
+			name:  "valid",
+			input: signup{Name: "Ann", Email: "ann@example.com", Plan: "pro", Code: "AB", Age: 30, Nick: str("an")},
+		},
+		{
+			name:  "optional fields left out",
+			input: signup{Name: "Ann", Email: "ann@example.com", Age: 18},
+		},
+		{
+			name:  "missing required fields",
+			input: signup{Age: 18},
+			want: Errors{
+				{Field: "name", Message: "name is required"},
+				{Field: "email", Message: "email is required"},
+			},
+		},
+		{
+			name:  "max length counts characters",
+			input: signup{Name: "Zoë Ö", Email: "zoe@example.com", Age: 18},
+		},
+		{
+			name:  "every invalid field is reported",
+			input: signup{Name: "Annabel", Email: "Ann <ann@example.com>", Plan: "gold", Code: "A,B", Age: 12, Nick: str("")},
+			want: Errors{
+				{Field: "name", Message: "name must be at most 5 characters"},
+				{Field: "email", Message: "email must be a valid email address"},
+				{Field: "plan", Message: "plan must be one of: free, pro"},
+				{Field: "code", Message: "code must match the pattern ^[A-Z]{2,3}$"},
+				{Field: "age", Message: "age must be at least 18"},
+				{Field: "nick", Message: "nick must be at least 1 characters"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Struct(&tt.input))
+		})
+	}
+}
+
+func TestStructIgnoresNonStructs(t *testing.T) {
+	assert.Nil(t, Struct(nil))
+	assert.Nil(t, Struct((*signup)(nil)))
+	assert.Nil(t, Struct("not a struct"))
+}
+
+func TestStructPanicsOnUnknownRule(t *testing.T) {
+	type bad struct {
+		Name string `validate:"sometimes"`
+	}
+	assert.Panics(t, func() { Struct(bad{}) })
+}
+
+func TestErrorsError(t *testing.T) {
+	errs := Errors{{Field: "a", Message: "a is required"}, {Field: "b", Message: "b is required"}}
+	assert.Equal(t, "a is required; b is required", errs.Error())
+}
+
+func TestParse(t *testing.T) {
+	got := Parse("required,max=100,pattern=^[a-z]{1,3}$")
+	assert.Equal(t, []Constraint{
+		{Rule: "required"},
+		{Rule: "max", Arg: "100"},
+		{Rule: "pattern", Arg: "^[a-z]{1,3}$"},
+	}, got)
+	assert.Nil(t, Parse(""))
+}
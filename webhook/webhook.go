@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"frame/config"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Headers sent with every delivery
+const (
+	EventIDHeader   = "X-Frame-Event-Id"
+	EventTypeHeader = "X-Frame-Event-Type"
+	SignatureHeader = "X-Frame-Signature"
+)
+
+// batchSize is the number of events claimed from the outbox at a time
+const batchSize = 10
+
+var (
+	// ErrInvalidSignature is returned when a signature header doesn't match the body
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrExpiredSignature is returned when a signature was made too long ago
+	ErrExpiredSignature = errors.New("expired webhook signature")
+)
+
+// Store hands out the events to deliver, implemented by db.OutboxRepository
+type Store interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	MarkDelivered(ctx context.Context, id uuid.UUID, deliveredTo []string) error
+	MarkFailed(ctx context.Context, id uuid.UUID, deliveredTo []string, lastError string, retryAt time.Time) error
+}
+
+// Payload is the JSON body posted to webhooks
+// Before and after hold only the fields that changed, like the entries of GET /users/{id}/history
+type Payload struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	Entity     string         `json:"entity"`
+	EntityID   string         `json:"entity_id"`
+	UserID     string         `json:"user_id,omitempty"`
+	Before     map[string]any `json:"before,omitempty"`
+	After      map[string]any `json:"after,omitempty"`
+	OccurredAt time.Time      `json:"occurred_at"`
+}
+
+// NewPayload converts an outbox event to the body delivered to webhooks
+func NewPayload(e *models.OutboxEvent) Payload {
+	p := Payload{
+		ID:         e.ID.String(),
+		Type:       e.Type,
+		Entity:     e.Entity,
+		EntityID:   e.EntityID.String(),
+		Before:     e.Before,
+		After:      e.After,
+		OccurredAt: e.CreatedAt,
+	}
+	if e.UserID != nil {
+		p.UserID = e.UserID.String()
+	}
+	return p
+}
+
+// Sign returns the signature header of a body sent at t
+// The header has the form t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">,
+// so receivers can reject deliveries replayed long after they were signed
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify checks a signature header made by Sign against the body it was sent with
+// Signatures older than tolerance are rejected, a zero tolerance accepts any age
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	expected := mac(secret, ts, body)
+	if !slices.ContainsFunc(sigs, func(sig []byte) bool { return hmac.Equal(sig, expected) }) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts + "."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Dispatcher delivers outbox events to the configured webhooks
+// Events are delivered at least once, receivers should use the event ID to ignore repeats.
+type Dispatcher struct {
+	newStore func() Store
+	cfg      config.WebhooksConfig
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewDispatcher creates a dispatcher delivering the events of the store returned by newStore to the
+// endpoints of cfg
+// newStore is called for every dispatch, so the store can follow a database pool that is replaced
+// when the configuration changes.
+func NewDispatcher(newStore func() Store, cfg config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		newStore: newStore,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		now:      time.Now,
+	}
+}
+
+// Run delivers due events every poll interval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Dispatch(ctx); err != nil {
+				logging.GetLogger().Error("Failed to dispatch webhooks",
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// Dispatch delivers the events that are due until none are left and returns how many it attempted
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	// Events are delivered one after the other, the lease covers the slowest possible batch
+	lease := d.cfg.Timeout*time.Duration(batchSize*len(d.cfg.Endpoints)) + time.Minute
+
+	store := d.newStore()
+	count := 0
+	for {
+		events, err := store.Claim(ctx, batchSize, lease)
+		if err != nil {
+			return count, err
+		}
+		for i := range events {
+			if err := d.deliver(ctx, store, &events[i]); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(events) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+// deliver posts an event to every endpoint that hasn't accepted it yet and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, store Store, event *models.OutboxEvent) error {
+	body, err := json.Marshal(NewPayload(event))
+	if err != nil {
+		return fmt.Errorf("error encoding event %s: %v", event.ID, err)
+	}
+
+	deliveredTo := slices.Clone(event.DeliveredTo)
+	var failures []string
+	for _, endpoint := range d.cfg.Endpoints {
+		if slices.Contains(deliveredTo, endpoint.URL) {
+			continue
+		}
+		if err := d.post(ctx, endpoint, event, body); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		deliveredTo = append(deliveredTo, endpoint.URL)
+	}
+
+	if len(failures) == 0 {
+		return store.MarkDelivered(ctx, event.ID, deliveredTo)
+	}
+
+	logger := logging.GetLogger()
+	attempts := event.Attempts + 1
+	var retryAt time.Time
+	if attempts < d.cfg.MaxAttempts {
+		retryAt = d.now().Add(d.backoff(attempts))
+		logger.Warn("Webhook delivery failed, will retry",
+			zap.String("event_id", event.ID.String()),
+			zap.Int("attempts", attempts),
+			zap.Time("retry_at", retryAt),
+			zap.Strings("errors", failures))
+	} else {
+		logger.Error("Webhook delivery failed, event dead lettered",
+			zap.String("event_id", event.ID.String()),
+			zap.Int("attempts", attempts),
+			zap.Strings("errors", failures))
+	}
+	return store.MarkFailed(ctx, event.ID, deliveredTo, strings.Join(failures, "; "), retryAt)
+}
+
+// backoff returns the wait before the retry following the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.InitialBackoff
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.MaxBackoff)
+}
+
+// post sends the signed body of an event to one endpoint, any status other than 2xx is a failure
+func (d *Dispatcher) post(ctx context.Context, endpoint config.WebhookEndpoint, event *models.OutboxEvent, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %v", endpoint.URL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, event.ID.String())
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", endpoint.URL, err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: responded %s", endpoint.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"frame/config"
+	"frame/logging"
+	"frame/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore hands out its pending events once and records how each delivery went
+type memoryStore struct {
+	pending   []models.OutboxEvent
+	delivered map[uuid.UUID][]string
+	failed    map[uuid.UUID]failure
+}
+
+type failure struct {
+	deliveredTo []string
+	lastError   string
+	retryAt     time.Time
+}
+
+func newMemoryStore(events ...models.OutboxEvent) *memoryStore {
+	return &memoryStore{pending: events, delivered: map[uuid.UUID][]string{}, failed: map[uuid.UUID]failure{}}
+}
+
+func (m *memoryStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	n := min(limit, len(m.pending))
+	claimed := m.pending[:n]
+	m.pending = m.pending[n:]
+	return claimed, nil
+}
+
+func (m *memoryStore) MarkDelivered(ctx context.Context, id uuid.UUID, deliveredTo []string) error {
+	m.delivered[id] = deliveredTo
+	return nil
+}
+
+func (m *memoryStore) MarkFailed(ctx context.Context, id uuid.UUID, deliveredTo []string, lastError string, retryAt time.Time) error {
+	m.failed[id] = failure{deliveredTo: deliveredTo, lastError: lastError, retryAt: retryAt}
+	return nil
+}
+
+// receiver is a webhook endpoint answering with status and recording the requests it verified
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	payloads []Payload
+}
+
+func newReceiver(t *testing.T, secret string, status int) *receiver {
+	r := &receiver{status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.NoError(t, Verify(secret, req.Header.Get(SignatureHeader), body, time.Minute))
+
+		var p Payload
+		require.NoError(t, json.Unmarshal(body, &p))
+		assert.Equal(t, p.ID, req.Header.Get(EventIDHeader))
+		assert.Equal(t, p.Type, req.Header.Get(EventTypeHeader))
+
+		r.mu.Lock()
+		r.payloads = append(r.payloads, p)
+		r.mu.Unlock()
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func testConfig(endpoints ...config.WebhookEndpoint) config.WebhooksConfig {
+	return config.WebhooksConfig{
+		Endpoints:      endpoints,
+		PollInterval:   time.Second,
+		Timeout:        time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	header := Sign("secret", time.Now(), body)
+
+	assert.NoError(t, Verify("secret", header, body, time.Minute))
+	assert.ErrorIs(t, Verify("other", header, body, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"id":"2"}`), time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "v1=abc", body, 0), ErrInvalidSignature)
+
+	old := Sign("secret", time.Now().Add(-time.Hour), body)
+	assert.ErrorIs(t, Verify("secret", old, body, time.Minute), ErrExpiredSignature)
+	assert.NoError(t, Verify("secret", old, body, 0))
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, testConfig())
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 32*time.Second, d.backoff(6))
+	assert.Equal(t, time.Minute, d.backoff(7))
+	assert.Equal(t, time.Minute, d.backoff(100))
+}
+
+func TestDispatcher(t *testing.T) {
+	viper.Set("config", &config.Config{})
+	require.NoError(t, logging.Initialize())
+
+	userID := uuid.New()
+	newEvent := func() models.OutboxEvent {
+		return models.OutboxEvent{
+			ID:        uuid.New(),
+			Type:      "user.updated",
+			Entity:    "user",
+			EntityID:  userID,
+			UserID:    &userID,
+			Before:    map[string]any{"first_name": "John"},
+			After:     map[string]any{"first_name": "Jane"},
+			CreatedAt: time.Now().UTC(),
+		}
+	}
+
+	t.Run("delivers to every endpoint", func(t *testing.T) {
+		a := newReceiver(t, "secret-a", http.StatusNoContent)
+		b := newReceiver(t, "secret-b", http.StatusOK)
+		event := newEvent()
+		store := newMemoryStore(event)
+
+		d := NewDispatcher(func() Store { return store }, testConfig(
+			config.WebhookEndpoint{URL: a.URL, Secret: "secret-a"},
+			config.WebhookEndpoint{URL: b.URL, Secret: "secret-b"}))
+		n, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		assert.Equal(t, []string{a.URL, b.URL}, store.delivered[event.ID])
+		require.Len(t, a.payloads, 1)
+		require.Len(t, b.payloads, 1)
+		assert.Equal(t, event.ID.String(), a.payloads[0].ID)
+		assert.Equal(t, userID.String(), a.payloads[0].UserID)
+		assert.Equal(t, "Jane", a.payloads[0].After["first_name"])
+	})
+
+	t.Run("follows a replaced store", func(t *testing.T) {
+		r := newReceiver(t, "secret", http.StatusOK)
+		store := newMemoryStore(newEvent())
+		d := NewDispatcher(func() Store { return store }, testConfig(config.WebhookEndpoint{URL: r.URL, Secret: "secret"}))
+		_, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+
+		// The store is replaced when the database reconnects
+		replaced := newMemoryStore(newEvent())
+		store = replaced
+		n, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Len(t, replaced.delivered, 1)
+	})
+
+	t.Run("retries failed endpoints with backoff", func(t *testing.T) {
+		ok := newReceiver(t, "secret", http.StatusOK)
+		failing := newReceiver(t, "secret", http.StatusServiceUnavailable)
+		event := newEvent()
+		event.Attempts = 1
+		store := newMemoryStore(event)
+
+		now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+		d := NewDispatcher(func() Store { return store }, testConfig(
+			config.WebhookEndpoint{URL: ok.URL, Secret: "secret"},
+			config.WebhookEndpoint{URL: failing.URL, Secret: "secret"}))
+		d.now = func() time.Time { return now }
+		_, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+
+		f, found := store.failed[event.ID]
+		require.True(t, found)
+		assert.Equal(t, []string{ok.URL}, f.deliveredTo)
+		assert.Contains(t, f.lastError, "503")
+		// The second failed attempt waits twice the initial backoff
+		assert.Equal(t, now.Add(2*time.Second), f.retryAt)
+	})
+
+	t.Run("skips endpoints that accepted the event", func(t *testing.T) {
+		done := newReceiver(t, "secret", http.StatusOK)
+		other := newReceiver(t, "secret", http.StatusOK)
+		event := newEvent()
+		event.DeliveredTo = []string{done.URL}
+		store := newMemoryStore(event)
+
+		d := NewDispatcher(func() Store { return store }, testConfig(
+			config.WebhookEndpoint{URL: done.URL, Secret: "secret"},
+			config.WebhookEndpoint{URL: other.URL, Secret: "secret"}))
+		_, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+
+		assert.Empty(t, done.payloads)
+		assert.Len(t, other.payloads, 1)
+		assert.Equal(t, []string{done.URL, other.URL}, store.delivered[event.ID])
+	})
+
+	t.Run("dead letters after the last attempt", func(t *testing.T) {
+		failing := newReceiver(t, "secret", http.StatusInternalServerError)
+		event := newEvent()
+		event.Attempts = 2
+		store := newMemoryStore(event)
+
+		d := NewDispatcher(func() Store { return store }, testConfig(config.WebhookEndpoint{URL: failing.URL, Secret: "secret"}))
+		_, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+
+		f, found := store.failed[event.ID]
+		require.True(t, found)
+		assert.True(t, f.retryAt.IsZero())
+	})
+
+	t.Run("claims batches until the outbox is empty", func(t *testing.T) {
+		r := newReceiver(t, "secret", http.StatusOK)
+		var events []models.OutboxEvent
+		for range batchSize + 3 {
+			events = append(events, newEvent())
+		}
+		store := newMemoryStore(events...)
+
+		d := NewDispatcher(func() Store { return store }, testConfig(config.WebhookEndpoint{URL: r.URL, Secret: "secret"}))
+		n, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, batchSize+3, n)
+		assert.Len(t, store.delivered, batchSize+3)
+	})
+}